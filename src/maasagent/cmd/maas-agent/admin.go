@@ -0,0 +1,394 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.temporal.io/api/serviceerror"
+
+	wf "maas.io/core/src/maasagent/internal/workflow"
+)
+
+// quiesceRequest asks MAAS Agent to stop accepting new work, wait up to the
+// timeout for running activities to complete and exit.
+type quiesceRequest struct {
+	result chan quiesceResult
+	// done is closed once the result was sent to the client, so the process
+	// does not exit before that.
+	done    chan struct{}
+	timeout time.Duration
+}
+
+// quiesceResult is returned by /admin/quiesce endpoint
+type quiesceResult struct {
+	// Drained is false if the timeout expired before all activities completed
+	Drained bool `json:"drained"`
+	// Outstanding is a number of activities running when quiesce started
+	Outstanding int64 `json:"outstanding"`
+	// Remaining is a number of activities still running after the drain
+	Remaining int64 `json:"remaining"`
+}
+
+// signalRequest is accepted by /admin/signal endpoint
+type signalRequest struct {
+	WorkflowID string `json:"workflow_id"`
+	// RunID is optional, the latest run is signaled when empty
+	RunID      string          `json:"run_id"`
+	SignalName string          `json:"signal_name"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// workflowSignaler is the part of Temporal client used by /admin/signal
+type workflowSignaler interface {
+	SignalWorkflow(ctx context.Context, workflowID string, runID string,
+		signalName string, arg interface{}) error
+}
+
+// pauseResult is returned by /admin/pause and /admin/resume endpoints
+type pauseResult struct {
+	// Paused contains task queues of paused workers
+	Paused []string `json:"paused"`
+}
+
+// workerPauser is the part of worker pool used by /admin/pause and
+// /admin/resume
+type workerPauser interface {
+	Pause(taskQueue, workflowType string) []string
+	Resume(taskQueue, workflowType string) ([]string, error)
+	Paused() []string
+}
+
+// connectionStatuser is the part of connectionMonitor used by /admin/status
+type connectionStatuser interface {
+	status() connectionStatus
+}
+
+// setupAdmin registers administrative endpoints used for troubleshooting
+// and orchestration. Quiesce requests are sent to the quiesce channel.
+func setupAdmin(mux *http.ServeMux, cfg *config, quiesce chan<- quiesceRequest) {
+	mux.HandleFunc("/admin/config", configHandler(cfg))
+	mux.HandleFunc("/admin/features", featuresHandler)
+	mux.HandleFunc("/admin/quiesce", quiesceHandler(cfg, quiesce))
+}
+
+// configHandler returns effective configuration, after environment variable
+// expansion and normalization, with credentials redacted.
+func configHandler(cfg *config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		redacted, err := redactedConfig(cfg)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed serializing configuration")
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(redacted); err != nil {
+			log.Error().Err(err).Msg("Failed writing configuration")
+		}
+	}
+}
+
+// featuresHandler returns feature flags that are active for workflows.
+func featuresHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(wf.Features()); err != nil {
+		log.Error().Err(err).Msg("Failed writing feature flags")
+	}
+}
+
+// quiesceHandler stops MAAS Agent gracefully and responds once running
+// activities completed or the timeout (?timeout=, default is the drain
+// timeout) expired.
+func quiesceHandler(cfg *config, quiesce chan<- quiesceRequest) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		timeout := cfg.WorkerPool.DrainTimeout
+		if timeout == 0 {
+			timeout = defaultWorkerPoolDrainTimeout
+		}
+
+		if v := r.URL.Query().Get("timeout"); v != "" {
+			var err error
+
+			timeout, err = time.ParseDuration(v)
+			if err != nil || timeout < 0 {
+				http.Error(w, "invalid timeout", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Response is written after the drain, which can take longer than
+		// the write timeout of the server.
+		//nolint:errcheck // deadline cannot be set on some writers, e.g. in tests
+		http.NewResponseController(w).SetWriteDeadline(
+			time.Now().Add(timeout + httpShutdownTimeout))
+
+		req := quiesceRequest{
+			result:  make(chan quiesceResult, 1),
+			done:    make(chan struct{}),
+			timeout: timeout,
+		}
+
+		defer close(req.done)
+
+		select {
+		case quiesce <- req:
+		case <-r.Context().Done():
+			return
+		}
+
+		res := <-req.result
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			log.Error().Err(err).Msg("Failed writing quiesce result")
+		}
+
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// setupAdminSignal registers /admin/signal endpoint, that is set up separately
+// because it requires Temporal client.
+func setupAdminSignal(mux *http.ServeMux, cfg *config, c workflowSignaler) {
+	mux.HandleFunc("/admin/signal",
+		signalHandler(cfg.Admin.AllowedSignals, cfg.Admin.SignalToken, c))
+}
+
+// signalHandler forwards a signal to a running workflow. Only signals listed
+// in allowed are forwarded, and only for requests with the bearer token.
+// Requests are rejected, if the token is empty.
+func signalHandler(allowed []string, token string, c workflowSignaler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			log.Warn().Msg("Rejected admin signal request with invalid token")
+			http.Error(w, "invalid token", http.StatusForbidden)
+
+			return
+		}
+
+		var req signalRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if req.WorkflowID == "" || req.SignalName == "" {
+			http.Error(w, "workflow_id and signal_name are required", http.StatusBadRequest)
+			return
+		}
+
+		if !slices.Contains(allowed, req.SignalName) {
+			http.Error(w, "signal is not allowed", http.StatusForbidden)
+			return
+		}
+
+		var arg interface{}
+		if len(req.Payload) > 0 {
+			arg = req.Payload
+		}
+
+		err := c.SignalWorkflow(r.Context(), req.WorkflowID, req.RunID, req.SignalName, arg)
+		if err != nil {
+			var notFound *serviceerror.NotFound
+			if errors.As(err, &notFound) {
+				http.Error(w, "workflow not found", http.StatusNotFound)
+				return
+			}
+
+			log.Error().Err(err).
+				Str("workflow_id", req.WorkflowID).
+				Str("signal", req.SignalName).
+				Msg("Failed signaling workflow")
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+
+			return
+		}
+
+		log.Info().
+			Str("workflow_id", req.WorkflowID).
+			Str("run_id", req.RunID).
+			Str("signal", req.SignalName).
+			Msg("Workflow signaled from admin endpoint")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// setupAdminStatus registers /admin/status endpoint, that is set up
+// separately because it requires the Temporal connection monitor.
+func setupAdminStatus(mux *http.ServeMux, c connectionStatuser) {
+	mux.HandleFunc("/admin/status", statusHandler(c))
+}
+
+// statusHandler returns the controller the agent is connected to and the
+// state of the connection.
+func statusHandler(c connectionStatuser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(c.status()); err != nil {
+			log.Error().Err(err).Msg("Failed writing status")
+		}
+	}
+}
+
+// setupAdminPause registers /admin/pause and /admin/resume endpoints, that are
+// set up separately because they require the worker pool.
+func setupAdminPause(mux *http.ServeMux, p workerPauser) {
+	mux.HandleFunc("/admin/pause", pauseHandler(p))
+	mux.HandleFunc("/admin/resume", resumeHandler(p))
+}
+
+// pauseHandler pauses workers selected by optional ?task_queue= and
+// ?workflow_type= (all the workers, except the main one, when not set), so
+// they stop taking new work during maintenance. GET returns paused task queues.
+func pauseHandler(p workerPauser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var paused []string
+
+		switch r.Method {
+		case http.MethodGet:
+			paused = p.Paused()
+		case http.MethodPost:
+			query := r.URL.Query()
+			paused = p.Pause(query.Get("task_queue"), query.Get("workflow_type"))
+
+			log.Info().
+				Str("task_queue", query.Get("task_queue")).
+				Str("workflow_type", query.Get("workflow_type")).
+				Strs("paused", paused).
+				Msg("Workers paused from admin endpoint")
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		writePauseResult(w, paused)
+	}
+}
+
+// resumeHandler starts again workers paused with /admin/pause, selected in
+// the same way.
+func resumeHandler(p workerPauser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		query := r.URL.Query()
+
+		paused, err := p.Resume(query.Get("task_queue"), query.Get("workflow_type"))
+		if err != nil {
+			log.Error().Err(err).Msg("Failed resuming workers")
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+
+			return
+		}
+
+		log.Info().
+			Str("task_queue", query.Get("task_queue")).
+			Str("workflow_type", query.Get("workflow_type")).
+			Strs("paused", paused).
+			Msg("Workers resumed from admin endpoint")
+
+		writePauseResult(w, paused)
+	}
+}
+
+func writePauseResult(w http.ResponseWriter, paused []string) {
+	if paused == nil {
+		paused = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(pauseResult{Paused: paused}); err != nil {
+		log.Error().Err(err).Msg("Failed writing pause result")
+	}
+}
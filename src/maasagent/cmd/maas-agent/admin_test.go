@@ -0,0 +1,516 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/api/serviceerror"
+
+	wf "maas.io/core/src/maasagent/internal/workflow"
+)
+
+func TestConfigHandler(t *testing.T) {
+	cfg := &config{
+		SystemID:    "abcdef",
+		Secret:      "0123456789abcdef",
+		Controllers: []string{"10.0.0.1"},
+	}
+	cfg.WorkerPool.DrainTimeout = 10 * time.Second
+
+	mux := http.NewServeMux()
+	setupAdmin(mux, cfg, nil)
+
+	testcases := map[string]struct {
+		method string
+		status int
+	}{
+		"get": {
+			method: http.MethodGet,
+			status: http.StatusOK,
+		},
+		"post": {
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tc.method, "/admin/config", nil))
+
+			assert.Equal(t, tc.status, rec.Code)
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.NotContains(t, rec.Body.String(), cfg.Secret)
+
+			var result map[string]interface{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+
+			assert.Equal(t, "abcdef", result["system_id"])
+			assert.Equal(t, "<redacted>", result["secret"])
+			assert.Equal(t, []interface{}{"10.0.0.1"}, result["controllers"])
+			assert.Equal(t, "10s",
+				result["worker_pool"].(map[string]interface{})["drain_timeout"])
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	m := map[string]interface{}{
+		"secret":   "abc",
+		"empty":    "",
+		"password": "",
+		"nested": map[string]interface{}{
+			"api_token": "xyz",
+			"name":      "maas",
+		},
+		"secrets": map[string]interface{}{"uuid-1": "TOPSECRET"},
+		"tokens":  map[string]interface{}{},
+		"list": []interface{}{
+			map[string]interface{}{"password": "hunter2"},
+		},
+	}
+
+	redact(m)
+
+	assert.Equal(t, map[string]interface{}{
+		"secret":   "<redacted>",
+		"empty":    "",
+		"password": "",
+		"nested": map[string]interface{}{
+			"api_token": "<redacted>",
+			"name":      "maas",
+		},
+		"secrets": "<redacted>",
+		"tokens":  map[string]interface{}{},
+		"list": []interface{}{
+			map[string]interface{}{"password": "<redacted>"},
+		},
+	}, m)
+}
+
+func TestRedactedConfig(t *testing.T) {
+	cfg := &config{
+		SystemID: "abcdef",
+		Secret:   "0123456789abcdef",
+		Secrets:  map[string]string{"uuid-1": "TOPSECRET"},
+	}
+
+	m, err := redactedConfig(cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "abcdef", m["system_id"])
+	assert.Equal(t, "<redacted>", m["secret"])
+	assert.Equal(t, "<redacted>", m["secrets"])
+	assert.NotContains(t, fmt.Sprint(m), "TOPSECRET")
+}
+
+func TestFeaturesHandler(t *testing.T) {
+	wf.SetFeatures(map[string]bool{"new-path": true})
+	t.Cleanup(func() { wf.SetFeatures(nil) })
+
+	mux := http.NewServeMux()
+	setupAdmin(mux, &config{}, nil)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/features", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"new-path":true}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/features", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+type fakeConnectionStatuser connectionStatus
+
+func (s fakeConnectionStatuser) status() connectionStatus { return connectionStatus(s) }
+
+func TestStatusHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	setupAdminStatus(mux, fakeConnectionStatuser{
+		Controller:      "10.0.0.2:5271",
+		Connected:       true,
+		Epoch:           2,
+		Since:           time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		DurationSeconds: 60,
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/status", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"controller": "10.0.0.2:5271",
+		"connected": true,
+		"epoch": 2,
+		"since": "2024-01-02T03:04:05Z",
+		"duration_seconds": 60
+	}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/status", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestQuiesceHandler(t *testing.T) {
+	cfg := &config{}
+	cfg.WorkerPool.DrainTimeout = 10 * time.Second
+
+	testcases := map[string]struct {
+		method  string
+		query   string
+		status  int
+		timeout time.Duration
+	}{
+		"default timeout": {
+			method:  http.MethodPost,
+			status:  http.StatusOK,
+			timeout: 10 * time.Second,
+		},
+		"custom timeout": {
+			method:  http.MethodPost,
+			query:   "?timeout=1m",
+			status:  http.StatusOK,
+			timeout: time.Minute,
+		},
+		"invalid timeout": {
+			method: http.MethodPost,
+			query:  "?timeout=soon",
+			status: http.StatusBadRequest,
+		},
+		"get": {
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			quiesce := make(chan quiesceRequest, 1)
+
+			mux := http.NewServeMux()
+			setupAdmin(mux, cfg, quiesce)
+
+			go func() {
+				req, ok := <-quiesce
+				if !ok {
+					return
+				}
+
+				assert.Equal(t, tc.timeout, req.timeout)
+				req.result <- quiesceResult{Drained: true, Outstanding: 2}
+			}()
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tc.method, "/admin/quiesce"+tc.query, nil))
+			close(quiesce)
+
+			assert.Equal(t, tc.status, rec.Code)
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var result quiesceResult
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+			assert.Equal(t, quiesceResult{Drained: true, Outstanding: 2}, result)
+		})
+	}
+}
+
+type fakeSignaler struct {
+	err        error
+	workflowID string
+	runID      string
+	signalName string
+	arg        interface{}
+}
+
+func (s *fakeSignaler) SignalWorkflow(_ context.Context, workflowID string, runID string,
+	signalName string, arg interface{}) error {
+	s.workflowID, s.runID, s.signalName, s.arg = workflowID, runID, signalName, arg
+	return s.err
+}
+
+func TestSignalHandler(t *testing.T) {
+	cfg := &config{}
+	cfg.Admin.AllowedSignals = []string{"confirm"}
+	cfg.Admin.SignalToken = "s3cr3t"
+
+	testcases := map[string]struct {
+		method        string
+		body          string
+		authorization string
+		token         *string
+		err           error
+		status        int
+		arg           interface{}
+	}{
+		"signal": {
+			method: http.MethodPost,
+			body:   `{"workflow_id": "deploy:abcdef", "run_id": "1", "signal_name": "confirm", "payload": {"ok": true}}`,
+			status: http.StatusNoContent,
+			arg:    json.RawMessage(`{"ok": true}`),
+		},
+		"signal without payload": {
+			method: http.MethodPost,
+			body:   `{"workflow_id": "deploy:abcdef", "run_id": "1", "signal_name": "confirm"}`,
+			status: http.StatusNoContent,
+		},
+		"signal not allowed": {
+			method: http.MethodPost,
+			body:   `{"workflow_id": "deploy:abcdef", "signal_name": "abort"}`,
+			status: http.StatusForbidden,
+		},
+		"missing workflow id": {
+			method: http.MethodPost,
+			body:   `{"signal_name": "confirm"}`,
+			status: http.StatusBadRequest,
+		},
+		"malformed request": {
+			method: http.MethodPost,
+			body:   `{`,
+			status: http.StatusBadRequest,
+		},
+		"workflow not found": {
+			method: http.MethodPost,
+			body:   `{"workflow_id": "deploy:abcdef", "signal_name": "confirm"}`,
+			err:    serviceerror.NewNotFound("workflow not found"),
+			status: http.StatusNotFound,
+		},
+		"signal failure": {
+			method: http.MethodPost,
+			body:   `{"workflow_id": "deploy:abcdef", "signal_name": "confirm"}`,
+			err:    errors.New("unavailable"),
+			status: http.StatusBadGateway,
+		},
+		"get": {
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		"missing token": {
+			method:        http.MethodPost,
+			body:          `{"workflow_id": "deploy:abcdef", "signal_name": "confirm"}`,
+			authorization: "-",
+			status:        http.StatusUnauthorized,
+		},
+		"not a bearer token": {
+			method:        http.MethodPost,
+			body:          `{"workflow_id": "deploy:abcdef", "signal_name": "confirm"}`,
+			authorization: "Basic czNjcjN0",
+			status:        http.StatusUnauthorized,
+		},
+		"invalid token": {
+			method:        http.MethodPost,
+			body:          `{"workflow_id": "deploy:abcdef", "signal_name": "confirm"}`,
+			authorization: "Bearer guess",
+			status:        http.StatusForbidden,
+		},
+		"token not configured": {
+			method:        http.MethodPost,
+			body:          `{"workflow_id": "deploy:abcdef", "signal_name": "confirm"}`,
+			authorization: "Bearer ",
+			token:         new(string),
+			status:        http.StatusForbidden,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			signaler := &fakeSignaler{err: tc.err}
+
+			cfg := *cfg
+			if tc.token != nil {
+				cfg.Admin.SignalToken = *tc.token
+			}
+
+			mux := http.NewServeMux()
+			setupAdminSignal(mux, &cfg, signaler)
+
+			req := httptest.NewRequest(tc.method, "/admin/signal", strings.NewReader(tc.body))
+
+			switch tc.authorization {
+			case "":
+				req.Header.Set("Authorization", "Bearer s3cr3t")
+			case "-":
+			default:
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.status, rec.Code)
+
+			if tc.status == http.StatusUnauthorized || tc.status == http.StatusForbidden {
+				assert.Empty(t, signaler.signalName)
+			}
+
+			if tc.status != http.StatusNoContent {
+				return
+			}
+
+			assert.Equal(t, "deploy:abcdef", signaler.workflowID)
+			assert.Equal(t, "1", signaler.runID)
+			assert.Equal(t, "confirm", signaler.signalName)
+			assert.Equal(t, tc.arg, signaler.arg)
+		})
+	}
+}
+
+type fakePauser struct {
+	taskQueue    string
+	workflowType string
+	paused       []string
+	err          error
+}
+
+func (p *fakePauser) Pause(taskQueue, workflowType string) []string {
+	p.taskQueue, p.workflowType = taskQueue, workflowType
+	p.paused = []string{"abcdef@agent:deploy"}
+
+	return p.paused
+}
+
+func (p *fakePauser) Resume(taskQueue, workflowType string) ([]string, error) {
+	p.taskQueue, p.workflowType = taskQueue, workflowType
+	if p.err != nil {
+		return p.paused, p.err
+	}
+
+	p.paused = nil
+
+	return p.paused, nil
+}
+
+func (p *fakePauser) Paused() []string { return p.paused }
+
+func TestPauseHandlers(t *testing.T) {
+	testcases := map[string]struct {
+		method       string
+		path         string
+		err          error
+		status       int
+		taskQueue    string
+		workflowType string
+		out          string
+	}{
+		"pause by workflow type": {
+			method:       http.MethodPost,
+			path:         "/admin/pause?workflow_type=deploy",
+			status:       http.StatusOK,
+			workflowType: "deploy",
+			out:          `{"paused":["abcdef@agent:deploy"]}`,
+		},
+		"pause by task queue": {
+			method:    http.MethodPost,
+			path:      "/admin/pause?task_queue=abcdef@agent:deploy",
+			status:    http.StatusOK,
+			taskQueue: "abcdef@agent:deploy",
+			out:       `{"paused":["abcdef@agent:deploy"]}`,
+		},
+		"list paused": {
+			method: http.MethodGet,
+			path:   "/admin/pause",
+			status: http.StatusOK,
+			out:    `{"paused":[]}`,
+		},
+		"resume": {
+			method:       http.MethodPost,
+			path:         "/admin/resume?workflow_type=deploy",
+			status:       http.StatusOK,
+			workflowType: "deploy",
+			out:          `{"paused":[]}`,
+		},
+		"resume failure": {
+			method: http.MethodPost,
+			path:   "/admin/resume",
+			err:    errors.New("start failed"),
+			status: http.StatusInternalServerError,
+		},
+		"get resume": {
+			method: http.MethodGet,
+			path:   "/admin/resume",
+			status: http.StatusMethodNotAllowed,
+		},
+		"delete pause": {
+			method: http.MethodDelete,
+			path:   "/admin/pause",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			pauser := &fakePauser{err: tc.err}
+
+			mux := http.NewServeMux()
+			setupAdminPause(mux, pauser)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+
+			assert.Equal(t, tc.status, rec.Code)
+
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.JSONEq(t, tc.out, rec.Body.String())
+			assert.Equal(t, tc.taskQueue, pauser.taskQueue)
+			assert.Equal(t, tc.workflowType, pauser.workflowType)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.temporal.io/sdk/workflow"
+
+	"maas.io/core/src/maasagent/internal/power"
+	"maas.io/core/src/maasagent/internal/workflow/worker"
+)
+
+// agentCapabilities describes what the agent currently supports, so Region
+// Controller can avoid scheduling work the agent cannot do.
+type agentCapabilities struct {
+	SystemID string `json:"system_id"`
+	// Registrations are workflows and activities the agent executes per task
+	// queue, as configured at the moment
+	Registrations []worker.Registration `json:"registrations"`
+	Power         power.Capabilities    `json:"power"`
+	// Codecs are payload codecs applied on encode, in order
+	Codecs []string `json:"codecs"`
+	// PassthroughWorkflows are workflows with payloads that are not encrypted
+	PassthroughWorkflows []string `json:"passthrough_workflows,omitempty"`
+	LoadTest             bool     `json:"loadtest"`
+}
+
+// capabilitiesService provides agent-capabilities workflow, executed on the
+// main worker, that reports agentCapabilities.
+type capabilitiesService struct {
+	cfg           *config
+	registrations func() []worker.Registration
+	power         func() power.Capabilities
+}
+
+func (s *capabilitiesService) ConfigurationWorkflows() map[string]interface{} {
+	return map[string]interface{}{"agent-capabilities": s.capabilitiesWorkflow}
+}
+
+func (s *capabilitiesService) ConfigurationActivities() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func (s *capabilitiesService) capabilitiesWorkflow(ctx workflow.Context) (agentCapabilities, error) {
+	ctx = workflow.WithLocalActivityOptions(ctx, workflow.LocalActivityOptions{
+		ScheduleToCloseTimeout: 30 * time.Second,
+	})
+
+	var result agentCapabilities
+
+	// Capabilities change at runtime, so they are collected by an activity
+	// and recorded in the workflow history.
+	err := workflow.ExecuteLocalActivity(ctx, s.capabilities).Get(ctx, &result)
+
+	return result, err
+}
+
+func (s *capabilitiesService) capabilities(_ context.Context) (agentCapabilities, error) {
+	codecs := s.cfg.Codecs
+	if codecs == nil {
+		codecs = []string{"encrypt"}
+	}
+
+	return agentCapabilities{
+		SystemID:             s.cfg.SystemID,
+		Registrations:        s.registrations(),
+		Power:                s.power(),
+		Codecs:               codecs,
+		PassthroughWorkflows: s.cfg.Codec.PassthroughWorkflows,
+		LoadTest:             s.cfg.EnableLoadTest,
+	}, nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+
+	"maas.io/core/src/maasagent/internal/power"
+	"maas.io/core/src/maasagent/internal/workflow/worker"
+)
+
+func TestCapabilitiesWorkflow(t *testing.T) {
+	cfg := &config{SystemID: "abcdef", EnableLoadTest: true}
+	cfg.Codec.PassthroughWorkflows = []string{"check-ip"}
+
+	registrations := []worker.Registration{
+		{TaskQueue: "abcdef@agent:main", Workflows: []string{"agent-capabilities"}},
+		{Group: "power-service", TaskQueue: "abcdef@agent:power", Activities: []string{"power-on"}},
+	}
+
+	svc := &capabilitiesService{
+		cfg:           cfg,
+		registrations: func() []worker.Registration { return registrations },
+		power: func() power.Capabilities {
+			return power.Capabilities{ExecCommands: []string{"script"}}
+		},
+	}
+
+	var suite testsuite.WorkflowTestSuite
+
+	env := suite.NewTestWorkflowEnvironment()
+
+	for name, fn := range svc.ConfigurationWorkflows() {
+		env.RegisterWorkflowWithOptions(fn, workflow.RegisterOptions{Name: name})
+	}
+
+	env.ExecuteWorkflow("agent-capabilities")
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result agentCapabilities
+	require.NoError(t, env.GetWorkflowResult(&result))
+
+	assert.Equal(t, agentCapabilities{
+		SystemID:             "abcdef",
+		Registrations:        registrations,
+		Power:                power.Capabilities{ExecCommands: []string{"script"}},
+		Codecs:               []string{"encrypt"},
+		PassthroughWorkflows: []string{"check-ip"},
+		LoadTest:             true,
+	}, result)
+}
@@ -0,0 +1,1225 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.temporal.io/sdk/client"
+	"gopkg.in/yaml.v3"
+
+	"maas.io/core/src/maasagent/internal/power"
+	"maas.io/core/src/maasagent/internal/retry"
+	wf "maas.io/core/src/maasagent/internal/workflow"
+	"maas.io/core/src/maasagent/internal/workflow/worker"
+	"maas.io/core/src/maasagent/pkg/workflow/codec"
+)
+
+// config represents a necessary set of configuration options for MAAS Agent
+// TODO: change to 'kebab-case' to follow the same syntax as Juju
+type config struct {
+	MAASUUID  string `yaml:"maas_uuid"`
+	SystemID  string `yaml:"system_id"`
+	Secret    string `yaml:"secret"`
+	LogLevel  string `yaml:"log_level"`
+	LogOutput string `yaml:"log_output"`
+	// Secrets of other MAAS installations served by the agent, by MAAS UUID.
+	Secrets   map[string]string `yaml:"secrets"`
+	HTTPProxy struct {
+		CacheDir  string `yaml:"cache_dir"`
+		CacheSize int64  `yaml:"cache_size"`
+		// MaxConcurrentImageWrites limits number of boot resources fetched
+		// into the cache at the same time. (default: 0, no limit)
+		MaxConcurrentImageWrites int64 `yaml:"max_concurrent_image_writes"`
+		// MaxFetchRate limits total rate in bytes per second of boot
+		// resources fetched from Region Controller. (default: 0, no limit)
+		MaxFetchRate int64 `yaml:"max_fetch_rate"`
+	} `yaml:"httpproxy"`
+	Controllers []string `yaml:"controllers,flow"`
+	// Profile selects one of Profiles, that overrides fields of the rest of
+	// the configuration, so one file can serve several environments.
+	// MAAS_AGENT_PROFILE environment variable takes precedence.
+	// (default: none)
+	Profile string `yaml:"profile"`
+	// Profiles are named blocks with the same fields as the configuration.
+	// They are dropped once the selected one was applied.
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+	// FastStart skips optional startup verifications, such as the payload
+	// codec self-test, trading early detection of misconfiguration for
+	// faster start. Configuration is still loaded and codecs initialised.
+	// (default: false)
+	FastStart bool `yaml:"fast_start"`
+	// WatchConfig makes the agent restart, in the same way as on SIGHUP,
+	// once the configuration file was changed and is valid. (default: false)
+	WatchConfig bool `yaml:"watch_config"`
+	// ShutdownSignals are names of signals (e.g. TERM or SIGQUIT) that make
+	// the agent drain the worker pool and stop. SIGHUP always restarts the
+	// agent and SIGUSR2 cycles the log level. (default: [TERM, INT])
+	ShutdownSignals []string `yaml:"shutdown_signals,flow"`
+	// PreShutdownHook is an absolute path of an executable run before the
+	// agent drains the worker pool and stops (not on SIGHUP). Its output is
+	// logged, failure does not prevent the shutdown. (default: none)
+	PreShutdownHook string `yaml:"pre_shutdown_hook"`
+	// PreShutdownHookTimeout is how long the hook can run before it is
+	// killed. (default: 30s)
+	PreShutdownHookTimeout time.Duration `yaml:"pre_shutdown_hook_timeout"`
+	// EnableLoadTest registers the loadtest workflow, that does configurable
+	// artificial work for capacity planning. Must not be used in production.
+	// (default: false)
+	EnableLoadTest bool `yaml:"enable_loadtest"`
+	// Features are feature flags consulted by workflows to switch between the
+	// old and the new code path. Flags are re-read on SIGHUP and flags that
+	// are not set are disabled.
+	Features map[string]bool `yaml:"features"`
+	// DebugDumpDir is a directory where a redacted run summary of every
+	// workflow executed by the agent is written, when set.
+	DebugDumpDir string `yaml:"debug_dump_dir"`
+	// ResultWebhook receives a CloudEvent every time a workflow executed by
+	// the agent completes or fails, when URL is set.
+	ResultWebhook struct {
+		URL string `yaml:"url"`
+		// Secret is used to sign events with HMAC-SHA256, when set.
+		Secret string `yaml:"secret"`
+	} `yaml:"result_webhook"`
+	// TaskQueuePrefix is prepended to names of Task Queues polled by the agent.
+	// Region Controller has to target the same prefixed names.
+	TaskQueuePrefix string `yaml:"task_queue_prefix"`
+	// DNSServer is used to resolve controller hostnames instead of the
+	// system resolver, when set.
+	DNSServer string `yaml:"dns_server"`
+	Codec     struct {
+		// MaxPayloadSize is a maximum size of a payload before encryption.
+		MaxPayloadSize int `yaml:"max_payload_size"`
+		// PassthroughWorkflows are types of workflows, whose payloads (and
+		// payloads of their activities) are not encrypted, e.g. high-volume
+		// and non-sensitive ones. Encrypted payloads are still decrypted.
+		PassthroughWorkflows []string `yaml:"passthrough_workflows,flow"`
+		// DecodeRetries is a number of retries to decrypt a payload with
+		// secrets of all the configured MAAS installations, if decrypting
+		// it with the secret it is labelled with failed. (default: 0)
+		DecodeRetries int `yaml:"decode_retries"`
+		// DecodeRetryBackoff is a delay before every decode retry.
+		// (default: 100ms)
+		DecodeRetryBackoff time.Duration `yaml:"decode_retry_backoff"`
+	} `yaml:"codec"`
+	// Codecs is an ordered list of payload codecs applied on encode.
+	// Known codecs are "compress" and "encrypt". (default: [encrypt])
+	Codecs  []string `yaml:"codecs,flow"`
+	Tracing struct {
+		OTLPHTTPEndpoint string `yaml:"otlp_http_endpoint"`
+		Enabled          bool   `yaml:"enabled"`
+	} `yaml:"tracing"`
+	Metrics struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"metrics"`
+	Profiling struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"profiling"`
+	// HTTPServer limits the HTTP server serving metrics, profiling and
+	// administrative endpoints, so a misbehaving client cannot tie it up.
+	HTTPServer struct {
+		// ReadTimeout limits reading of a whole request. (default: 30s)
+		ReadTimeout time.Duration `yaml:"read_timeout"`
+		// WriteTimeout limits writing of a response. /admin/quiesce extends
+		// it by the drain timeout. (default: 60s)
+		WriteTimeout time.Duration `yaml:"write_timeout"`
+		// MaxConnections is a number of connections served at the same time,
+		// others wait to be accepted. (default: 16)
+		MaxConnections int `yaml:"max_connections"`
+		// MaxRequestBodyBytes limits size of request bodies. (default: 1MiB)
+		MaxRequestBodyBytes int64 `yaml:"max_request_body_bytes"`
+	} `yaml:"http_server"`
+	// BackoffStrategy is a strategy of retries of Temporal client dial, worker
+	// pool start and BMC retries. It is either exponential, or decorrelated
+	// (exponential with decorrelated jitter), that spreads retries of many
+	// concurrent operations more evenly. (default: exponential)
+	BackoffStrategy string `yaml:"backoff_strategy"`
+	// Backoff is used for retries of Temporal client dial and worker pool start
+	Backoff struct {
+		InitialInterval time.Duration `yaml:"initial_interval"`
+		// RandomizationFactor is a pointer, because zero disables randomization
+		RandomizationFactor *float64      `yaml:"randomization_factor"`
+		Multiplier          float64       `yaml:"multiplier"`
+		MaxElapsedTime      time.Duration `yaml:"max_elapsed_time"`
+	} `yaml:"backoff"`
+	// DialTimeout limits every attempt to connect to a single controller, so
+	// the agent moves on to the next controller quickly when one is down.
+	// Backoff still limits the total time spent on retries. (default: 5s)
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+	// RequireServerVersion is a constraint Temporal server version must
+	// satisfy, e.g. ">=1.22.0 <2.0.0", otherwise the agent fails to start.
+	// (default: server version is only logged)
+	RequireServerVersion string `yaml:"require_server_version"`
+	// GRPCMaxMessageBytes is a maximum size of a gRPC message sent to or
+	// received from Temporal server, e.g. a batch of large workflow payloads.
+	// It must not be less than codec.max_payload_size, and raising it only
+	// helps as far as the server allows. (default: 128MiB)
+	GRPCMaxMessageBytes int `yaml:"grpc_max_message_bytes"`
+	// RPCThrottle limits RPCs sent to Temporal server, including polls and
+	// task completions, and delays them while the server is overloaded.
+	RPCThrottle struct {
+		// Rate is a number of RPCs per second. (default: 0, no limit)
+		Rate float64 `yaml:"rate"`
+		// Burst is a number of RPCs sent at once above Rate. (default: 1)
+		Burst int `yaml:"burst"`
+		// MinBackoff is a delay of RPCs once the server reported it is
+		// overloaded, doubled on every further report. (default: 100ms)
+		MinBackoff time.Duration `yaml:"min_backoff"`
+		// MaxBackoff is the longest delay of RPCs. (default: 10s)
+		MaxBackoff time.Duration `yaml:"max_backoff"`
+	} `yaml:"rpc_throttle"`
+	// GRPCKeepalive configures keepalive pings of the Temporal client
+	// connection, so connections dropped by middleboxes are detected.
+	GRPCKeepalive struct {
+		// Time is an interval of pings. (default: 30s, minimum: 10s)
+		Time time.Duration `yaml:"time"`
+		// Timeout is how long to wait for a ping ack. (default: 15s)
+		Timeout time.Duration `yaml:"timeout"`
+		// PermitWithoutStream allows pings when there are no active calls.
+		// It is a pointer, because it defaults to true. (default: true)
+		PermitWithoutStream *bool `yaml:"permit_without_stream"`
+	} `yaml:"grpc_keepalive"`
+	WorkerPool struct {
+		// FailureThreshold is a number of worker errors received within
+		// FailureWindow after which the worker pool is considered failed.
+		FailureThreshold int           `yaml:"failure_threshold"`
+		FailureWindow    time.Duration `yaml:"failure_window"`
+		// DrainTimeout is time given to running activities to complete on shutdown.
+		DrainTimeout time.Duration `yaml:"drain_timeout"`
+		// PartialStartOK allows services to keep workers that have started,
+		// when workers for some of their task queues failed to start.
+		PartialStartOK bool `yaml:"partial_start_ok"`
+		// SeparateActivityWorkers makes services poll workflow and activity
+		// tasks of the same task queue by different workers.
+		SeparateActivityWorkers bool `yaml:"separate_activity_workers"`
+		// MaxConcurrentActivities limits number of activities executed at the
+		// same time by all the workers configured by Region Controller.
+		// Activities over the limit wait. (default: 0, no limit)
+		MaxConcurrentActivities int64 `yaml:"max_concurrent_activities"`
+		// MaxConcurrentWorkflows is a soft limit of workflows executed at the
+		// same time by all the workers configured by Region Controller,
+		// including the ones waiting for activities or timers. Workers stop
+		// polling new workflows at the limit and poll again once workflows
+		// complete, leaving work over it for other agents. (default: 0, no
+		// limit)
+		MaxConcurrentWorkflows int64 `yaml:"max_concurrent_workflows"`
+		// RestartOnNamespaceNotFound makes the agent restart the worker pool,
+		// abandoning work in progress, instead of exiting when Temporal
+		// namespace is not found, e.g. after it was recreated. (default: false)
+		RestartOnNamespaceNotFound bool `yaml:"restart_on_namespace_not_found"`
+		// MaxHeartbeatThrottleInterval is the maximum interval between activity
+		// heartbeats sent to Temporal. (default: Temporal SDK default)
+		MaxHeartbeatThrottleInterval time.Duration `yaml:"max_heartbeat_throttle_interval"`
+		// MaxWorkflowExecutionTime is a ceiling of execution time of every
+		// workflow executed by the agent, after which the workflow is
+		// cancelled and failed. (default: 0, no limit)
+		MaxWorkflowExecutionTime time.Duration `yaml:"max_workflow_execution_time"`
+		// ClockSkewWarningThreshold is how much the local clock can differ
+		// from the clock of Temporal server, before a warning is logged for
+		// activities started. (default: 10s)
+		ClockSkewWarningThreshold time.Duration `yaml:"clock_skew_warning_threshold"`
+		// StartStagger is an upper bound of a random delay before the worker
+		// pool starts, so agents started at the same time do not register
+		// with Temporal all at once. (default: 0, no delay)
+		StartStagger time.Duration `yaml:"start_stagger"`
+		// StartConcurrency is a number of task queues services start workers
+		// for at the same time. (default: 1)
+		StartConcurrency int `yaml:"start_concurrency"`
+	} `yaml:"worker_pool"`
+	Power struct {
+		// BMCLockMode is one of queue, fail-fast or disabled, and defines what
+		// happens to a power action when another one is in progress for the
+		// same machine. (default: queue)
+		BMCLockMode string `yaml:"bmc_lock_mode"`
+		// EnableExecPower allows power actions with the exec driver, that runs
+		// one of ExecCommands (name to command template) instead of the MAAS
+		// power CLI. (default: false)
+		EnableExecPower bool              `yaml:"enable_exec_power"`
+		ExecCommands    map[string]string `yaml:"exec_commands"`
+		// CircuitBreaker makes power actions for a machine fail fast during
+		// Cooldown, after FailureThreshold consecutive failures within Window.
+		// (default: disabled)
+		CircuitBreaker struct {
+			FailureThreshold int           `yaml:"failure_threshold"`
+			Window           time.Duration `yaml:"window"`
+			Cooldown         time.Duration `yaml:"cooldown"`
+		} `yaml:"circuit_breaker"`
+		// BMCRetry makes power commands retry up to MaxRetries times within
+		// a single activity attempt, when BMC is unreachable. Jitter is
+		// a randomization factor of intervals. (default: disabled)
+		BMCRetry struct {
+			InitialInterval time.Duration `yaml:"initial_interval"`
+			MaxInterval     time.Duration `yaml:"max_interval"`
+			Jitter          float64       `yaml:"jitter"`
+			MaxRetries      int           `yaml:"max_retries"`
+		} `yaml:"bmc_retry"`
+		// RetryWarningThreshold makes power actions that needed more retries
+		// than that be logged with the machine. (default: 0, disabled)
+		RetryWarningThreshold int `yaml:"retry_warning_threshold"`
+		// SettleDelay is how long power on, off and cycle wait for BMC to
+		// settle, before querying the power state they return.
+		// (default: 0, the state reported by the action is returned)
+		SettleDelay time.Duration `yaml:"settle_delay"`
+		// MetricLabels are keys of machine labels supplied by Region, that
+		// are added to power metrics. Only low cardinality labels (e.g. zone)
+		// should be listed. (default: none)
+		MetricLabels []string `yaml:"metric_labels,flow"`
+		// BMCAllowedCIDRs are subnets of BMC addresses power commands are
+		// allowed to target. Every address, host or URI driver option is
+		// checked and commands without any are rejected, except for the
+		// manual driver. Hostnames are checked as resolved by the agent
+		// DNS, IP addresses should be used if DNS is not trusted.
+		// (default: any address)
+		BMCAllowedCIDRs []string `yaml:"bmc_allowed_cidrs,flow"`
+		// History keeps up to Size power states observed per machine for up
+		// to Retention, so Region can query them. (default: disabled)
+		History struct {
+			Size      int           `yaml:"size"`
+			Retention time.Duration `yaml:"retention"`
+		} `yaml:"history"`
+		// BootProfiles are named sequences of boot targets (network, disk),
+		// e.g. commission: [network, disk], that set-boot-order can reference.
+		BootProfiles map[string][]string `yaml:"boot_profiles"`
+		// SecretProvider resolves secret references of power actions into
+		// BMC credentials. Type is one of file (secrets are files in Dir) or
+		// vault (KV version 2 secrets engine at VaultMount). (default: none)
+		SecretProvider struct {
+			Type         string `yaml:"type"`
+			Dir          string `yaml:"dir"`
+			VaultAddress string `yaml:"vault_address"`
+			VaultToken   string `yaml:"vault_token"`
+			VaultMount   string `yaml:"vault_mount"`
+		} `yaml:"secret_provider"`
+	} `yaml:"power"`
+	// SearchAttributes are upserted on workflows executed by the agent.
+	// They must be registered on the Temporal cluster before enabling.
+	SearchAttributes struct {
+		Enabled     bool   `yaml:"enabled"`
+		SystemIDKey string `yaml:"system_id_key"`
+		ActionKey   string `yaml:"action_key"`
+	} `yaml:"search_attributes"`
+	Admin struct {
+		// AllowedSignals are names of signals that can be sent to workflows
+		// with /admin/signal endpoint. (default: none)
+		AllowedSignals []string `yaml:"allowed_signals,flow"`
+		// SignalToken has to be sent as a bearer token with every request
+		// to /admin/signal endpoint. It is required, if AllowedSignals are set.
+		SignalToken string `yaml:"signal_token"`
+		// AllowedWorkflows are names of workflows that can be executed with
+		// maas-agent exec subcommand. (default: none)
+		AllowedWorkflows []string `yaml:"allowed_workflows,flow"`
+	} `yaml:"admin"`
+	CheckIP struct {
+		// CoalescingWindow is for how long a probe result is shared with
+		// concurrent checks of the same addresses.
+		CoalescingWindow time.Duration `yaml:"coalescing_window"`
+	} `yaml:"check_ip"`
+	Workflows struct {
+		// ScheduleToStartTimeout is a map of workflow type to ScheduleToStart
+		// timeout applied to activities it schedules on other task queues.
+		// (default: 60s)
+		ScheduleToStartTimeout map[string]time.Duration `yaml:"schedule_to_start_timeout"`
+		// WorkflowTaskTimeout is used for workflows started by the agent.
+		// (default: Temporal server default)
+		WorkflowTaskTimeout time.Duration `yaml:"workflow_task_timeout"`
+	} `yaml:"workflows"`
+}
+
+// validate checks that configuration has all the required options set and
+// option values are valid.
+func (c *config) validate() error {
+	if c.SystemID == "" {
+		return errors.New("configuration error: system_id is required")
+	}
+
+	if c.LogLevel != "" {
+		if _, err := zerolog.ParseLevel(c.LogLevel); err != nil {
+			return fmt.Errorf("configuration error: log_level: %w", err)
+		}
+	}
+
+	if _, err := c.shutdownSignals(); err != nil {
+		return err
+	}
+
+	if _, _, err := parseLogOutput(c.LogOutput); err != nil {
+		return fmt.Errorf("configuration error: log_output: %w", err)
+	}
+
+	if controllers, _ := normalizeControllers(c.Controllers); len(controllers) == 0 {
+		return errors.New("configuration error: at least one valid controller is required")
+	}
+
+	switch c.BackoffStrategy {
+	case "", retry.StrategyExponential, retry.StrategyDecorrelated:
+	default:
+		return fmt.Errorf("configuration error: backoff_strategy: unknown strategy %q",
+			c.BackoffStrategy)
+	}
+
+	if c.PreShutdownHook != "" && !filepath.IsAbs(c.PreShutdownHook) {
+		return fmt.Errorf("configuration error: pre_shutdown_hook: %q must be an absolute path",
+			c.PreShutdownHook)
+	}
+
+	if c.PreShutdownHookTimeout < 0 {
+		return errors.New("configuration error: pre_shutdown_hook_timeout cannot be negative")
+	}
+
+	if c.DialTimeout < 0 {
+		return errors.New("configuration error: dial_timeout cannot be negative")
+	}
+
+	if h := c.HTTPServer; h.ReadTimeout < 0 || h.WriteTimeout < 0 ||
+		h.MaxConnections < 0 || h.MaxRequestBodyBytes < 0 {
+		return errors.New("configuration error: http_server limits cannot be negative")
+	}
+
+	if c.Codec.DecodeRetries < 0 || c.Codec.DecodeRetryBackoff < 0 {
+		return errors.New("configuration error: codec.decode_retries and " +
+			"codec.decode_retry_backoff cannot be negative")
+	}
+
+	if _, err := parseVersionConstraint(c.RequireServerVersion); err != nil {
+		return fmt.Errorf("configuration error: require_server_version: %w", err)
+	}
+
+	switch power.BMCLockMode(c.Power.BMCLockMode) {
+	case "", power.BMCLockQueue, power.BMCLockFailFast, power.BMCLockDisabled:
+	default:
+		return fmt.Errorf("configuration error: power.bmc_lock_mode: unknown mode %q",
+			c.Power.BMCLockMode)
+	}
+
+	if len(c.Admin.AllowedSignals) > 0 && c.Admin.SignalToken == "" {
+		return errors.New("configuration error: admin.signal_token is required with admin.allowed_signals")
+	}
+
+	for name, template := range c.Power.ExecCommands {
+		if err := power.ValidateExecCommand(template); err != nil {
+			return fmt.Errorf("configuration error: power.exec_commands: %q: %w", name, err)
+		}
+	}
+
+	for name, targets := range c.Power.BootProfiles {
+		if err := power.ValidateBootProfile(targets); err != nil {
+			return fmt.Errorf("configuration error: power.boot_profiles: %q: %w", name, err)
+		}
+	}
+
+	if cb := c.Power.CircuitBreaker; cb.FailureThreshold > 0 && (cb.Window <= 0 || cb.Cooldown <= 0) {
+		return errors.New("configuration error: power.circuit_breaker: window and cooldown must be positive")
+	}
+
+	if _, err := c.bmcAllowedPrefixes(); err != nil {
+		return fmt.Errorf("configuration error: power.bmc_allowed_cidrs: %w", err)
+	}
+
+	if _, err := c.secretProvider(); err != nil {
+		return fmt.Errorf("configuration error: power.secret_provider: %w", err)
+	}
+
+	if r := c.Power.BMCRetry; r.MaxRetries > 0 && (r.InitialInterval <= 0 || r.MaxInterval < r.InitialInterval) {
+		return errors.New("configuration error: power.bmc_retry: initial_interval must be positive and not above max_interval")
+	}
+
+	if r := c.Power.BMCRetry; r.Jitter < 0 || r.Jitter > 1 {
+		return errors.New("configuration error: power.bmc_retry.jitter must be between 0 and 1")
+	}
+
+	if c.Power.SettleDelay < 0 {
+		return errors.New("configuration error: power.settle_delay cannot be negative")
+	}
+
+	for _, key := range c.Power.MetricLabels {
+		if !metricLabelRegexp.MatchString(key) {
+			return fmt.Errorf("configuration error: power.metric_labels: invalid label key %q", key)
+		}
+	}
+
+	if h := c.Power.History; h.Size > 0 && h.Retention <= 0 {
+		return errors.New("configuration error: power.history.retention must be positive")
+	}
+
+	if c.ResultWebhook.URL != "" {
+		if u, err := url.Parse(c.ResultWebhook.URL); err != nil {
+			return fmt.Errorf("configuration error: result_webhook.url: %w", err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("configuration error: result_webhook.url: unsupported scheme %q",
+				u.Scheme)
+		}
+	}
+
+	if c.GRPCKeepalive.Time < 0 || c.GRPCKeepalive.Timeout < 0 {
+		return errors.New("configuration error: grpc_keepalive: time and timeout cannot be negative")
+	}
+
+	if c.GRPCMaxMessageBytes < 0 {
+		return errors.New("configuration error: grpc_max_message_bytes cannot be negative")
+	}
+
+	if c.GRPCMaxMessageBytes > 0 {
+		maxPayloadSize := c.Codec.MaxPayloadSize
+		if maxPayloadSize == 0 {
+			maxPayloadSize = codec.DefaultMaxPayloadSize
+		}
+
+		if maxPayloadSize > c.GRPCMaxMessageBytes {
+			return fmt.Errorf("configuration error: grpc_max_message_bytes must be at least "+
+				"codec.max_payload_size (%d bytes)", maxPayloadSize)
+		}
+	}
+
+	if t := c.RPCThrottle; t.Rate < 0 || t.Burst < 0 || t.MinBackoff < 0 || t.MaxBackoff < 0 {
+		return errors.New("configuration error: rpc_throttle values cannot be negative")
+	}
+
+	if t := c.RPCThrottle; t.MinBackoff > 0 && t.MaxBackoff > 0 && t.MinBackoff > t.MaxBackoff {
+		return errors.New("configuration error: rpc_throttle.min_backoff cannot exceed max_backoff")
+	}
+
+	if c.GRPCKeepalive.Time > 0 && c.GRPCKeepalive.Time < minGRPCKeepaliveTime {
+		return fmt.Errorf("configuration error: grpc_keepalive.time must be at least %s",
+			minGRPCKeepaliveTime)
+	}
+
+	if c.WorkerPool.MaxWorkflowExecutionTime < 0 {
+		return errors.New("configuration error: worker_pool.max_workflow_execution_time cannot be negative")
+	}
+
+	if c.WorkerPool.ClockSkewWarningThreshold < 0 {
+		return errors.New("configuration error: worker_pool.clock_skew_warning_threshold cannot be negative")
+	}
+
+	if c.WorkerPool.StartStagger < 0 {
+		return errors.New("configuration error: worker_pool.start_stagger cannot be negative")
+	}
+
+	if c.WorkerPool.StartConcurrency < 0 {
+		return errors.New("configuration error: worker_pool.start_concurrency cannot be negative")
+	}
+
+	if c.WorkerPool.MaxHeartbeatThrottleInterval < 0 {
+		return errors.New("configuration error: worker_pool.max_heartbeat_throttle_interval cannot be negative")
+	}
+
+	if c.Workflows.WorkflowTaskTimeout < 0 {
+		return errors.New("configuration error: workflows.workflow_task_timeout cannot be negative")
+	}
+
+	if c.WorkerPool.MaxConcurrentActivities < 0 {
+		return errors.New("configuration error: worker_pool.max_concurrent_activities cannot be negative")
+	}
+
+	if c.WorkerPool.MaxConcurrentWorkflows < 0 {
+		return errors.New("configuration error: worker_pool.max_concurrent_workflows cannot be negative")
+	}
+
+	if c.WorkerPool.FailureThreshold < 0 {
+		return errors.New("configuration error: worker_pool.failure_threshold cannot be negative")
+	}
+
+	if c.FastStart {
+		if _, err := newPayloadCodecs(c); err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+	} else if err := selfTestPayloadCodecs(c); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+
+	return nil
+}
+
+// scheduleToStartTimeout returns ScheduleToStart timeout configured for the
+// given workflow type or the default one.
+func (c *config) scheduleToStartTimeout(workflowType string) time.Duration {
+	if timeout, ok := c.Workflows.ScheduleToStartTimeout[workflowType]; ok && timeout > 0 {
+		return timeout
+	}
+
+	return wf.DefaultScheduleToStartTimeout
+}
+
+// metricLabelRegexp matches machine label keys that can be metric attributes
+var metricLabelRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// shutdownSignalsByName are signals that can be configured to stop the agent
+var shutdownSignalsByName = map[string]os.Signal{
+	"TERM": syscall.SIGTERM,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"USR1": syscall.SIGUSR1,
+}
+
+// shutdownSignals returns signals configured to stop the agent or the default
+// ones, SIGTERM and SIGINT.
+func (c *config) shutdownSignals() ([]os.Signal, error) {
+	if len(c.ShutdownSignals) == 0 {
+		return []os.Signal{syscall.SIGTERM, syscall.SIGINT}, nil
+	}
+
+	signals := make([]os.Signal, 0, len(c.ShutdownSignals))
+
+	for _, name := range c.ShutdownSignals {
+		sig, ok := shutdownSignalsByName[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+		if !ok {
+			return nil, fmt.Errorf("configuration error: shutdown_signals: unsupported signal %q", name)
+		}
+
+		signals = append(signals, sig)
+	}
+
+	return signals, nil
+}
+
+// dialTimeout returns the configured timeout of a dial attempt or the
+// default one.
+func (c *config) dialTimeout() time.Duration {
+	if c.DialTimeout > 0 {
+		return c.DialTimeout
+	}
+
+	return defaultDialTimeout
+}
+
+// preShutdownHookTimeout returns the configured timeout of the pre-shutdown
+// hook or the default one.
+func (c *config) preShutdownHookTimeout() time.Duration {
+	if c.PreShutdownHookTimeout > 0 {
+		return c.PreShutdownHookTimeout
+	}
+
+	return defaultPreShutdownHookTimeout
+}
+
+// tenantKeys returns encryption keys of all the MAAS installations served
+// by the agent, by MAAS UUID.
+func (c *config) tenantKeys() map[string][]byte {
+	keys := make(map[string][]byte, len(c.Secrets)+1)
+
+	if c.Secret != "" {
+		keys[c.MAASUUID] = []byte(c.Secret)
+	}
+
+	for uuid, secret := range c.Secrets {
+		keys[uuid] = []byte(secret)
+	}
+
+	return keys
+}
+
+// searchAttributeKeys returns search attribute keys with defaults applied
+// for the keys that are not set.
+func (c *config) searchAttributeKeys() worker.SearchAttributeKeys {
+	keys := worker.SearchAttributeKeys{
+		SystemID: defaultSystemIDSearchAttribute,
+		Action:   defaultActionSearchAttribute,
+	}
+
+	if c.SearchAttributes.SystemIDKey != "" {
+		keys.SystemID = c.SearchAttributes.SystemIDKey
+	}
+
+	if c.SearchAttributes.ActionKey != "" {
+		keys.Action = c.SearchAttributes.ActionKey
+	}
+
+	return keys
+}
+
+// newBackOff returns exponential backoff configured with the backoff section.
+// Options that are not set fall back to the library defaults, except
+// MaxElapsedTime which defaults to 60 seconds.
+func (c *config) newBackOff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = defaultBackoffMaxElapsedTime
+
+	if c.Backoff.InitialInterval > 0 {
+		b.InitialInterval = c.Backoff.InitialInterval
+	}
+
+	if c.Backoff.RandomizationFactor != nil {
+		b.RandomizationFactor = *c.Backoff.RandomizationFactor
+	}
+
+	if c.Backoff.Multiplier > 0 {
+		b.Multiplier = c.Backoff.Multiplier
+	}
+
+	if c.Backoff.MaxElapsedTime > 0 {
+		b.MaxElapsedTime = c.Backoff.MaxElapsedTime
+	}
+
+	b.Reset()
+
+	return b
+}
+
+// newRetryBackOff returns backoff of the configured backoff_strategy with
+// intervals of the backoff section. Multiplier and randomization factor are
+// not used by decorrelated jitter.
+func (c *config) newRetryBackOff() backoff.BackOff {
+	b := c.newBackOff()
+	if c.BackoffStrategy != retry.StrategyDecorrelated {
+		return b
+	}
+
+	return retry.NewDecorrelatedJitterBackOff(b.InitialInterval, b.MaxInterval, b.MaxElapsedTime)
+}
+
+// bmcAllowedPrefixes returns parsed power.bmc_allowed_cidrs
+func (c *config) bmcAllowedPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, len(c.Power.BMCAllowedCIDRs))
+
+	for i, cidr := range c.Power.BMCAllowedCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes[i] = prefix.Masked()
+	}
+
+	return prefixes, nil
+}
+
+// secretProvider returns power.SecretProvider configured by
+// power.secret_provider, or nil if it is not configured.
+func (c *config) secretProvider() (power.SecretProvider, error) {
+	p := c.Power.SecretProvider
+
+	switch p.Type {
+	case "":
+		return nil, nil
+	case "file":
+		if p.Dir == "" {
+			return nil, errors.New("dir is required")
+		}
+
+		return power.NewFileSecretProvider(p.Dir), nil
+	case "vault":
+		if p.VaultAddress == "" || p.VaultToken == "" {
+			return nil, errors.New("vault_address and vault_token are required")
+		}
+
+		return power.NewVaultSecretProvider(p.VaultAddress, p.VaultToken, p.VaultMount), nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", p.Type)
+	}
+}
+
+// rpcThrottle returns rpcThrottle configured by the rpc_throttle section.
+// Backoff that is not set falls back to defaults.
+func (c *config) rpcThrottle() *rpcThrottle {
+	minBackoff, maxBackoff := defaultRPCMinBackoff, defaultRPCMaxBackoff
+
+	if c.RPCThrottle.MinBackoff > 0 {
+		minBackoff = c.RPCThrottle.MinBackoff
+	}
+
+	if c.RPCThrottle.MaxBackoff > 0 {
+		maxBackoff = c.RPCThrottle.MaxBackoff
+	}
+
+	return newRPCThrottle(c.RPCThrottle.Rate, c.RPCThrottle.Burst,
+		min(minBackoff, maxBackoff), maxBackoff)
+}
+
+// httpServerLimits returns limits of the HTTP server configured by the
+// http_server section. Limits that are not set fall back to defaults.
+func (c *config) httpServerLimits() httpServerLimits {
+	limits := httpServerLimits{
+		readTimeout:         defaultHTTPReadTimeout,
+		writeTimeout:        defaultHTTPWriteTimeout,
+		maxConnections:      defaultHTTPMaxConnections,
+		maxRequestBodyBytes: defaultHTTPMaxRequestBodyBytes,
+	}
+
+	if c.HTTPServer.ReadTimeout > 0 {
+		limits.readTimeout = c.HTTPServer.ReadTimeout
+	}
+
+	if c.HTTPServer.WriteTimeout > 0 {
+		limits.writeTimeout = c.HTTPServer.WriteTimeout
+	}
+
+	if c.HTTPServer.MaxConnections > 0 {
+		limits.maxConnections = c.HTTPServer.MaxConnections
+	}
+
+	if c.HTTPServer.MaxRequestBodyBytes > 0 {
+		limits.maxRequestBodyBytes = c.HTTPServer.MaxRequestBodyBytes
+	}
+
+	return limits
+}
+
+// connectionOptions returns Temporal client connection options with
+// keepalive configured by the grpc_keepalive section and message size limit
+// set by grpc_max_message_bytes. Options that are not set fall back to
+// defaults.
+func (c *config) connectionOptions() client.ConnectionOptions {
+	opts := client.ConnectionOptions{
+		KeepAliveTime:    defaultGRPCKeepaliveTime,
+		KeepAliveTimeout: defaultGRPCKeepaliveTimeout,
+		MaxPayloadSize:   c.GRPCMaxMessageBytes,
+	}
+
+	if c.GRPCKeepalive.Time > 0 {
+		opts.KeepAliveTime = c.GRPCKeepalive.Time
+	}
+
+	if c.GRPCKeepalive.Timeout > 0 {
+		opts.KeepAliveTimeout = c.GRPCKeepalive.Timeout
+	}
+
+	if c.GRPCKeepalive.PermitWithoutStream != nil {
+		opts.DisableKeepAlivePermitWithoutStream = !*c.GRPCKeepalive.PermitWithoutStream
+	}
+
+	return opts
+}
+
+var (
+	// ErrConfigNotFound is returned when configuration file does not exist
+	ErrConfigNotFound = errors.New("configuration file not found")
+	// ErrConfigMalformed is returned when configuration file cannot be
+	// decompressed, has unresolved environment references or is not valid YAML
+	ErrConfigMalformed = errors.New("malformed configuration")
+)
+
+// configPollInterval is how often presence of the configuration file is
+// checked, while waiting for it
+const configPollInterval = time.Second
+
+// getConfig reads MAAS Agent YAML configuration file
+// NOTE: agent.yaml config is generated by rackd, however this behaviour
+// should be changed when MAAS Agent will be a standalone service, not managed
+// by the Rack Controller. Until then MAAS_AGENT_WAIT_FOR_CONFIG can be set to
+// a duration for which the agent waits for rackd to generate the file.
+func getConfig() (*config, error) {
+	var timeout time.Duration
+
+	if v := os.Getenv("MAAS_AGENT_WAIT_FOR_CONFIG"); v != "" {
+		var err error
+
+		timeout, err = time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("configuration error: MAAS_AGENT_WAIT_FOR_CONFIG: invalid duration %q", v)
+		}
+	}
+
+	return waitForConfig(configFileName(), timeout, configPollInterval)
+}
+
+// waitForConfig loads configuration from fname, waiting up to timeout for
+// the file to appear, if it does not exist yet. Other errors are returned
+// immediately.
+func waitForConfig(fname string, timeout, interval time.Duration) (*config, error) {
+	deadline := time.Now().Add(timeout)
+	logged := false
+
+	for {
+		cfg, err := loadConfig(fname)
+
+		remaining := time.Until(deadline)
+		if !errors.Is(err, ErrConfigNotFound) || remaining <= 0 {
+			return cfg, err
+		}
+
+		if !logged {
+			log.Info().Str("file", fname).Dur("timeout", timeout).
+				Msg("Waiting for configuration file to appear")
+
+			logged = true
+		}
+
+		time.Sleep(min(interval, remaining))
+	}
+}
+
+// configFileName returns path to MAAS Agent YAML configuration file, or
+// http(s) URL it is fetched from
+func configFileName() string {
+	fname := os.Getenv("MAAS_AGENT_CONFIG")
+	if fname == "" {
+		fname = "/etc/maas/agent.yaml"
+	}
+
+	return fname
+}
+
+// loadConfig reads MAAS Agent YAML configuration from the given file
+func loadConfig(fname string) (*config, error) {
+	data, err := readConfigFile(fname)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("configuration error: %w: %w", ErrConfigNotFound, err)
+		}
+
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) || errors.Is(err, errInsecureConfigURL) {
+			return nil, fmt.Errorf("configuration error: %w", err)
+		}
+
+		return nil, fmt.Errorf("configuration error: %w: %w", ErrConfigMalformed, err)
+	}
+
+	return parseConfig(data)
+}
+
+// parseConfig parses MAAS Agent YAML configuration, expanding environment
+// references and applying the selected profile.
+func parseConfig(data []byte) (*config, error) {
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("configuration error: %w: %w", ErrConfigMalformed, err)
+	}
+
+	if err := expandEnvNode(&doc); err != nil {
+		return nil, fmt.Errorf("configuration error: %w: %w", ErrConfigMalformed, err)
+	}
+
+	cfg := &config{}
+
+	if doc.Kind != 0 {
+		if err := doc.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("configuration error: %w: %w", ErrConfigMalformed, err)
+		}
+	}
+
+	if err := cfg.applyProfile(os.Getenv("MAAS_AGENT_PROFILE")); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyProfile decodes the selected profile over the configuration, so
+// fields set by the profile replace the ones set outside of it. Profile name
+// from the environment (if not empty) takes precedence over the one from
+// the configuration.
+func (c *config) applyProfile(override string) error {
+	profiles := c.Profiles
+	c.Profiles = nil
+
+	if override != "" {
+		c.Profile = override
+	}
+
+	if c.Profile == "" {
+		return nil
+	}
+
+	node, ok := profiles[c.Profile]
+	if !ok {
+		return fmt.Errorf("configuration error: profile %q is not defined", c.Profile)
+	}
+
+	selected := c.Profile
+
+	if err := node.Decode(c); err != nil {
+		return fmt.Errorf("configuration error: %w: profile %q: %w",
+			ErrConfigMalformed, selected, err)
+	}
+
+	// Profiles cannot select or define other profiles.
+	c.Profile = selected
+	c.Profiles = nil
+
+	return nil
+}
+
+// envRefRegexp matches ${VAR} and ${VAR:-default} references, and $${
+// escapes of them
+var envRefRegexp = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnvNode expands environment variable references in scalar values of
+// the parsed configuration, see expandEnv. Mapping keys are left as is.
+// Values are expanded after parsing, so they cannot change the structure of
+// the configuration. Untagged plain values are resolved again, so e.g. a port
+// can still be set from a variable. References inside flow collections
+// (e.g. [${VAR}]) have to be quoted to be parsed as values.
+func expandEnvNode(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := expandEnvNode(c); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := expandEnvNode(n.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		value, err := expandEnv(n.Value)
+		if err != nil {
+			return err
+		}
+
+		if value != n.Value {
+			n.Value = value
+
+			if n.Style&yaml.TaggedStyle == 0 {
+				n.Tag = ""
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandEnv replaces ${VAR} and ${VAR:-default} references with values of the
+// environment variables. Default value is used when variable is unset or empty.
+// Reference to unset variable without a default value is an error. $${ is
+// replaced with a literal ${.
+func expandEnv(s string) (string, error) {
+	var err error
+
+	res := envRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+
+		m := envRefRegexp.FindStringSubmatch(ref)
+		name, hasDefault := m[1], len(m[2]) > 0
+
+		value, ok := os.LookupEnv(name)
+		if hasDefault && value == "" {
+			return m[3]
+		}
+
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %q is not set", name)
+		}
+
+		return value
+	})
+
+	return res, err
+}
+
+// readConfigFile returns content of the configuration file. Files compressed
+// with gzip (detected by the magic bytes or a .gz extension) are transparently
+// decompressed.
+func readConfigFile(fname string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if isConfigURL(fname) {
+		data, err = fetchConfig(fname, configCachePath(), func(data []byte) error {
+			return checkFetchedConfig(fname, data)
+		})
+	} else {
+		data, err = os.ReadFile(filepath.Clean(fname))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressConfig(fname, data)
+}
+
+// decompressConfig returns data decompressed, if it is compressed with gzip
+// (detected by the magic bytes or a .gz extension of fname).
+func decompressConfig(fname string, data []byte) ([]byte, error) {
+	if !isGzip(data) && !strings.HasSuffix(fname, ".gz") {
+		return data, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed decompressing %q: %w", fname, err)
+	}
+
+	//nolint:errcheck // nothing to flush on a reader
+	defer r.Close()
+
+	data, err = io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed decompressing %q: %w", fname, err)
+	}
+
+	return data, nil
+}
+
+// isGzip returns true if data starts with the gzip magic bytes.
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// normalizeControllers returns controller hosts extracted from the configured
+// entries, which might be copied from other tooling in a form of
+// grpc://host:5271 or host:5271/. Malformed entries are skipped and reported
+// via the returned errors.
+func normalizeControllers(entries []string) ([]string, []error) {
+	var (
+		hosts []string
+		errs  []error
+	)
+
+	for _, entry := range entries {
+		host, err := normalizeController(entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	return hosts, errs
+}
+
+// uniqueControllers returns hosts with duplicates removed, preserving order
+// of the first occurrences, and a number of removed duplicates.
+func uniqueControllers(hosts []string) ([]string, int) {
+	seen := make(map[string]struct{}, len(hosts))
+	unique := make([]string, 0, len(hosts))
+
+	for _, host := range hosts {
+		key := strings.ToLower(host)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+
+		unique = append(unique, host)
+	}
+
+	return unique, len(hosts) - len(unique)
+}
+
+// normalizeController strips scheme, trailing slashes and port from a
+// controller entry. Port is validated if present, but not used, because
+// Temporal and MAAS internal API ports are fixed.
+func normalizeController(entry string) (string, error) {
+	s := strings.TrimSpace(entry)
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+
+	s = strings.TrimRight(s, "/")
+
+	host := s
+	if h, port, err := net.SplitHostPort(s); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid controller %q: invalid port %q", entry, port)
+		}
+
+		host = h
+	} else {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+
+	if host == "" || strings.ContainsAny(host, "/[] ") ||
+		(strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+		return "", fmt.Errorf("invalid controller %q", entry)
+	}
+
+	return host, nil
+}
+
+// sensitiveKeyRegexp matches configuration keys that hold credentials.
+// Keys naming a section (e.g. secret_provider) are not matched, so the
+// section is walked instead of being redacted as a whole.
+var sensitiveKeyRegexp = regexp.MustCompile(`(?i)(secrets?|password|passwd|tokens?|credentials?|private_key|tls_key)$`)
+
+// redactedConfig returns configuration as a map using the same keys as the
+// configuration file, with values of any credential fields redacted.
+func redactedConfig(c *config) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	redact(m)
+
+	return m, nil
+}
+
+// redact replaces values of sensitive keys, including maps and lists under
+// them (e.g. secrets by MAAS UUID), and walks into other maps and lists.
+func redact(m map[string]interface{}) {
+	for k, v := range m {
+		if sensitiveKeyRegexp.MatchString(k) {
+			if !isEmptyValue(v) {
+				m[k] = "<redacted>"
+			}
+
+			continue
+		}
+
+		redactValue(v)
+	}
+}
+
+func redactValue(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		redact(v)
+	case []interface{}:
+		for _, item := range v {
+			redactValue(item)
+		}
+	}
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+
+	return false
+}
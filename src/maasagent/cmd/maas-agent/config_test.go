@@ -0,0 +1,694 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/client"
+	"gopkg.in/yaml.v3"
+
+	"maas.io/core/src/maasagent/internal/retry"
+	wf "maas.io/core/src/maasagent/internal/workflow"
+	"maas.io/core/src/maasagent/internal/workflow/worker"
+)
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestGetConfig(t *testing.T) {
+	data := []byte("system_id: abcdef\ncontrollers: [10.0.0.1]\n")
+
+	testcases := map[string]struct {
+		name string
+		data []byte
+		err  error
+	}{
+		"plain": {
+			name: "agent.yaml",
+			data: data,
+		},
+		"gzip with extension": {
+			name: "agent.yaml.gz",
+			data: gzipData(t, data),
+		},
+		"gzip without extension": {
+			name: "agent.yaml",
+			data: gzipData(t, data),
+		},
+		"corrupted gzip": {
+			name: "agent.yaml.gz",
+			data: data,
+			err:  ErrConfigMalformed,
+		},
+		"invalid yaml": {
+			name: "agent.yaml",
+			data: []byte("system_id: [abcdef\n"),
+			err:  ErrConfigMalformed,
+		},
+		"unresolved env reference": {
+			name: "agent.yaml",
+			data: []byte("system_id: ${MAAS_AGENT_TEST_UNSET_VAR}\n"),
+			err:  ErrConfigMalformed,
+		},
+		"missing": {
+			name: "agent.yaml",
+			err:  ErrConfigNotFound,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			fname := filepath.Join(t.TempDir(), tc.name)
+			if tc.data != nil {
+				require.NoError(t, os.WriteFile(fname, tc.data, 0600))
+			}
+
+			t.Setenv("MAAS_AGENT_CONFIG", fname)
+
+			cfg, err := getConfig()
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "abcdef", cfg.SystemID)
+			assert.Equal(t, []string{"10.0.0.1"}, cfg.Controllers)
+		})
+	}
+}
+
+func TestWaitForConfig(t *testing.T) {
+	testcases := map[string]struct {
+		timeout time.Duration
+		delay   time.Duration
+		err     error
+	}{
+		"appears in time": {
+			timeout: time.Minute,
+			delay:   20 * time.Millisecond,
+		},
+		"does not appear": {
+			timeout: 50 * time.Millisecond,
+			err:     ErrConfigNotFound,
+		},
+		"no wait": {
+			delay: 20 * time.Millisecond,
+			err:   ErrConfigNotFound,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			fname := filepath.Join(t.TempDir(), "agent.yaml")
+
+			if tc.delay > 0 {
+				tmp := fname + ".tmp"
+				require.NoError(t, os.WriteFile(tmp, []byte("system_id: abcdef\n"), 0600))
+
+				// The file is renamed, so it is never read partially written
+				timer := time.AfterFunc(tc.delay, func() {
+					//nolint:errcheck // checked by the result
+					os.Rename(tmp, fname)
+				})
+				t.Cleanup(func() { timer.Stop() })
+			}
+
+			cfg, err := waitForConfig(fname, tc.timeout, 5*time.Millisecond)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "abcdef", cfg.SystemID)
+		})
+	}
+}
+
+func TestGetConfigInvalidWait(t *testing.T) {
+	t.Setenv("MAAS_AGENT_CONFIG", filepath.Join(t.TempDir(), "agent.yaml"))
+	t.Setenv("MAAS_AGENT_WAIT_FOR_CONFIG", "soon")
+
+	_, err := getConfig()
+	assert.ErrorContains(t, err, "MAAS_AGENT_WAIT_FOR_CONFIG")
+}
+
+func TestExpandEnv(t *testing.T) {
+	testcases := map[string]struct {
+		in  string
+		env map[string]string
+		out string
+		err bool
+	}{
+		"no references": {
+			in:  "secret: abc",
+			out: "secret: abc",
+		},
+		"variable": {
+			in:  "secret: ${MAAS_TEST_SECRET}",
+			env: map[string]string{"MAAS_TEST_SECRET": "abc"},
+			out: "secret: abc",
+		},
+		"default value for unset variable": {
+			in:  "log_level: ${MAAS_TEST_LOG_LEVEL:-info}",
+			out: "log_level: info",
+		},
+		"default value for empty variable": {
+			in:  "log_level: ${MAAS_TEST_LOG_LEVEL:-info}",
+			env: map[string]string{"MAAS_TEST_LOG_LEVEL": ""},
+			out: "log_level: info",
+		},
+		"empty default value": {
+			in:  "log_level: ${MAAS_TEST_LOG_LEVEL:-}",
+			out: "log_level: ",
+		},
+		"multiple references": {
+			in:  "a: ${MAAS_TEST_A}, b: ${MAAS_TEST_B:-b}",
+			env: map[string]string{"MAAS_TEST_A": "a"},
+			out: "a: a, b: b",
+		},
+		"not a reference": {
+			in:  "secret: $MAAS_TEST_SECRET",
+			out: "secret: $MAAS_TEST_SECRET",
+		},
+		"unset variable": {
+			in:  "secret: ${MAAS_TEST_SECRET}",
+			err: true,
+		},
+		"escaped reference": {
+			in:  "secret: $${MAAS_TEST_SECRET}",
+			out: "secret: ${MAAS_TEST_SECRET}",
+		},
+		"escaped and expanded": {
+			in:  "a$${b}${MAAS_TEST_A}",
+			env: map[string]string{"MAAS_TEST_A": "c"},
+			out: "a${b}c",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			res, err := expandEnv(tc.in)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, res)
+		})
+	}
+}
+
+func TestParseConfigExpandEnv(t *testing.T) {
+	t.Setenv("MAAS_TEST_SECRET", "abc\nsystem_id: injected")
+	t.Setenv("MAAS_TEST_CACHE_SIZE", "1024")
+	t.Setenv("MAAS_TEST_CONTROLLER", "10.0.0.1")
+	t.Setenv("MAAS_TEST_NUMBER", "42")
+
+	cfg, err := parseConfig([]byte(`system_id: abcdef
+secret: ${MAAS_TEST_SECRET}
+log_output: "$${LOG_DIR}/agent.log"
+httpproxy:
+  cache_size: ${MAAS_TEST_CACHE_SIZE}
+controllers: ["${MAAS_TEST_CONTROLLER}", 10.0.0.2]
+secrets:
+  ${MAAS_TEST_KEY}: "${MAAS_TEST_NUMBER}"
+`))
+	require.NoError(t, err)
+
+	// Values cannot change the structure of the configuration
+	assert.Equal(t, "abcdef", cfg.SystemID)
+	assert.Equal(t, "abc\nsystem_id: injected", cfg.Secret)
+	assert.Equal(t, "${LOG_DIR}/agent.log", cfg.LogOutput)
+	assert.Equal(t, int64(1024), cfg.HTTPProxy.CacheSize)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, cfg.Controllers)
+	// Keys are not expanded, quoted values stay strings
+	assert.Equal(t, map[string]string{"${MAAS_TEST_KEY}": "42"}, cfg.Secrets)
+}
+
+func TestConfigScheduleToStartTimeout(t *testing.T) {
+	cfg := &config{}
+	cfg.Workflows.ScheduleToStartTimeout = map[string]time.Duration{
+		"configure-power-service": 10 * time.Second,
+		"configure-dhcp-service":  0,
+	}
+
+	testcases := map[string]struct {
+		in  string
+		out time.Duration
+	}{
+		"configured": {
+			in:  "configure-power-service",
+			out: 10 * time.Second,
+		},
+		"zero value": {
+			in:  "configure-dhcp-service",
+			out: wf.DefaultScheduleToStartTimeout,
+		},
+		"not configured": {
+			in:  "configure-httpproxy-service",
+			out: wf.DefaultScheduleToStartTimeout,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			res := cfg.scheduleToStartTimeout(tc.in)
+			assert.Equal(t, tc.out, res)
+		})
+	}
+}
+
+func TestConfigShutdownSignals(t *testing.T) {
+	testcases := map[string]struct {
+		in  []string
+		out []os.Signal
+		err string
+	}{
+		"default": {
+			out: []os.Signal{syscall.SIGTERM, syscall.SIGINT},
+		},
+		"names with and without prefix": {
+			in:  []string{"QUIT", "sigterm"},
+			out: []os.Signal{syscall.SIGQUIT, syscall.SIGTERM},
+		},
+		"unknown signal": {
+			in:  []string{"TERM", "STOP"},
+			err: `shutdown_signals: unsupported signal "STOP"`,
+		},
+		"reload signal": {
+			in:  []string{"HUP"},
+			err: `shutdown_signals: unsupported signal "HUP"`,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config{ShutdownSignals: tc.in}
+
+			res, err := cfg.shutdownSignals()
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, res)
+		})
+	}
+}
+
+func TestConfigSearchAttributeKeys(t *testing.T) {
+	testcases := map[string]struct {
+		in  string
+		out worker.SearchAttributeKeys
+	}{
+		"defaults": {
+			in: "search_attributes: {enabled: true}",
+			out: worker.SearchAttributeKeys{
+				SystemID: "MAASSystemID",
+				Action:   "MAASAction",
+			},
+		},
+		"custom keys": {
+			in: "search_attributes: {system_id_key: RackID, action_key: Operation}",
+			out: worker.SearchAttributeKeys{
+				SystemID: "RackID",
+				Action:   "Operation",
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config{}
+			require.NoError(t, yaml.Unmarshal([]byte(tc.in), cfg))
+			assert.Equal(t, tc.out, cfg.searchAttributeKeys())
+		})
+	}
+}
+
+func TestConfigNewBackOff(t *testing.T) {
+	testcases := map[string]struct {
+		in  string
+		out func(*backoff.ExponentialBackOff)
+	}{
+		"defaults": {
+			in: "",
+			out: func(b *backoff.ExponentialBackOff) {
+				b.MaxElapsedTime = 60 * time.Second
+			},
+		},
+		"custom": {
+			in: `
+backoff:
+  initial_interval: 1s
+  randomization_factor: 0.2
+  multiplier: 2
+  max_elapsed_time: 5m
+`,
+			out: func(b *backoff.ExponentialBackOff) {
+				b.InitialInterval = time.Second
+				b.RandomizationFactor = 0.2
+				b.Multiplier = 2
+				b.MaxElapsedTime = 5 * time.Minute
+			},
+		},
+		"no randomization": {
+			in: "backoff: {randomization_factor: 0}",
+			out: func(b *backoff.ExponentialBackOff) {
+				b.RandomizationFactor = 0
+				b.MaxElapsedTime = 60 * time.Second
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config{}
+			require.NoError(t, yaml.Unmarshal([]byte(tc.in), cfg))
+
+			expected := backoff.NewExponentialBackOff()
+			tc.out(expected)
+
+			res := cfg.newBackOff()
+
+			assert.Equal(t, expected.InitialInterval, res.InitialInterval)
+			assert.Equal(t, expected.RandomizationFactor, res.RandomizationFactor)
+			assert.Equal(t, expected.Multiplier, res.Multiplier)
+			assert.Equal(t, expected.MaxInterval, res.MaxInterval)
+			assert.Equal(t, expected.MaxElapsedTime, res.MaxElapsedTime)
+		})
+	}
+}
+
+func TestConfigNewRetryBackOff(t *testing.T) {
+	cfg := &config{}
+	cfg.Backoff.InitialInterval = time.Second
+
+	_, ok := cfg.newRetryBackOff().(*backoff.ExponentialBackOff)
+	assert.True(t, ok)
+
+	cfg.BackoffStrategy = retry.StrategyDecorrelated
+
+	b, ok := cfg.newRetryBackOff().(*retry.DecorrelatedJitterBackOff)
+	require.True(t, ok)
+	assert.Equal(t, time.Second, b.InitialInterval)
+	assert.Equal(t, backoff.DefaultMaxInterval, b.MaxInterval)
+	assert.Equal(t, defaultBackoffMaxElapsedTime, b.MaxElapsedTime)
+}
+
+func TestConfigConnectionOptions(t *testing.T) {
+	testcases := map[string]struct {
+		in  string
+		out client.ConnectionOptions
+	}{
+		"defaults": {
+			in: "",
+			out: client.ConnectionOptions{
+				KeepAliveTime:    30 * time.Second,
+				KeepAliveTimeout: 15 * time.Second,
+			},
+		},
+		"custom": {
+			in: `
+grpc_keepalive:
+  time: 1m
+  timeout: 20s
+  permit_without_stream: false
+grpc_max_message_bytes: 268435456
+`,
+			out: client.ConnectionOptions{
+				KeepAliveTime:                       time.Minute,
+				KeepAliveTimeout:                    20 * time.Second,
+				DisableKeepAlivePermitWithoutStream: true,
+				MaxPayloadSize:                      256 * 1024 * 1024,
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config{}
+			require.NoError(t, yaml.Unmarshal([]byte(tc.in), cfg))
+
+			assert.Equal(t, tc.out, cfg.connectionOptions())
+		})
+	}
+}
+
+func TestConfigHTTPServerLimits(t *testing.T) {
+	testcases := map[string]struct {
+		in  string
+		out httpServerLimits
+	}{
+		"defaults": {
+			in: "",
+			out: httpServerLimits{
+				readTimeout:         30 * time.Second,
+				writeTimeout:        60 * time.Second,
+				maxConnections:      16,
+				maxRequestBodyBytes: 1024 * 1024,
+			},
+		},
+		"custom": {
+			in: `
+http_server:
+  read_timeout: 5s
+  write_timeout: 10s
+  max_connections: 4
+  max_request_body_bytes: 4096
+`,
+			out: httpServerLimits{
+				readTimeout:         5 * time.Second,
+				writeTimeout:        10 * time.Second,
+				maxConnections:      4,
+				maxRequestBodyBytes: 4096,
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config{}
+			require.NoError(t, yaml.Unmarshal([]byte(tc.in), cfg))
+
+			assert.Equal(t, tc.out, cfg.httpServerLimits())
+		})
+	}
+}
+
+func TestNormalizeControllers(t *testing.T) {
+	testcases := map[string]struct {
+		in   []string
+		out  []string
+		errs int
+	}{
+		"host": {
+			in:  []string{"10.0.0.1", "maas.internal"},
+			out: []string{"10.0.0.1", "maas.internal"},
+		},
+		"scheme and port": {
+			in:  []string{"grpc://10.0.0.1:5271"},
+			out: []string{"10.0.0.1"},
+		},
+		"trailing slashes": {
+			in:  []string{"10.0.0.1:5271/", "https://maas.internal//"},
+			out: []string{"10.0.0.1", "maas.internal"},
+		},
+		"ipv6": {
+			in:  []string{"[fd00::1]:5271", "[fd00::2]", "fd00::3"},
+			out: []string{"fd00::1", "fd00::2", "fd00::3"},
+		},
+		"malformed entries are skipped": {
+			in:   []string{"10.0.0.1:abc", "grpc://", "10.0.0.2/path", "10.0.0.3"},
+			out:  []string{"10.0.0.3"},
+			errs: 3,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out, errs := normalizeControllers(tc.in)
+			assert.Equal(t, tc.out, out)
+			assert.Len(t, errs, tc.errs)
+		})
+	}
+}
+
+func TestUniqueControllers(t *testing.T) {
+	testcases := map[string]struct {
+		in         []string
+		out        []string
+		duplicates int
+	}{
+		"no duplicates": {
+			in:  []string{"10.0.0.1", "10.0.0.2"},
+			out: []string{"10.0.0.1", "10.0.0.2"},
+		},
+		"order is preserved": {
+			in:         []string{"10.0.0.2", "10.0.0.1", "10.0.0.2", "10.0.0.1"},
+			out:        []string{"10.0.0.2", "10.0.0.1"},
+			duplicates: 2,
+		},
+		"hostnames are case insensitive": {
+			in:         []string{"maas.internal", "MAAS.internal"},
+			out:        []string{"maas.internal"},
+			duplicates: 1,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out, duplicates := uniqueControllers(tc.in)
+			assert.Equal(t, tc.out, out)
+			assert.Equal(t, tc.duplicates, duplicates)
+		})
+	}
+}
+
+func TestConfigProfiles(t *testing.T) {
+	data := `system_id: abcdef
+controllers: [10.0.0.1]
+log_level: info
+profile: staging
+worker_pool:
+  drain_timeout: 30s
+  partial_start_ok: true
+profiles:
+  staging:
+    log_level: debug
+  prod:
+    controllers: [10.0.1.1, 10.0.1.2]
+    worker_pool:
+      drain_timeout: 2m
+`
+
+	testcases := map[string]struct {
+		env          string
+		logLevel     string
+		controllers  []string
+		drainTimeout time.Duration
+		err          string
+	}{
+		"selected in file": {
+			logLevel:     "debug",
+			controllers:  []string{"10.0.0.1"},
+			drainTimeout: 30 * time.Second,
+		},
+		"selected in environment": {
+			env:          "prod",
+			logLevel:     "info",
+			controllers:  []string{"10.0.1.1", "10.0.1.2"},
+			drainTimeout: 2 * time.Minute,
+		},
+		"unknown": {
+			env: "dev",
+			err: `profile "dev" is not defined`,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			fname := filepath.Join(t.TempDir(), "agent.yaml")
+			require.NoError(t, os.WriteFile(fname, []byte(data), 0600))
+
+			t.Setenv("MAAS_AGENT_PROFILE", tc.env)
+
+			cfg, err := loadConfig(fname)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.logLevel, cfg.LogLevel)
+			assert.Equal(t, tc.controllers, cfg.Controllers)
+			assert.Equal(t, tc.drainTimeout, cfg.WorkerPool.DrainTimeout)
+			// Fields not set by the profile are kept
+			assert.True(t, cfg.WorkerPool.PartialStartOK)
+			assert.Nil(t, cfg.Profiles)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.temporal.io/sdk/client"
+)
+
+const (
+	defaultConnectionCheckInterval = 10 * time.Second
+	defaultConnectionCheckTimeout  = 5 * time.Second
+)
+
+// connectionMonitor periodically checks health of the Temporal connection
+// and reports transitions between connected and disconnected states.
+type connectionMonitor struct {
+	client     client.Client
+	reconnects metric.Int64Counter
+	endpoint   string
+	interval   time.Duration
+	connected  atomic.Bool
+	// epoch is incremented every time the connection is restored
+	epoch atomic.Int64
+	// since is UnixNano time of the last transition
+	since atomic.Int64
+}
+
+// connectionStatus is returned by /admin/status endpoint
+type connectionStatus struct {
+	// Controller is Temporal endpoint of the controller the agent uses
+	Controller string `json:"controller"`
+	Connected  bool   `json:"connected"`
+	// Epoch is a number of times connection was restored
+	Epoch int64 `json:"epoch"`
+	// Since is when the agent connected or lost connection
+	Since time.Time `json:"since"`
+	// DurationSeconds is for how long the agent is (dis)connected
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// newConnectionMonitor returns connectionMonitor for a client connected to
+// endpoint. Connection state is exposed as temporal.connected gauge (1 or 0)
+// labelled with the controller, time since the current connection was
+// established as temporal.connection.duration gauge, and number of
+// reconnections as temporal.reconnects counter.
+func newConnectionMonitor(c client.Client, endpoint string,
+	meter metric.Meter) *connectionMonitor {
+	m := &connectionMonitor{
+		client:   c,
+		endpoint: endpoint,
+		interval: defaultConnectionCheckInterval,
+	}
+
+	m.connected.Store(true)
+	m.since.Store(time.Now().UnixNano())
+
+	controller := metric.WithAttributes(attribute.String("controller", endpoint))
+
+	m.reconnects = must(meter.Int64Counter("temporal.reconnects",
+		metric.WithDescription("Number of times connection to Temporal was restored"),
+		metric.WithUnit("{count}"),
+	))
+
+	must(meter.Int64ObservableGauge("temporal.connected",
+		metric.WithDescription("Whether Temporal server is reachable (1) or not (0)"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			var v int64
+			if m.connected.Load() {
+				v = 1
+			}
+
+			o.Observe(v, controller)
+
+			return nil
+		})))
+
+	must(meter.Int64ObservableGauge("temporal.connection.duration",
+		metric.WithDescription("Time since connection to Temporal was established, 0 if disconnected"),
+		metric.WithUnit("s"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			status := m.status()
+
+			var v int64
+			if status.Connected {
+				v = int64(status.DurationSeconds)
+			}
+
+			o.Observe(v, controller)
+
+			return nil
+		})))
+
+	return m
+}
+
+// status returns the current state of the connection
+func (m *connectionMonitor) status() connectionStatus {
+	since := time.Unix(0, m.since.Load())
+
+	return connectionStatus{
+		Controller:      m.endpoint,
+		Connected:       m.connected.Load(),
+		Epoch:           m.epoch.Load(),
+		Since:           since,
+		DurationSeconds: time.Since(since).Seconds(),
+	}
+}
+
+// run checks the connection until ctx is cancelled
+func (m *connectionMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.check(ctx)
+		}
+	}
+}
+
+// check updates connection state and reports a transition, if any.
+func (m *connectionMonitor) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, defaultConnectionCheckTimeout)
+	defer cancel()
+
+	_, err := m.client.CheckHealth(ctx, &client.CheckHealthRequest{})
+	connected := err == nil
+
+	if m.connected.Swap(connected) == connected {
+		return
+	}
+
+	m.since.Store(time.Now().UnixNano())
+
+	if connected {
+		m.epoch.Add(1)
+		m.reconnects.Add(ctx, 1)
+		log.Info().Str("endpoint", m.endpoint).Msg("Temporal connection restored")
+
+		return
+	}
+
+	log.Warn().Err(err).Str("endpoint", m.endpoint).Msg("Temporal connection lost")
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
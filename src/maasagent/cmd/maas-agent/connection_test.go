@@ -0,0 +1,91 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+)
+
+func TestConnectionMonitor(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+
+	c := &mocks.Client{}
+	for _, err := range []error{nil, errUnavailable, errUnavailable, nil, errUnavailable} {
+		c.On("CheckHealth", mock.Anything, mock.Anything).
+			Return(&client.CheckHealthResponse{}, err).Once()
+	}
+
+	reader := metric.NewManualReader()
+	m := newConnectionMonitor(c, "10.0.0.1:5271",
+		metric.NewMeterProvider(metric.WithReader(reader)).Meter("temporal"))
+
+	expected := []struct {
+		connected  int64
+		reconnects int64
+	}{
+		{connected: 1, reconnects: 0},
+		{connected: 0, reconnects: 0},
+		{connected: 0, reconnects: 0},
+		{connected: 1, reconnects: 1},
+		{connected: 0, reconnects: 1},
+	}
+
+	controller := attribute.NewSet(attribute.String("controller", "10.0.0.1:5271"))
+
+	ctx := context.Background()
+
+	for _, want := range expected {
+		m.check(ctx)
+
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(ctx, &rm))
+
+		values := map[string]int64{}
+
+		for _, sm := range rm.ScopeMetrics {
+			for _, metrics := range sm.Metrics {
+				switch data := metrics.Data.(type) {
+				case metricdata.Gauge[int64]:
+					assert.Equal(t, controller, data.DataPoints[0].Attributes)
+					values[metrics.Name] = data.DataPoints[0].Value
+				case metricdata.Sum[int64]:
+					values[metrics.Name] = data.DataPoints[0].Value
+				}
+			}
+		}
+
+		assert.Equal(t, want.connected, values["temporal.connected"])
+		assert.Equal(t, want.reconnects, values["temporal.reconnects"])
+
+		status := m.status()
+		assert.Equal(t, "10.0.0.1:5271", status.Controller)
+		assert.Equal(t, want.connected == 1, status.Connected)
+		assert.Equal(t, want.reconnects, status.Epoch)
+	}
+
+	c.AssertExpectations(t)
+}
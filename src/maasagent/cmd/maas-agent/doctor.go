@@ -0,0 +1,180 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"maas.io/core/src/maasagent/internal/power"
+)
+
+// doctorCheck is a single check of the environment run by Doctor
+type doctorCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Doctor checks that the environment MAAS Agent runs in is sane, without
+// starting the agent, prints a result of every check and returns exit code.
+// Path to the configuration file is taken from args, otherwise the same file
+// as for MAAS Agent is used.
+//
+// Usage: maas-agent doctor [path]
+func Doctor(w io.Writer, args []string) int {
+	var (
+		cfg *config
+		err error
+	)
+
+	switch len(args) {
+	case 0:
+		cfg, err = getConfig()
+	case 1:
+		cfg, err = loadConfig(args[0])
+	default:
+		fmt.Fprintln(w, "Usage: maas-agent doctor [path]")
+		return 2
+	}
+
+	if err == nil {
+		err = cfg.validate()
+	}
+
+	// Other checks depend on configuration, so there is no point running them.
+	if err != nil {
+		return runDoctorChecks(context.Background(), w, []doctorCheck{
+			{name: "config", run: func(context.Context) error { return err }},
+		})
+	}
+
+	return runDoctorChecks(context.Background(), w, doctorChecks(cfg))
+}
+
+// doctorChecks returns checks of the environment configured by cfg.
+func doctorChecks(cfg *config) []doctorCheck {
+	checks := []doctorCheck{
+		{name: "config", run: func(context.Context) error { return nil }},
+		{name: "codec", run: func(context.Context) error { return selfTestPayloadCodecs(cfg) }},
+	}
+
+	controllers, _ := normalizeControllers(cfg.Controllers)
+	controllers, _ = uniqueControllers(controllers)
+
+	for _, controller := range controllers {
+		controller := controller
+
+		checks = append(checks, doctorCheck{
+			name: "controller " + controller,
+			run: func(ctx context.Context) error {
+				return checkControllerReachable(ctx, cfg, controller)
+			},
+		})
+	}
+
+	checks = append(checks, doctorCheck{
+		name: "admin socket",
+		run:  func(context.Context) error { return checkSocketBindable(getRunDir()) },
+	}, doctorCheck{
+		name: "power cli",
+		run: func(context.Context) error {
+			_, err := power.LookPowerCLI()
+			return err
+		},
+	})
+
+	names := make([]string, 0, len(cfg.Power.ExecCommands))
+	for name := range cfg.Power.ExecCommands {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		executable := strings.Fields(cfg.Power.ExecCommands[name])[0]
+
+		checks = append(checks, doctorCheck{
+			name: "exec command " + name,
+			run: func(context.Context) error {
+				_, err := exec.LookPath(executable)
+				return err
+			},
+		})
+	}
+
+	return checks
+}
+
+// runDoctorChecks runs checks in order, prints a table with their results and
+// returns non-zero exit code if any of them failed.
+func runDoctorChecks(ctx context.Context, w io.Writer, checks []doctorCheck) int {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tRESULT\tDETAILS")
+
+	code := 0
+
+	for _, check := range checks {
+		result, details := "pass", ""
+
+		if err := check.run(ctx); err != nil {
+			result, details, code = "FAIL", err.Error(), 1
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", check.name, result, details)
+	}
+
+	//nolint:errcheck // nothing else can be done if the output is broken
+	tw.Flush()
+
+	return code
+}
+
+// checkControllerReachable resolves controller and connects to its Temporal
+// port, within the configured dial timeout.
+func checkControllerReachable(ctx context.Context, cfg *config, controller string) error {
+	dialer := net.Dialer{
+		Timeout:  cfg.dialTimeout(),
+		Resolver: newResolver(cfg.DNSServer),
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp",
+		net.JoinHostPort(controller, strconv.Itoa(defaultTemporalPort)))
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// checkSocketBindable ensures a Unix socket can be created in dir, where the
+// agent creates its HTTP socket. The socket of a running agent is left alone.
+func checkSocketBindable(dir string) error {
+	listener, err := net.Listen("unix", path.Join(dir, fmt.Sprintf("agent-doctor-%d.sock", os.Getpid())))
+	if err != nil {
+		return err
+	}
+
+	return listener.Close()
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDoctorChecks(t *testing.T) {
+	pass := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("boom") }
+
+	testcases := map[string]struct {
+		checks []doctorCheck
+		code   int
+		out    []string
+	}{
+		"all pass": {
+			checks: []doctorCheck{{name: "config", run: pass}, {name: "codec", run: pass}},
+			out: []string{
+				"CHECK   RESULT  DETAILS",
+				"config  pass",
+				"codec   pass",
+			},
+		},
+		"failure": {
+			checks: []doctorCheck{{name: "config", run: pass}, {name: "power cli", run: fail}},
+			code:   1,
+			out: []string{
+				"config     pass",
+				"power cli  FAIL    boom",
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+
+			assert.Equal(t, tc.code, runDoctorChecks(context.Background(), &out, tc.checks))
+
+			for _, s := range tc.out {
+				assert.Contains(t, out.String(), s)
+			}
+		})
+	}
+}
+
+func TestDoctorInvalidConfig(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(fname, []byte("secret: 0123456789abcdef\n"), 0600))
+
+	var out bytes.Buffer
+
+	assert.Equal(t, 1, Doctor(&out, []string{fname}))
+
+	// Only configuration is checked, when it is not valid
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "system_id is required")
+}
+
+func TestDoctorChecks(t *testing.T) {
+	cfg := &config{
+		Controllers: []string{"10.0.0.1", "grpc://10.0.0.1:5271", "10.0.0.2"},
+	}
+	cfg.Power.ExecCommands = map[string]string{
+		"pdu": "/usr/bin/pdu {action}",
+		"bmc": "/usr/bin/bmc {action}",
+	}
+
+	var names []string
+	for _, check := range doctorChecks(cfg) {
+		names = append(names, check.name)
+	}
+
+	assert.Equal(t, []string{
+		"config",
+		"codec",
+		"controller 10.0.0.1",
+		"controller 10.0.0.2",
+		"admin socket",
+		"power cli",
+		"exec command bmc",
+		"exec command pdu",
+	}, names)
+}
+
+func TestCheckSocketBindable(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, checkSocketBindable(dir))
+
+	// The socket is removed after the check
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.Error(t, checkSocketBindable(filepath.Join(dir, "missing")))
+}
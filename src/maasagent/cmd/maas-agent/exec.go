@@ -0,0 +1,188 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"go.temporal.io/sdk/client"
+	temporalotel "go.temporal.io/sdk/contrib/opentelemetry"
+)
+
+const (
+	defaultExecTaskQueue = "region"
+	defaultExecTimeout   = 60 * time.Second
+)
+
+// workflowExecutor is the part of Temporal client used by Exec
+type workflowExecutor interface {
+	ExecuteWorkflow(ctx context.Context, options client.StartWorkflowOptions,
+		workflow interface{}, args ...interface{}) (client.WorkflowRun, error)
+}
+
+// execRequest is a workflow to be executed by Exec
+type execRequest struct {
+	workflow  string
+	taskQueue string
+	input     json.RawMessage
+	timeout   time.Duration
+}
+
+// Exec executes a single workflow using configuration and payload codecs of
+// MAAS Agent, prints its result and returns exit code. It is meant for
+// diagnostics on the agent host, so only workflows listed in
+// admin.allowed_workflows can be executed.
+//
+// Usage: maas-agent exec <workflow> [--input JSON] [--task-queue QUEUE] [--timeout DURATION]
+func Exec(w io.Writer, args []string) int {
+	req, err := parseExecArgs(w, args)
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(w, err)
+		}
+
+		return 2
+	}
+
+	cfg, err := getConfig()
+	if err == nil {
+		err = cfg.validate()
+	}
+
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	if !slices.Contains(cfg.Admin.AllowedWorkflows, req.workflow) {
+		fmt.Fprintf(w, "workflow %q is not allowed, see admin.allowed_workflows\n", req.workflow)
+		return 1
+	}
+
+	cert, ca, err := getClusterCert()
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	c, _, err := getTemporalClient(cfg, cert, ca,
+		temporalotel.NewMetricsHandler(temporalotel.MetricsHandlerOptions{
+			Meter: metricnoop.NewMeterProvider().Meter("temporal"),
+		}),
+		tracenoop.NewTracerProvider().Tracer("temporal"),
+		nil,
+	)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	defer c.Close()
+
+	if err := execWorkflow(context.Background(), w, c, cfg, req); err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	return 0
+}
+
+// parseExecArgs parses arguments of Exec, the workflow name comes first.
+func parseExecArgs(w io.Writer, args []string) (execRequest, error) {
+	req := execRequest{}
+
+	fs := flag.NewFlagSet("exec", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.Usage = func() {
+		fmt.Fprintln(w, "Usage: maas-agent exec <workflow> [--input JSON] "+
+			"[--task-queue QUEUE] [--timeout DURATION]")
+		fs.PrintDefaults()
+	}
+
+	input := fs.String("input", "", "workflow input as JSON")
+	fs.StringVar(&req.taskQueue, "task-queue", defaultExecTaskQueue, "task queue of the workflow")
+	fs.DurationVar(&req.timeout, "timeout", defaultExecTimeout, "workflow execution timeout")
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fs.Usage()
+		return req, flag.ErrHelp
+	}
+
+	req.workflow = args[0]
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return req, err
+	}
+
+	if fs.NArg() > 0 {
+		return req, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if *input != "" {
+		if !json.Valid([]byte(*input)) {
+			return req, errors.New("input is not valid JSON")
+		}
+
+		req.input = json.RawMessage(*input)
+	}
+
+	return req, nil
+}
+
+// execWorkflow executes the requested workflow and writes its result to w.
+func execWorkflow(ctx context.Context, w io.Writer, c workflowExecutor, cfg *config,
+	req execRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, req.timeout)
+	defer cancel()
+
+	options := client.StartWorkflowOptions{
+		ID: fmt.Sprintf("exec:%s:%s:%d", req.workflow, cfg.SystemID,
+			time.Now().UnixNano()),
+		TaskQueue:                req.taskQueue,
+		WorkflowExecutionTimeout: req.timeout,
+		WorkflowTaskTimeout:      cfg.Workflows.WorkflowTaskTimeout,
+	}
+
+	var args []interface{}
+	if len(req.input) > 0 {
+		args = append(args, req.input)
+	}
+
+	run, err := c.ExecuteWorkflow(ctx, options, req.workflow, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute %s workflow: %w", req.workflow, err)
+	}
+
+	var res interface{}
+	if err := run.Get(ctx, &res); err != nil {
+		return fmt.Errorf("workflow %s (run %s) failed: %w", run.GetID(), run.GetRunID(), err)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(res)
+}
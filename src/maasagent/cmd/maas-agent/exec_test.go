@@ -0,0 +1,160 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+)
+
+func TestParseExecArgs(t *testing.T) {
+	testcases := map[string]struct {
+		args []string
+		req  execRequest
+		err  bool
+	}{
+		"defaults": {
+			args: []string{"power-query"},
+			req: execRequest{
+				workflow:  "power-query",
+				taskQueue: defaultExecTaskQueue,
+				timeout:   defaultExecTimeout,
+			},
+		},
+		"all flags": {
+			args: []string{"power-query", "--input", `{"system_id": "abcdef"}`,
+				"--task-queue", "abcdef@power", "--timeout", "10s"},
+			req: execRequest{
+				workflow:  "power-query",
+				taskQueue: "abcdef@power",
+				input:     json.RawMessage(`{"system_id": "abcdef"}`),
+				timeout:   10 * time.Second,
+			},
+		},
+		"no workflow":     {args: []string{}, err: true},
+		"flag first":      {args: []string{"--input", "{}", "power-query"}, err: true},
+		"invalid input":   {args: []string{"power-query", "--input", "{"}, err: true},
+		"extra arguments": {args: []string{"power-query", "power-on"}, err: true},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+
+			req, err := parseExecArgs(&out, tc.args)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.req, req)
+		})
+	}
+}
+
+func TestExecWorkflow(t *testing.T) {
+	errFailed := errors.New("workflow failed")
+
+	testcases := map[string]struct {
+		input json.RawMessage
+		args  []interface{}
+		err   error
+		out   string
+	}{
+		"with input": {
+			input: json.RawMessage(`{"system_id": "abcdef"}`),
+			args:  []interface{}{json.RawMessage(`{"system_id": "abcdef"}`)},
+			out:   "{\n  \"state\": \"on\"\n}\n",
+		},
+		"without input": {
+			out: "{\n  \"state\": \"on\"\n}\n",
+		},
+		"failure": {
+			err: errFailed,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			run := &mocks.WorkflowRun{}
+			run.On("GetID").Return("exec")
+			run.On("GetRunID").Return("1")
+			run.On("Get", mock.Anything, mock.Anything).Return(tc.err).Run(func(args mock.Arguments) {
+				//nolint:forcetypeassert // the test passes a pointer
+				*args.Get(1).(*interface{}) = map[string]interface{}{"state": "on"}
+			})
+
+			options := mock.MatchedBy(func(o client.StartWorkflowOptions) bool {
+				return o.TaskQueue == "region" && o.WorkflowExecutionTimeout == time.Minute
+			})
+
+			c := &mocks.Client{}
+			c.On("ExecuteWorkflow", append([]interface{}{mock.Anything, options, "power-query"},
+				tc.args...)...).Return(run, nil)
+
+			var out bytes.Buffer
+
+			err := execWorkflow(context.Background(), &out, c, &config{SystemID: "abcdef"},
+				execRequest{
+					workflow:  "power-query",
+					taskQueue: "region",
+					input:     tc.input,
+					timeout:   time.Minute,
+				})
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, out.String())
+		})
+	}
+}
+
+func TestExecNotAllowed(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(fname, []byte("system_id: abcdef\nsecret: 0123456789abcdef\n"+
+		"controllers: [10.0.0.1]\nadmin: {allowed_workflows: [power-query]}\n"), 0600))
+
+	t.Setenv("MAAS_AGENT_CONFIG", fname)
+
+	var out bytes.Buffer
+
+	assert.Equal(t, 1, Exec(&out, []string{"deploy"}))
+	assert.Contains(t, out.String(), `workflow "deploy" is not allowed`)
+}
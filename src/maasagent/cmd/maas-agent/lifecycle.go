@@ -0,0 +1,189 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/netutil"
+)
+
+// httpShutdownTimeout is time given to HTTP requests in progress to complete
+// on shutdown
+const httpShutdownTimeout = 5 * time.Second
+
+// component is a part of MAAS Agent that is started and stopped by lifecycle.
+type component interface {
+	Start() error
+	// Stop stops the component. ctx can be used to abandon the stop.
+	Stop(ctx context.Context) error
+}
+
+// componentFuncs is an adapter to use functions as a component.
+// Any of the functions can be nil.
+type componentFuncs struct {
+	start func() error
+	stop  func(ctx context.Context) error
+}
+
+func (c componentFuncs) Start() error {
+	if c.start == nil {
+		return nil
+	}
+
+	return c.start()
+}
+
+func (c componentFuncs) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+
+	return c.stop(ctx)
+}
+
+type namedComponent struct {
+	component
+	name string
+}
+
+// lifecycle starts components and stops them in the reverse order, so
+// a component is never stopped before components that depend on it, e.g.
+// workers are drained before Temporal client is closed, and HTTP server
+// (reporting health) is the last one to go.
+type lifecycle struct {
+	started []namedComponent
+}
+
+// start starts the component and registers it to be stopped by stop.
+// Component that failed to start is not registered.
+func (l *lifecycle) start(name string, c component) error {
+	if err := c.Start(); err != nil {
+		return fmt.Errorf("failed starting %s: %w", name, err)
+	}
+
+	l.started = append(l.started, namedComponent{component: c, name: name})
+
+	return nil
+}
+
+// stop stops started components in the reverse order of their start.
+// All the components are stopped, even if some of them fail to stop.
+func (l *lifecycle) stop(ctx context.Context) error {
+	var errs []error
+
+	for i := len(l.started) - 1; i >= 0; i-- {
+		c := l.started[i]
+
+		log.Debug().Str("component", c.name).Msg("Stopping component")
+
+		if err := c.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed stopping %s: %w", c.name, err))
+		}
+	}
+
+	l.started = nil
+
+	return errors.Join(errs...)
+}
+
+// httpServerLimits protect the HTTP server from misbehaving clients
+type httpServerLimits struct {
+	readTimeout         time.Duration
+	writeTimeout        time.Duration
+	maxConnections      int
+	maxRequestBodyBytes int64
+}
+
+// httpServer is a component serving mux on a unix socket in the run directory.
+type httpServer struct {
+	server         *http.Server
+	maxConnections int
+	// fatal receives errors of the server after it has started
+	fatal chan<- error
+}
+
+func newHTTPServer(mux *http.ServeMux, limits httpServerLimits,
+	fatal chan<- error) *httpServer {
+	return &httpServer{
+		server: &http.Server{
+			Handler:           limitRequestBody(mux, limits.maxRequestBodyBytes),
+			ReadHeaderTimeout: limits.readTimeout,
+			ReadTimeout:       limits.readTimeout,
+			WriteTimeout:      limits.writeTimeout,
+		},
+		maxConnections: limits.maxConnections,
+		fatal:          fatal,
+	}
+}
+
+// limitRequestBody returns handler that fails reading of request bodies
+// larger than n bytes.
+func limitRequestBody(h http.Handler, n int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *httpServer) Start() error {
+	socketPath := path.Join(getRunDir(), "agent-http.sock")
+
+	if err := syscall.Unlink(socketPath); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+
+	//nolint:gosec // we know what we are doing here and we need 0660
+	if err := os.Chmod(socketPath, 0660); err != nil {
+		//nolint:errcheck // chmod error is more relevant
+		listener.Close()
+		return err
+	}
+
+	// Connections beyond the limit wait to be accepted.
+	listener = netutil.LimitListener(listener, s.maxConnections)
+
+	go func() {
+		if err := s.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			s.fatal <- err
+		}
+	}()
+
+	return nil
+}
+
+func (s *httpServer) Stop(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, httpShutdownTimeout)
+	defer cancel()
+
+	return s.server.Shutdown(ctx)
+}
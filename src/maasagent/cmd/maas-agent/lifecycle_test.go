@@ -0,0 +1,139 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	testcases := map[string]struct {
+		startErr map[string]error
+		stopErr  map[string]error
+		calls    []string
+		err      string
+	}{
+		"reverse order": {
+			calls: []string{
+				"start http", "start client", "start pool",
+				"stop pool", "stop client", "stop http",
+			},
+		},
+		"start failure": {
+			startErr: map[string]error{"pool": errors.New("boom")},
+			calls: []string{
+				"start http", "start client", "start pool",
+				"stop client", "stop http",
+			},
+		},
+		"stop failure": {
+			stopErr: map[string]error{"client": errors.New("boom")},
+			calls: []string{
+				"start http", "start client", "start pool",
+				"stop pool", "stop client", "stop http",
+			},
+			err: "failed stopping client: boom",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				lc    lifecycle
+				calls []string
+			)
+
+			for _, name := range []string{"http", "client", "pool"} {
+				name := name
+
+				err := lc.start(name, componentFuncs{
+					start: func() error {
+						calls = append(calls, "start "+name)
+						return tc.startErr[name]
+					},
+					stop: func(context.Context) error {
+						calls = append(calls, "stop "+name)
+						return tc.stopErr[name]
+					},
+				})
+				if err != nil {
+					break
+				}
+			}
+
+			err := lc.stop(context.Background())
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.calls, calls)
+
+			// Components are stopped once
+			assert.NoError(t, lc.stop(context.Background()))
+			assert.Equal(t, tc.calls, calls)
+		})
+	}
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	h := limitRequestBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}), 8)
+
+	testcases := map[string]struct {
+		body   string
+		status int
+	}{
+		"within limit": {
+			body:   "12345678",
+			status: http.StatusOK,
+		},
+		"above limit": {
+			body:   "123456789",
+			status: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/signal",
+				strings.NewReader(tc.body)))
+
+			assert.Equal(t, tc.status, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultLogFileMaxSize = 100 * 1024 * 1024
+	defaultLogFileBackups = 5
+)
+
+// parseLogOutput returns kind of the log destination (stdout, stderr, file
+// or syslog) and file path for the file destination.
+func parseLogOutput(output string) (kind, path string, err error) {
+	switch {
+	case output == "", output == "stderr":
+		return "stderr", "", nil
+	case output == "stdout", output == "syslog":
+		return output, "", nil
+	case strings.HasPrefix(output, "file:"):
+		path = strings.TrimPrefix(output, "file:")
+		if !filepath.IsAbs(path) {
+			return "", "", fmt.Errorf("log file path must be absolute: %q", path)
+		}
+
+		return "file", path, nil
+	}
+
+	return "", "", fmt.Errorf("unknown log output %q", output)
+}
+
+// newLogWriter returns writer for the global logger based on the log_output
+// config option, which is one of stderr (default), stdout, syslog or
+// file:/path.
+func newLogWriter(output string) (io.Writer, error) {
+	kind, path, err := parseLogOutput(output)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use custom ConsoleWriter without TimestampFieldName, because console
+	// output is captured by journald, which has its own timestamps
+	consoleWriter := zerolog.ConsoleWriter{Out: os.Stderr, NoColor: true}
+	consoleWriter.PartsOrder = []string{
+		zerolog.LevelFieldName,
+		zerolog.CallerFieldName,
+		zerolog.MessageFieldName,
+	}
+	consoleWriter.FieldsExclude = []string{zerolog.TimestampFieldName}
+
+	switch kind {
+	case "stdout":
+		consoleWriter.Out = os.Stdout
+	case "syslog":
+		w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "maas-agent")
+		if err != nil {
+			return nil, fmt.Errorf("failed connecting to syslog: %w", err)
+		}
+
+		// Syslog has its own severity levels and timestamps
+		return zerolog.SyslogLevelWriter(w), nil
+	case "file":
+		f, err := newRotatingFile(path, defaultLogFileMaxSize, defaultLogFileBackups)
+		if err != nil {
+			return nil, err
+		}
+
+		consoleWriter.Out = f
+		consoleWriter.FieldsExclude = nil
+		consoleWriter.PartsOrder = append([]string{zerolog.TimestampFieldName},
+			consoleWriter.PartsOrder...)
+	}
+
+	return consoleWriter, nil
+}
+
+// rotatingFile is an io.Writer that writes to a file and rotates it once
+// it reaches maxSize, keeping up to backups of previous files named
+// path.1 (most recent) to path.N.
+type rotatingFile struct {
+	file    *os.File
+	path    string
+	maxSize int64
+	size    int64
+	backups int
+	mutex   sync.Mutex
+}
+
+func newRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	//nolint:gosec // log file can be read by others, same as syslog files
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed opening log file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed opening log file: %w", errors.Join(err, f.Close()))
+	}
+
+	r.file = f
+	r.size = info.Size()
+
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	for i := r.backups - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if r.backups > 0 {
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+// nextLogLevel returns the level that follows l when cycling verbosity at
+// runtime: INFO -> DEBUG -> TRACE -> INFO. Any other level goes to DEBUG.
+func nextLogLevel(l zerolog.Level) zerolog.Level {
+	switch l {
+	case zerolog.DebugLevel:
+		return zerolog.TraceLevel
+	case zerolog.TraceLevel:
+		return zerolog.InfoLevel
+	default:
+		return zerolog.DebugLevel
+	}
+}
+
+// cycleLogLevel bumps the global log level every time a value is received
+// from sigs, until sigs is closed. The starting point is whatever level was
+// configured via LOG_LEVEL or the config file.
+func cycleLogLevel(sigs <-chan os.Signal) {
+	for range sigs {
+		ll := nextLogLevel(zerolog.GlobalLevel())
+		zerolog.SetGlobalLevel(ll)
+		// Logged with WithLevel so the message is shown regardless of level.
+		log.WithLevel(zerolog.NoLevel).
+			Str("level", ll.String()).
+			Msg("Log level changed")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogOutput(t *testing.T) {
+	testcases := map[string]struct {
+		in   string
+		kind string
+		path string
+		err  bool
+	}{
+		"default": {
+			kind: "stderr",
+		},
+		"stdout": {
+			in:   "stdout",
+			kind: "stdout",
+		},
+		"syslog": {
+			in:   "syslog",
+			kind: "syslog",
+		},
+		"file": {
+			in:   "file:/var/log/maas/agent.log",
+			kind: "file",
+			path: "/var/log/maas/agent.log",
+		},
+		"relative file path": {
+			in:  "file:agent.log",
+			err: true,
+		},
+		"unknown": {
+			in:  "journald",
+			err: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			kind, path, err := parseLogOutput(tc.in)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.kind, kind)
+			assert.Equal(t, tc.path, path)
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+
+	f, err := newRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+
+	for fname, content := range expected {
+		data, err := os.ReadFile(fname)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestNewLogWriterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+
+	w, err := newLogWriter("file:" + path)
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte(`{"level":"info","time":"2024-01-01T00:00:00Z","message":"hello"}` + "\n"))
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "INF")
+	assert.Contains(t, string(data), "hello")
+}
+
+func TestNextLogLevel(t *testing.T) {
+	testcases := map[string]struct {
+		in  zerolog.Level
+		out zerolog.Level
+	}{
+		"info to debug":  {in: zerolog.InfoLevel, out: zerolog.DebugLevel},
+		"debug to trace": {in: zerolog.DebugLevel, out: zerolog.TraceLevel},
+		"trace to info":  {in: zerolog.TraceLevel, out: zerolog.InfoLevel},
+		"warn to debug":  {in: zerolog.WarnLevel, out: zerolog.DebugLevel},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.out, nextLogLevel(tc.in))
+		})
+	}
+}
@@ -19,14 +19,16 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/http/pprof"
 	"net/url"
 	"os"
 	"os/signal"
-	"path"
 	"path/filepath"
 	"strconv"
 	"syscall"
@@ -37,6 +39,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
@@ -48,18 +51,22 @@ import (
 	"go.opentelemetry.io/otel/trace"
 	tracenoop "go.opentelemetry.io/otel/trace/noop"
 	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
 	"go.temporal.io/sdk/client"
 	temporalotel "go.temporal.io/sdk/contrib/opentelemetry"
 	"go.temporal.io/sdk/converter"
 	"go.temporal.io/sdk/interceptor"
-	"gopkg.in/yaml.v3"
+	"go.temporal.io/sdk/workflow"
+	"google.golang.org/grpc"
 
 	"maas.io/core/src/maasagent/internal/apiclient"
 	"maas.io/core/src/maasagent/internal/cache"
 	"maas.io/core/src/maasagent/internal/dhcp"
 	"maas.io/core/src/maasagent/internal/httpproxy"
+	"maas.io/core/src/maasagent/internal/loadtest"
 	"maas.io/core/src/maasagent/internal/power"
 	"maas.io/core/src/maasagent/internal/servicecontroller"
+	wf "maas.io/core/src/maasagent/internal/workflow"
 	wflog "maas.io/core/src/maasagent/internal/workflow/log"
 	"maas.io/core/src/maasagent/internal/workflow/worker"
 	"maas.io/core/src/maasagent/pkg/workflow/codec"
@@ -68,45 +75,42 @@ import (
 const (
 	defaultTemporalPort        = 5271
 	defaultMAASInternalAPIPort = 5242
+	// By default the very first worker pool error is considered fatal
+	defaultWorkerPoolFailureThreshold = 1
+	defaultWorkerPoolFailureWindow    = 60 * time.Second
+	defaultWorkerPoolDrainTimeout     = 30 * time.Second
+	defaultClockSkewWarningThreshold  = 10 * time.Second
+	defaultBackoffMaxElapsedTime      = 60 * time.Second
+	defaultDialTimeout                = 5 * time.Second
+	defaultPreShutdownHookTimeout     = 30 * time.Second
+	defaultStickyResetTimeout         = 5 * time.Second
+	defaultGRPCKeepaliveTime          = 30 * time.Second
+	defaultGRPCKeepaliveTimeout       = 15 * time.Second
+	defaultHTTPReadTimeout            = 30 * time.Second
+	defaultHTTPWriteTimeout           = 60 * time.Second
+	defaultHTTPMaxConnections         = 16
+	defaultHTTPMaxRequestBodyBytes    = 1024 * 1024
+	defaultRPCMinBackoff              = 100 * time.Millisecond
+	defaultRPCMaxBackoff              = 10 * time.Second
+	defaultSystemIDSearchAttribute    = "MAASSystemID"
+	defaultActionSearchAttribute      = "MAASAction"
+	// Temporal SDK does not allow keepalive pings more often than that
+	minGRPCKeepaliveTime = 10 * time.Second
+	// Controllers over that are most likely stale entries
+	maxControllers = 16
 )
 
-// config represents a necessary set of configuration options for MAAS Agent
-// TODO: change to 'kebab-case' to follow the same syntax as Juju
-type config struct {
-	MAASUUID  string `yaml:"maas_uuid"`
-	SystemID  string `yaml:"system_id"`
-	Secret    string `yaml:"secret"`
-	LogLevel  string `yaml:"log_level"`
-	HTTPProxy struct {
-		CacheDir  string `yaml:"cache_dir"`
-		CacheSize int64  `yaml:"cache_size"`
-	} `yaml:"httpproxy"`
-	Controllers []string `yaml:"controllers,flow"`
-	Tracing     struct {
-		OTLPHTTPEndpoint string `yaml:"otlp_http_endpoint"`
-		Enabled          bool   `yaml:"enabled"`
-	} `yaml:"tracing"`
-	Metrics struct {
-		Enabled bool `yaml:"enabled"`
-	} `yaml:"metrics"`
-	Profiling struct {
-		Enabled bool `yaml:"enabled"`
-	} `yaml:"profiling"`
-}
+var (
+	// Override dialTemporalClient for tests to avoid dialing a real Temporal server.
+	dialTemporalClient = client.DialContext
+)
 
-// setupLogger sets the global logger with the provided logLevel.
-// If logLevel provided is unknown, then INFO will be used.
-func setupLogger(logLevel string) {
-	// Use custom ConsoleWriter without TimestampFieldName, because stdout
-	// is captured with systemd-cat
+// setupLogger sets the global logger with the provided logLevel, writing
+// to w, with fields added to every entry. If logLevel provided is unknown,
+// then INFO will be used.
+func setupLogger(logLevel string, w io.Writer, fields map[string]interface{}) {
 	// TODO: write directly to the journal
-	consoleWriter := zerolog.ConsoleWriter{Out: os.Stdout, NoColor: true}
-	consoleWriter.PartsOrder = []string{
-		zerolog.LevelFieldName,
-		zerolog.CallerFieldName,
-		zerolog.MessageFieldName,
-	}
-	log.Logger = zerolog.New(consoleWriter).With().Logger()
+	log.Logger = zerolog.New(w).With().Timestamp().Fields(fields).Logger()
 
 	ll, err := zerolog.ParseLevel(logLevel)
 	if err != nil || ll == zerolog.NoLevel {
@@ -150,81 +154,241 @@ func getClusterCert() (tls.Certificate, *x509.CertPool, error) {
 // getTemporalClient returns Temporal Client that is used to communicate
 // to MAAS Temporal server (running next to the Region Controller).
 //
-// secret is used for EncryptionCodec (AES) to encrypt input/output (payloads)
+// cfg.Codecs defines payload codecs, e.g. EncryptionCodec (AES) using cfg.Secret
+// to encrypt input/output (payloads)
 // cert, ca are used to setup mTLS
-func getTemporalClient(systemID string, secret []byte, cert tls.Certificate,
-	ca *x509.CertPool, endpoints []string,
-	metrics temporalotel.MetricsHandler, tracer trace.Tracer) (client.Client, error) {
-	// Encryption Codec required for Temporal Workflow's payload encoding
-	codec, err := codec.NewEncryptionCodec([]byte(secret))
+// interceptors are applied to RPCs before they are throttled
+// It also returns the endpoint of the controller the client is connected to.
+func getTemporalClient(cfg *config, cert tls.Certificate, ca *x509.CertPool,
+	metrics temporalotel.MetricsHandler, tracer trace.Tracer,
+	interceptors []grpc.UnaryClientInterceptor,
+	codecOptions ...codec.EncryptionCodecOption) (client.Client, string, error) {
+	dataConverter, err := newDataConverter(cfg, codecOptions...)
 	if err != nil {
-		return nil, fmt.Errorf("failed setting up encryption codec: %w", err)
+		return nil, "", err
+	}
+
+	propagators := []workflow.ContextPropagator{wf.NewRequestPropagator()}
+	if len(cfg.Secrets) > 0 {
+		propagators = append(propagators, codec.NewTenantPropagator())
 	}
 
-	retry := backoff.NewExponentialBackOff()
-	retry.MaxElapsedTime = 60 * time.Second
+	retry := cfg.newRetryBackOff()
+
+	connectionOptions := cfg.connectionOptions()
+	connectionOptions.TLS = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      ca,
+		// NOTE: this should be configurable.
+		// Right now it is hardcoded because we use MAAS self-signed
+		// certificate for mTLS. But that needs to be refactored once
+		// we start supporting custom certificates for mTLS.
+		ServerName: "maas",
+	}
+	connectionOptions.DialOptions = append(connectionOptions.DialOptions,
+		grpc.WithChainUnaryInterceptor(interceptors...),
+		grpc.WithChainUnaryInterceptor(cfg.rpcThrottle().unaryInterceptor))
 
 	tracingInterceptor, err := temporalotel.NewTracingInterceptor(temporalotel.TracerOptions{
 		Tracer: tracer,
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed setting up tracing interceptor: %w", err)
-	}
-
-	return backoff.RetryWithData(
-		func() (client.Client, error) {
-			return client.Dial(client.Options{
-				// TODO: fallback retry if Controllers[0] is unavailable
-				HostPort:     net.JoinHostPort(endpoints[0], strconv.Itoa(defaultTemporalPort)),
-				Identity:     fmt.Sprintf("%s@agent:%d", systemID, os.Getpid()),
-				Logger:       wflog.NewZerologAdapter(log.Logger),
-				Interceptors: []interceptor.ClientInterceptor{tracingInterceptor},
-				DataConverter: converter.NewCodecDataConverter(
-					converter.GetDefaultDataConverter(),
-					codec,
-				),
-				ConnectionOptions: client.ConnectionOptions{
-					TLS: &tls.Config{
-						MinVersion:   tls.VersionTLS12,
-						Certificates: []tls.Certificate{cert},
-						RootCAs:      ca,
-						// NOTE: this should be configurable.
-						// Right now it is hardcoded because we use MAAS self-signed
-						// certificate for mTLS. But that needs to be refactored once
-						// we start supporting custom certificates for mTLS.
-						ServerName: "maas",
-					},
-				},
-				MetricsHandler: metrics,
-			})
+		return nil, "", fmt.Errorf("failed setting up tracing interceptor: %w", err)
+	}
+
+	options := client.Options{
+		Identity:           fmt.Sprintf("%s@agent:%d", cfg.SystemID, os.Getpid()),
+		Logger:             wflog.NewZerologAdapter(log.Logger),
+		Interceptors:       []interceptor.ClientInterceptor{tracingInterceptor},
+		DataConverter:      dataConverter,
+		ContextPropagators: propagators,
+		ConnectionOptions:  connectionOptions,
+		MetricsHandler:     metrics,
+	}
+
+	var endpoint string
+
+	c, err := backoff.RetryWithData(
+		func() (c client.Client, err error) {
+			c, endpoint, err = dialControllers(cfg, options)
+			return c, err
 		}, retry,
 	)
+
+	return c, endpoint, err
+}
+
+// dialControllers dials Temporal server of every controller in turn, until
+// one of them succeeds, and returns the endpoint it is connected to. Every
+// attempt is limited by the dial timeout, so one dead controller does not use
+// up the whole retry budget.
+func dialControllers(cfg *config, options client.Options) (client.Client, string, error) {
+	var errs []error
+
+	for _, controller := range cfg.Controllers {
+		endpoint := net.JoinHostPort(controller, strconv.Itoa(defaultTemporalPort))
+		options.HostPort = temporalTarget(cfg.DNSServer, endpoint)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.dialTimeout())
+		c, err := dialTemporalClient(ctx, options)
+
+		cancel()
+
+		if err == nil {
+			return c, endpoint, nil
+		}
+
+		log.Warn().Err(err).Str("controller", controller).Msg("Failed connecting to Temporal server")
+
+		errs = append(errs, fmt.Errorf("%s: %w", controller, err))
+	}
+
+	return nil, "", errors.Join(errs...)
+}
+
+// newDataConverter returns data converter using payload codecs configured by
+// cfg.Codecs. If secrets of other MAAS installations are configured, payloads
+// are encrypted with the secret of the installation carried by the workflow
+// or activity context.
+// Payloads of workflows listed in cfg.Codec.PassthroughWorkflows are not
+// encrypted.
+func newDataConverter(cfg *config,
+	codecOptions ...codec.EncryptionCodecOption) (converter.DataConverter, error) {
+	codecs, err := newPayloadCodecs(cfg, codecOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	var dc converter.DataConverter = converter.NewCodecDataConverter(
+		converter.GetDefaultDataConverter(), codecs...)
+
+	if len(cfg.Secrets) > 0 {
+		tenants := make(map[string]converter.DataConverter, len(cfg.Secrets))
+
+		for uuid := range cfg.Secrets {
+			codecs, err := newTenantPayloadCodecs(cfg, uuid, codecOptions...)
+			if err != nil {
+				return nil, err
+			}
+
+			tenants[uuid] = converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), codecs...)
+		}
+
+		dc = codec.NewTenantDataConverter(dc, tenants)
+	}
+
+	if len(cfg.Codec.PassthroughWorkflows) == 0 {
+		return dc, nil
+	}
+
+	// Payloads of passthrough workflows are not encrypted, but encrypted
+	// payloads they receive are still decrypted.
+	passthrough := make([]converter.PayloadCodec, len(codecs))
+
+	for i, c := range codecs {
+		switch c.(type) {
+		case *codec.EncryptionCodec, *codec.TenantEncryptionCodec:
+			passthrough[i] = codec.NewDecodeOnlyCodec(c)
+		default:
+			passthrough[i] = c
+		}
+	}
+
+	return codec.NewPassthroughDataConverter(dc,
+		converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), passthrough...),
+		cfg.Codec.PassthroughWorkflows,
+	), nil
 }
 
-// getConfig reads MAAS Agent YAML configuration file
-// NOTE: agent.yaml config is generated by rackd, however this behaviour
-// should be changed when MAAS Agent will be a standalone service, not managed
-// by the Rack Controller.
-func getConfig() (*config, error) {
-	fname := os.Getenv("MAAS_AGENT_CONFIG")
-	if fname == "" {
-		fname = "/etc/maas/agent.yaml"
+// newPayloadCodecs returns payload codecs configured by cfg.Codecs, ordered
+// as expected by converter.NewCodecDataConverter, which applies codecs from
+// last to first on encode.
+func newPayloadCodecs(cfg *config,
+	codecOptions ...codec.EncryptionCodecOption) ([]converter.PayloadCodec, error) {
+	return newTenantPayloadCodecs(cfg, cfg.MAASUUID, codecOptions...)
+}
+
+// newTenantPayloadCodecs is like newPayloadCodecs, but payloads are encrypted
+// with the secret of the MAAS installation identified by tenant, when secrets
+// of several installations are configured.
+func newTenantPayloadCodecs(cfg *config, tenant string,
+	codecOptions ...codec.EncryptionCodecOption) ([]converter.PayloadCodec, error) {
+	names := cfg.Codecs
+	if names == nil {
+		names = []string{"encrypt"}
+	}
+
+	codecs := make([]converter.PayloadCodec, len(names))
+
+	for i, name := range names {
+		var c converter.PayloadCodec
+
+		switch name {
+		case "compress":
+			c = converter.NewZlibCodec(converter.ZlibCodecOptions{})
+		case "encrypt":
+			if cfg.Secret == "" && len(cfg.Secrets) == 0 {
+				return nil, errors.New("failed setting up encryption codec: secret is required")
+			}
+
+			options := append([]codec.EncryptionCodecOption{}, codecOptions...)
+			if cfg.Codec.MaxPayloadSize != 0 {
+				options = append(options, codec.WithMaxPayloadSize(cfg.Codec.MaxPayloadSize))
+			}
+
+			if cfg.Codec.DecodeRetries > 0 {
+				options = append(options, codec.WithDecodeRetries(cfg.Codec.DecodeRetries,
+					cfg.Codec.DecodeRetryBackoff))
+			}
+
+			var err error
+
+			if len(cfg.Secrets) == 0 {
+				c, err = codec.NewEncryptionCodec([]byte(cfg.Secret), options...)
+			} else {
+				c, err = codec.NewTenantEncryptionCodec(tenant, cfg.tenantKeys(), options...)
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("failed setting up encryption codec: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown codec %q", name)
+		}
+
+		codecs[len(names)-1-i] = c
 	}
 
-	data, err := os.ReadFile(filepath.Clean(fname))
+	return codecs, nil
+}
+
+// selfTestPayloadCodecs ensures that a payload encoded with the configured
+// codecs can be decoded back.
+func selfTestPayloadCodecs(cfg *config) error {
+	codecs, err := newPayloadCodecs(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("configuration error: %w", err)
+		return err
 	}
 
-	cfg := &config{}
+	dc := converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), codecs...)
 
-	err = yaml.Unmarshal([]byte(data), cfg)
+	payload, err := dc.ToPayload(cfg.SystemID)
 	if err != nil {
-		return nil, fmt.Errorf("configuration error: %w", err)
+		return fmt.Errorf("codec self-test failed: %w", err)
+	}
+
+	var result string
+	if err := dc.FromPayload(payload, &result); err != nil {
+		return fmt.Errorf("codec self-test failed: %w", err)
+	}
+
+	if result != cfg.SystemID {
+		return errors.New("codec self-test failed: decoded payload does not match")
 	}
 
-	return cfg, nil
+	return nil
 }
 
 func getOrCreateDir(path string) (string, error) {
@@ -260,17 +424,41 @@ func getCertificatesDir() string {
 	return "/var/lib/maas/certificates"
 }
 
-func setupMetrics(meterProvider *metric.MeterProvider, mux *http.ServeMux) error {
-	exporter, err := prometheus.New()
+// identityAttributes returns attributes identifying the agent and the MAAS
+// installation it belongs to, so telemetry of many installations can be told
+// apart. Both are low-cardinality, so they are safe to use as labels.
+func identityAttributes(cfg *config) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("maas.system_id", cfg.SystemID)}
+
+	if cfg.MAASUUID != "" {
+		attrs = append(attrs, attribute.String("maas.uuid", cfg.MAASUUID))
+	}
+
+	return attrs
+}
+
+// setupMetrics sets up Prometheus metrics, where identity attributes are
+// constant labels of every metric.
+func setupMetrics(meterProvider *metric.MeterProvider, mux *http.ServeMux,
+	identity []attribute.KeyValue) error {
+	keys := make([]attribute.Key, len(identity))
+	for i, kv := range identity {
+		keys[i] = kv.Key
+	}
+
+	exporter, err := prometheus.New(
+		prometheus.WithResourceAsConstantLabels(attribute.NewAllowKeysFilter(keys...)))
 	if err != nil {
 		return err
 	}
 
 	r, err := resource.Merge(resource.Default(),
 		resource.NewWithAttributes(semconv.SchemaURL,
-			semconv.ServiceName("maas.agent"),
-			// TODO: version
-			// semconv.ServiceVersion("0.1.0"),
+			append([]attribute.KeyValue{
+				semconv.ServiceName("maas.agent"),
+				// TODO: version
+				// semconv.ServiceVersion("0.1.0"),
+			}, identity...)...,
 		),
 	)
 	if err != nil {
@@ -295,34 +483,46 @@ func setupProfiling(mux *http.ServeMux) {
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 }
 
-func setupHTTP(mux *http.ServeMux) error {
-	socketPath := path.Join(getRunDir(), "agent-http.sock")
-
-	if err := syscall.Unlink(socketPath); err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
+// temporalTarget returns gRPC target for the Temporal server hostPort.
+// If dnsServer is set, then gRPC DNS resolver will use it instead of the
+// system resolver.
+func temporalTarget(dnsServer, hostPort string) string {
+	if dnsServer == "" {
+		return hostPort
 	}
 
-	listener, err := net.Listen("unix", socketPath)
-	if err != nil {
-		return err
-	}
+	return fmt.Sprintf("dns://%s/%s", dnsServerAddr(dnsServer), hostPort)
+}
 
-	//nolint:gosec // we know what we are doing here and we need 0660
-	if err := os.Chmod(socketPath, 0660); err != nil {
-		return err
+// dnsServerAddr returns DNS server address with the default port if missing.
+func dnsServerAddr(dnsServer string) string {
+	if _, _, err := net.SplitHostPort(dnsServer); err == nil {
+		return dnsServer
 	}
 
-	server := &http.Server{
-		Handler:           mux,
-		ReadHeaderTimeout: 60 * time.Second,
+	return net.JoinHostPort(dnsServer, "53")
+}
+
+// newResolver returns net.Resolver that sends queries to dnsServer.
+// If dnsServer is empty, then the system resolver is used.
+func newResolver(dnsServer string) *net.Resolver {
+	if dnsServer == "" {
+		return net.DefaultResolver
 	}
 
-	return server.Serve(listener)
+	addr := dnsServerAddr(dnsServer)
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
 }
 
-func setupHTTPClient(cert tls.Certificate, ca *x509.CertPool) http.Client {
+func setupHTTPClient(cert tls.Certificate, ca *x509.CertPool,
+	resolver *net.Resolver) http.Client {
 	tlsConfig := &tls.Config{
 		MinVersion:   tls.VersionTLS12,
 		Certificates: []tls.Certificate{cert},
@@ -334,8 +534,13 @@ func setupHTTPClient(cert tls.Certificate, ca *x509.CertPool) http.Client {
 		ServerName: "maas",
 	}
 
+	dialer := &net.Dialer{
+		Resolver: resolver,
+	}
+
 	transport := &http.Transport{
 		TLSClientConfig: tlsConfig,
+		DialContext:     dialer.DialContext,
 	}
 
 	return http.Client{
@@ -343,7 +548,8 @@ func setupHTTPClient(cert tls.Certificate, ca *x509.CertPool) http.Client {
 	}
 }
 
-func setupTracer(tracerProvider *trace.TracerProvider, endpoint string) error {
+func setupTracer(tracerProvider *trace.TracerProvider, endpoint string,
+	identity []attribute.KeyValue) error {
 	ctx := context.TODO()
 
 	traceExporter, err := otlptracehttp.New(ctx,
@@ -356,9 +562,11 @@ func setupTracer(tracerProvider *trace.TracerProvider, endpoint string) error {
 
 	r, err := resource.Merge(resource.Default(),
 		resource.NewWithAttributes(semconv.SchemaURL,
-			semconv.ServiceName("maas.agent"),
-			// TODO: version
-			// semconv.ServiceVersion("0.1.0"),
+			append([]attribute.KeyValue{
+				semconv.ServiceName("maas.agent"),
+				// TODO: version
+				// semconv.ServiceVersion("0.1.0"),
+			}, identity...)...,
 		),
 	)
 	if err != nil {
@@ -377,10 +585,135 @@ func setupTracer(tracerProvider *trace.TracerProvider, endpoint string) error {
 	return nil
 }
 
+// watchErrors calls next in a loop and returns an error once threshold errors
+// were received within the window. Isolated errors below the threshold are
+// logged and tolerated.
+func watchErrors(next func() error, threshold int, window time.Duration) error {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	var errs []time.Time
+
+	for {
+		err := next()
+		now := time.Now()
+
+		recent := errs[:0]
+
+		for _, t := range errs {
+			if now.Sub(t) < window {
+				recent = append(recent, t)
+			}
+		}
+
+		errs = append(recent, now)
+
+		if len(errs) >= threshold {
+			return fmt.Errorf("%d error(s) within %s: %w", len(errs), window, err)
+		}
+
+		log.Warn().Err(err).
+			Int("errors", len(errs)).
+			Int("threshold", threshold).
+			Msg("Tolerating worker pool error")
+	}
+}
+
+// configureAgent signals Region Controller that Agent has started.
+// This should trigger configuration workflows execution.
+// Region controller will start configuration workflows based on certain
+// events, however this explicit call from the Agent is used to cover
+// situations when Agent is (re)started and has a clean state.
+// Once Region can detect that Agent was reconnected or restarted via
+// Temporal server API, we should no longer need this.
+func configureAgent(ctx context.Context, c client.Client, cfg *config) error {
+	type configureAgentParam struct {
+		SystemID string `json:"system_id"`
+	}
+
+	workflowOptions := client.StartWorkflowOptions{
+		ID:        fmt.Sprintf("configure-agent:%s", cfg.SystemID),
+		TaskQueue: "region",
+		// If we failed to execute this workflow in 120 seconds, then something bad
+		// happened and we don't want to keep it in a task queue (will be cancelled)
+		WorkflowExecutionTimeout: 120 * time.Second,
+		WorkflowTaskTimeout:      cfg.Workflows.WorkflowTaskTimeout,
+		WorkflowIDReusePolicy:    enums.WORKFLOW_ID_REUSE_POLICY_TERMINATE_IF_RUNNING,
+	}
+
+	workflowRun, err := c.ExecuteWorkflow(ctx, workflowOptions,
+		"configure-agent", configureAgentParam{SystemID: cfg.SystemID},
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to execute configure-agent workflow: %w", err)
+	}
+
+	return workflowRun.Get(ctx, nil)
+}
+
+// isNamespaceNotFound returns true if err was caused by Temporal namespace
+// of the agent not existing, e.g. because it was recreated.
+func isNamespaceNotFound(err error) bool {
+	var notFound *serviceerror.NamespaceNotFound
+	return errors.As(err, &notFound)
+}
+
+// restartWorkerPool restarts the worker pool, retrying until the namespace
+// exists again, and asks Region Controller to configure the agent from
+// scratch.
+func restartWorkerPool(ctx context.Context, pool *worker.WorkerPool,
+	c client.Client, cfg *config) error {
+	if err := backoff.Retry(pool.Restart, cfg.newRetryBackOff()); err != nil {
+		return fmt.Errorf("failed restarting worker pool: %w", err)
+	}
+
+	if err := configureAgent(ctx, c, cfg); err != nil {
+		return fmt.Errorf("workflow configure-agent failed: %w", err)
+	}
+
+	return nil
+}
+
+// startStagger returns a random delay in [0, limit), used to spread start of
+// the worker pools of many agents started at the same time. Zero is returned
+// if limit is not positive.
+func startStagger(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(limit))) //nolint:gosec // not used for security
+}
+
+// drain stops the worker pool and reports whether all the workers were
+// stopped within the timeout.
+func drain(pool *worker.WorkerPool, timeout time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		pool.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func Run() int {
+	started := time.Now()
 	fatal := make(chan error)
 
 	cfg, err := getConfig()
+	if err == nil {
+		err = cfg.validate()
+	}
+
 	if err != nil {
 		fmt.Printf("Failed starting MAAS Agent: %s", err)
 		return 1
@@ -392,7 +725,47 @@ func Run() int {
 		return 1
 	}
 
-	setupLogger(cfg.LogLevel)
+	logWriter, err := newLogWriter(cfg.LogOutput)
+	if err != nil {
+		fmt.Printf("Failed starting MAAS Agent: %s", err)
+		return 1
+	}
+
+	logFields := map[string]interface{}{"system_id": cfg.SystemID}
+	if cfg.MAASUUID != "" {
+		logFields["maas_uuid"] = cfg.MAASUUID
+	}
+
+	setupLogger(cfg.LogLevel, logWriter, logFields)
+
+	if cfg.FastStart {
+		log.Warn().Msg("Fast start is enabled, optional startup verifications are skipped")
+	}
+
+	controllers, errs := normalizeControllers(cfg.Controllers)
+	for _, err := range errs {
+		log.Warn().Err(err).Msg("Skipping malformed controller entry")
+	}
+
+	controllers, duplicates := uniqueControllers(controllers)
+	if duplicates > 0 {
+		log.Info().Int("duplicates", duplicates).Msg("Collapsed duplicate controller entries")
+	}
+
+	if len(controllers) > maxControllers {
+		log.Warn().Int("controllers", len(controllers)).Int("max", maxControllers).
+			Msg("Too many controller entries, ignoring the ones over the limit")
+
+		controllers = controllers[:maxControllers]
+	}
+
+	cfg.Controllers = controllers
+
+	wf.SetFeatures(cfg.Features)
+
+	if cfg.CheckIP.CoalescingWindow > 0 {
+		wf.SetCheckIPCoalescingWindow(cfg.CheckIP.CoalescingWindow)
+	}
 
 	var meterProvider metric.MeterProvider
 
@@ -402,7 +775,7 @@ func Run() int {
 
 	// TODO: make this configurable based on the config parameters
 	//nolint:govet // false positive
-	if err := setupMetrics(&meterProvider, mux); err != nil {
+	if err := setupMetrics(&meterProvider, mux, identityAttributes(cfg)); err != nil {
 		log.Error().Err(err).Msg("Cannot fetch cluster certificate")
 		return 1
 	}
@@ -411,11 +784,28 @@ func Run() int {
 		setupProfiling(mux)
 	}
 
-	go func() { fatal <- setupHTTP(mux) }()
+	quiesce := make(chan quiesceRequest)
+
+	setupAdmin(mux, cfg, quiesce)
+
+	var lc lifecycle
+
+	// Components that were started are stopped on failures as well.
+	defer func() {
+		if err := lc.stop(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("Shutdown failure")
+		}
+	}()
+
+	if err := lc.start("HTTP server", newHTTPServer(mux, cfg.httpServerLimits(), fatal)); err != nil {
+		log.Error().Err(err).Msg("HTTP server failure")
+		return 1
+	}
 
 	if cfg.Tracing.Enabled {
 		//nolint:govet // false positive
-		if err := setupTracer(&tracerProvider, cfg.Tracing.OTLPHTTPEndpoint); err != nil {
+		if err := setupTracer(&tracerProvider, cfg.Tracing.OTLPHTTPEndpoint,
+			identityAttributes(cfg)); err != nil {
 			log.Error().Err(err).Msg("Failed to setup tracing")
 			return 1
 		}
@@ -429,19 +819,40 @@ func Run() int {
 		return 1
 	}
 
-	temporalClient, err := getTemporalClient(cfg.SystemID, []byte(cfg.Secret),
-		cert, ca, cfg.Controllers,
+	// Polls held by the limiter do not count towards the RPC rate, because
+	// they are held before they are throttled.
+	workflowLimiter := worker.NewWorkflowLimiter(cfg.WorkerPool.MaxConcurrentWorkflows)
+
+	temporalClient, temporalEndpoint, err := getTemporalClient(cfg, cert, ca,
 		temporalotel.NewMetricsHandler(
 			temporalotel.MetricsHandlerOptions{
 				Meter: meterProvider.Meter("temporal")},
 		),
 		tracerProvider.Tracer("temporal"),
+		[]grpc.UnaryClientInterceptor{workflowLimiter.UnaryClientInterceptor},
+		codec.WithMetricMeter(meterProvider.Meter("codec")),
 	)
 	if err != nil {
 		log.Error().Err(err).Msg("Temporal client error")
 		return 1
 	}
 
+	//nolint:errcheck // starting a client is a no-op
+	lc.start("Temporal client", componentFuncs{
+		stop: func(context.Context) error {
+			temporalClient.Close()
+			return nil
+		},
+	})
+
+	if err := checkServerVersion(context.Background(), temporalClient.WorkflowService(),
+		cfg.RequireServerVersion); err != nil {
+		log.Error().Err(err).Msg("Temporal server version is not supported")
+		return 1
+	}
+
+	setupAdminSignal(mux, cfg, temporalClient)
+
 	u := &url.URL{
 		Scheme: "https",
 		Host:   net.JoinHostPort(cfg.Controllers[0], strconv.Itoa(defaultMAASInternalAPIPort)),
@@ -450,7 +861,7 @@ func Run() int {
 
 	u.RawPath = u.EscapedPath()
 
-	httpClient := setupHTTPClient(cert, ca)
+	httpClient := setupHTTPClient(cert, ca, newResolver(cfg.DNSServer))
 
 	apiClient := apiclient.NewAPIClient(u, &httpClient)
 
@@ -482,86 +893,353 @@ func Run() int {
 		return 1
 	}
 
-	powerService := power.NewPowerService(cfg.SystemID, &workerPool)
-	httpProxyService := httpproxy.NewHTTPProxyService(runDir, httpProxyCache)
+	powerServiceOptions := []power.PowerServiceOption{
+		power.WithScheduleToStartTimeout(cfg.scheduleToStartTimeout("configure-power-service")),
+		power.WithMetricMeter(meterProvider.Meter("power")),
+	}
+
+	if cfg.Power.BMCLockMode != "" {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithBMCLockMode(power.BMCLockMode(cfg.Power.BMCLockMode)))
+	}
+
+	if cfg.Power.EnableExecPower {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithExecPower(cfg.Power.ExecCommands))
+	}
+
+	if len(cfg.Power.BootProfiles) > 0 {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithBootProfiles(cfg.Power.BootProfiles))
+	}
+
+	if cb := cfg.Power.CircuitBreaker; cb.FailureThreshold > 0 {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithCircuitBreaker(cb.FailureThreshold, cb.Window, cb.Cooldown))
+	}
+
+	if len(cfg.Power.BMCAllowedCIDRs) > 0 {
+		prefixes, err := cfg.bmcAllowedPrefixes()
+		if err != nil {
+			log.Error().Err(err).Msg("BMC allowlist initialisation error")
+			return 1
+		}
+
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithBMCAllowedPrefixes(prefixes))
+	}
+
+	if cfg.Power.SecretProvider.Type != "" {
+		provider, err := cfg.secretProvider()
+		if err != nil {
+			log.Error().Err(err).Msg("Secret provider initialisation error")
+			return 1
+		}
+
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithSecretProvider(provider))
+	}
+
+	if h := cfg.Power.History; h.Size > 0 {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithPowerHistory(h.Size, h.Retention))
+	}
+
+	if cfg.Power.RetryWarningThreshold > 0 {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithRetryWarningThreshold(cfg.Power.RetryWarningThreshold))
+	}
+
+	if len(cfg.Power.MetricLabels) > 0 {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithMetricLabels(cfg.Power.MetricLabels))
+	}
+
+	if cfg.Power.SettleDelay > 0 {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithSettleDelay(cfg.Power.SettleDelay))
+	}
+
+	if cfg.BackoffStrategy != "" {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithBackoffStrategy(cfg.BackoffStrategy))
+	}
+
+	if r := cfg.Power.BMCRetry; r.MaxRetries > 0 {
+		powerServiceOptions = append(powerServiceOptions,
+			power.WithBMCRetry(r.InitialInterval, r.MaxInterval, r.Jitter, r.MaxRetries))
+	}
+
+	powerService := power.NewPowerService(cfg.SystemID, &workerPool, powerServiceOptions...)
+	httpProxyService := httpproxy.NewHTTPProxyService(runDir, httpProxyCache,
+		httpproxy.WithScheduleToStartTimeout(cfg.scheduleToStartTimeout("configure-httpproxy-service")),
+		httpproxy.WithMaxConcurrentFetches(cfg.HTTPProxy.MaxConcurrentImageWrites),
+		httpproxy.WithMaxFetchRate(cfg.HTTPProxy.MaxFetchRate),
+	)
 	dhcpService := dhcp.NewDHCPService(cfg.SystemID, controllerV4, controllerV6, dhcp.WithAPIClient(apiClient))
 
-	workerPool = *worker.NewWorkerPool(cfg.SystemID, temporalClient,
+	drainTimeout := cfg.WorkerPool.DrainTimeout
+	if drainTimeout == 0 {
+		drainTimeout = defaultWorkerPoolDrainTimeout
+	}
+
+	clockSkewThreshold := cfg.WorkerPool.ClockSkewWarningThreshold
+	if clockSkewThreshold == 0 {
+		clockSkewThreshold = defaultClockSkewWarningThreshold
+	}
+
+	workerPoolOptions := []worker.WorkerPoolOption{
 		worker.WithMainWorkerTaskQueueSuffix("agent:main"),
+		worker.WithTaskQueuePrefix(cfg.TaskQueuePrefix),
+		worker.WithStopTimeout(drainTimeout),
+		worker.WithPartialStart(cfg.WorkerPool.PartialStartOK),
+		worker.WithSeparateActivityWorkers(cfg.WorkerPool.SeparateActivityWorkers),
+		worker.WithStartConcurrency(cfg.WorkerPool.StartConcurrency),
+		worker.WithMaxHeartbeatThrottleInterval(cfg.WorkerPool.MaxHeartbeatThrottleInterval),
+		worker.WithMaxConcurrentActivities(cfg.WorkerPool.MaxConcurrentActivities),
+		worker.WithWorkflowLimiter(workflowLimiter),
+		worker.WithMaxWorkflowExecutionTime(cfg.WorkerPool.MaxWorkflowExecutionTime),
+		worker.WithClockSkewWarningThreshold(clockSkewThreshold),
+		worker.WithMetricMeter(meterProvider.Meter("worker")),
 		worker.WithConfigurator(powerService),
 		worker.WithConfigurator(httpProxyService),
 		worker.WithConfigurator(dhcpService),
-	)
+	}
 
-	workerPoolBackoff := backoff.NewExponentialBackOff()
-	workerPoolBackoff.MaxElapsedTime = 60 * time.Second
+	if cfg.SearchAttributes.Enabled {
+		workerPoolOptions = append(workerPoolOptions,
+			worker.WithSearchAttributes(cfg.searchAttributeKeys()))
+	}
 
-	err = backoff.Retry(workerPool.Start, workerPoolBackoff)
-	if err != nil {
-		log.Error().Err(err).Msg("Temporal worker pool failure")
-		return 1
+	workerPoolOptions = append(workerPoolOptions, worker.WithConfigurator(&capabilitiesService{
+		cfg:           cfg,
+		registrations: func() []worker.Registration { return workerPool.Registrations() },
+		power:         powerService.Capabilities,
+	}))
+
+	if cfg.EnableLoadTest {
+		log.Warn().Msg("Load test workflow is enabled")
+
+		workerPoolOptions = append(workerPoolOptions,
+			worker.WithConfigurator(loadtest.NewLoadTestService()))
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	if cfg.DebugDumpDir != "" {
+		if err := os.MkdirAll(cfg.DebugDumpDir, 0700); err != nil {
+			log.Error().Err(err).Msg("Debug dump directory creation failure")
+			return 1
+		}
 
-	// NOTE: Signal Region Controller that Agent has started.
-	// This should trigger configuration workflows execution.
-	// Region controller will start configuration workflows based on certain
-	// events, however this explicit call from the Agent is used to cover
-	// situations when Agent is (re)started and has a clean state.
-	// Once Region can detect that Agent was reconnected or restarted via
-	// Temporal server API, we should no longer need this.
-	type configureAgentParam struct {
-		SystemID string `json:"system_id"`
+		workerPoolOptions = append(workerPoolOptions, worker.WithDebugDump(cfg.DebugDumpDir))
 	}
 
-	workflowOptions := client.StartWorkflowOptions{
-		ID:        fmt.Sprintf("configure-agent:%s", cfg.SystemID),
-		TaskQueue: "region",
-		// If we failed to execute this workflow in 120 seconds, then something bad
-		// happened and we don't want to keep it in a task queue (will be cancelled)
-		WorkflowExecutionTimeout: 120 * time.Second,
-		WorkflowIDReusePolicy:    enums.WORKFLOW_ID_REUSE_POLICY_TERMINATE_IF_RUNNING,
+	if cfg.ResultWebhook.URL != "" {
+		workerPoolOptions = append(workerPoolOptions,
+			worker.WithResultWebhook(cfg.ResultWebhook.URL, cfg.ResultWebhook.Secret))
 	}
 
-	workflowRun, err := temporalClient.ExecuteWorkflow(ctx, workflowOptions,
-		"configure-agent", configureAgentParam{SystemID: cfg.SystemID},
-	)
+	workerPool = *worker.NewWorkerPool(cfg.SystemID, temporalClient, workerPoolOptions...)
+
+	setupAdminPause(mux, &workerPool)
+
+	var drained bool
+
+	err = lc.start("worker pool", componentFuncs{
+		start: func() error {
+			if delay := startStagger(cfg.WorkerPool.StartStagger); delay > 0 {
+				log.Info().Dur("delay", delay).Msg("Delaying worker pool start")
+				time.Sleep(delay)
+			}
+
+			return backoff.Retry(workerPool.Start, cfg.newRetryBackOff())
+		},
+		stop: func(ctx context.Context) error {
+			drained = drain(&workerPool, drainTimeout)
+
+			// Workflows cached by the agent are picked up by other workers
+			// right away, instead of after the sticky queue timeout.
+			ctx, cancel := context.WithTimeout(ctx, defaultStickyResetTimeout)
+			defer cancel()
+
+			if err := workerPool.ResetStickyTaskQueues(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed resetting sticky task queues")
+			}
 
+			return nil
+		},
+	})
 	if err != nil {
-		log.Err(err).Msg("Failed to execute configure-agent workflow")
+		log.Error().Err(err).Msg("Temporal worker pool failure")
 		return 1
 	}
 
-	if err := workflowRun.Get(ctx, nil); err != nil {
+	// Names are sorted, so the log can be compared across restarts
+	mainWorker := workerPool.Registrations()[0]
+	log.Debug().
+		Str("task_queue", mainWorker.TaskQueue).
+		Strs("workflows", mainWorker.Workflows).
+		Strs("activities", mainWorker.Activities).
+		Msg("Main worker started")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := configureAgent(ctx, temporalClient, cfg); err != nil {
 		log.Err(err).Msg("Workflow configure-agent failed")
 		return 1
 	}
 
+	failureThreshold := cfg.WorkerPool.FailureThreshold
+	if failureThreshold == 0 {
+		failureThreshold = defaultWorkerPoolFailureThreshold
+	}
+
+	failureWindow := cfg.WorkerPool.FailureWindow
+	if failureWindow == 0 {
+		failureWindow = defaultWorkerPoolFailureWindow
+	}
+
 	go func() {
-		fatal <- workerPool.Error()
+		for {
+			err := watchErrors(workerPool.Error, failureThreshold, failureWindow)
+			if !cfg.WorkerPool.RestartOnNamespaceNotFound || !isNamespaceNotFound(err) {
+				fatal <- err
+				return
+			}
+
+			log.Warn().Err(err).
+				Msg("Temporal namespace not found, restarting worker pool and abandoning work in progress")
+
+			if err := restartWorkerPool(ctx, &workerPool, temporalClient, cfg); err != nil {
+				fatal <- err
+				return
+			}
+
+			log.Warn().Msg("Worker pool restarted")
+		}
 	}()
 
 	go func() {
 		fatal <- httpProxyService.Error()
 	}()
 
+	connectionMonitor := newConnectionMonitor(temporalClient, temporalEndpoint,
+		meterProvider.Meter("temporal"))
+
+	setupAdminStatus(mux, connectionMonitor)
+
+	go connectionMonitor.run(ctx)
+
 	log.Info().Msg("Service MAAS Agent started")
 
+	levelSigs := make(chan os.Signal, 1)
+
+	signal.Notify(levelSigs, syscall.SIGUSR2)
+
+	go cycleLogLevel(levelSigs)
+
 	sigs := make(chan os.Signal, 2)
 
-	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP)
+	// Configuration was validated, so signals are known
+	shutdownSignals, _ := cfg.shutdownSignals()
+
+	signal.Notify(sigs, append(shutdownSignals, syscall.SIGHUP)...)
+
+	if cfg.WatchConfig && isConfigURL(configFileName()) {
+		log.Warn().Msg("Configuration fetched from a URL cannot be watched, use SIGHUP to reload it")
+	} else if cfg.WatchConfig {
+		go func() {
+			// Configuration change is handled in the same way as SIGHUP
+			err := watchConfig(ctx, configFileName(), configWatchDebounce,
+				func() { sigs <- syscall.SIGHUP })
+			if err != nil {
+				log.Error().Err(err).Msg("Configuration file watch failure")
+			}
+		}()
+	}
 
 	select {
 	case err := <-fatal:
 		log.Err(err).Msg("Service failure")
 		return 1
-	case <-sigs:
+	case sig := <-sigs:
+		log.Info().Str("signal", sig.String()).Msg("Shutting down MAAS Agent")
+
+		// SIGHUP restarts the agent, so it is not a shutdown for the hook.
+		if cfg.PreShutdownHook != "" && sig != syscall.SIGHUP {
+			runPreShutdownHook(cfg.PreShutdownHook, cfg.preShutdownHookTimeout())
+		}
+
+		if err := lc.stop(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("Shutdown failure")
+		}
+
+		stats := workerPool.Stats()
+
+		log.Info().
+			Dur("uptime", time.Since(started)).
+			Int64("workflows", stats.Workflows).
+			Int64("activities", stats.Activities).
+			Bool("drained", drained).
+			Msg("Service MAAS Agent stopped")
+
+		return 0
+	case req := <-quiesce:
+		outstanding := workerPool.Stats().RunningActivities
+
+		log.Info().
+			Dur("timeout", req.timeout).
+			Int64("outstanding", outstanding).
+			Msg("Quiescing MAAS Agent")
+
+		if cfg.PreShutdownHook != "" {
+			runPreShutdownHook(cfg.PreShutdownHook, cfg.preShutdownHookTimeout())
+		}
+
+		// Other components are stopped once the response was sent, stopping
+		// the drained pool again is a no-op.
+		drained = drain(&workerPool, req.timeout)
+		stats := workerPool.Stats()
+
+		req.result <- quiesceResult{
+			Drained:     drained,
+			Outstanding: outstanding,
+			Remaining:   stats.RunningActivities,
+		}
+
+		// Give the handler a chance to respond before the process exits.
+		select {
+		case <-req.done:
+		case <-time.After(5 * time.Second):
+		}
+
+		log.Info().
+			Dur("uptime", time.Since(started)).
+			Int64("workflows", stats.Workflows).
+			Int64("activities", stats.Activities).
+			Bool("drained", drained).
+			Msg("Service MAAS Agent stopped")
+
 		return 0
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(Validate(os.Stdout, os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "exec" {
+		os.Exit(Exec(os.Stdout, os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(Doctor(os.Stdout, os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "manifest" {
+		os.Exit(Manifest(os.Stdout, os.Args[2:]))
+	}
+
 	os.Exit(Run())
 }
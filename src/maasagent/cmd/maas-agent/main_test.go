@@ -16,9 +16,30 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	temporalotel "go.temporal.io/sdk/contrib/opentelemetry"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/workflow"
+
+	"maas.io/core/src/maasagent/pkg/workflow/codec"
 )
 
 func TestGetRunDir(t *testing.T) {
@@ -80,3 +101,401 @@ func TestCertificatesDir(t *testing.T) {
 		})
 	}
 }
+
+func TestWatchErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	testcases := map[string]struct {
+		threshold int
+		window    time.Duration
+		calls     int
+	}{
+		"first error is fatal": {
+			threshold: 1,
+			window:    time.Minute,
+			calls:     1,
+		},
+		"zero threshold": {
+			threshold: 0,
+			window:    time.Minute,
+			calls:     1,
+		},
+		"threshold within window": {
+			threshold: 3,
+			window:    time.Minute,
+			calls:     3,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := 0
+
+			err := watchErrors(func() error {
+				calls++
+				return errBoom
+			}, tc.threshold, tc.window)
+
+			assert.ErrorIs(t, err, errBoom)
+			assert.Equal(t, tc.calls, calls)
+		})
+	}
+}
+
+func TestIsNamespaceNotFound(t *testing.T) {
+	testcases := map[string]struct {
+		in  error
+		out bool
+	}{
+		"namespace not found": {
+			in: fmt.Errorf("1 error(s) within 1m0s: %w",
+				serviceerror.NewNamespaceNotFound("default")),
+			out: true,
+		},
+		"other service error": {
+			in: serviceerror.NewUnavailable("unavailable"),
+		},
+		"other error": {
+			in: errors.New("boom"),
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.out, isNamespaceNotFound(tc.in))
+		})
+	}
+}
+
+func TestWatchErrorsToleratesErrorsOutsideWindow(t *testing.T) {
+	errBoom := errors.New("boom")
+	errLast := errors.New("last")
+
+	calls := 0
+
+	err := watchErrors(func() error {
+		calls++
+		// The last error comes right after the previous one and together
+		// they exceed the threshold.
+		if calls == 4 {
+			return errLast
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		return errBoom
+	}, 2, 5*time.Millisecond)
+
+	assert.ErrorIs(t, err, errLast)
+	assert.Equal(t, 4, calls)
+}
+
+// fakeDialer replaces dialTemporalClient with a function returning a mock
+// client after the given number of failed attempts.
+func fakeDialer(t *testing.T, failures int) *[]client.Options {
+	t.Helper()
+
+	var dialed []client.Options
+
+	orig := dialTemporalClient
+	t.Cleanup(func() { dialTemporalClient = orig })
+
+	dialTemporalClient = func(ctx context.Context, options client.Options) (client.Client, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("dial without a deadline")
+		}
+
+		dialed = append(dialed, options)
+		if len(dialed) <= failures {
+			return nil, errors.New("connection refused")
+		}
+
+		return &mocks.Client{}, nil
+	}
+
+	return &dialed
+}
+
+func TestGetTemporalClient(t *testing.T) {
+	testcases := map[string]struct {
+		failures int
+		attempts int
+	}{
+		"first attempt": {
+			failures: 0,
+			attempts: 1,
+		},
+		"retry after failure": {
+			failures: 1,
+			attempts: 2,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			dialed := fakeDialer(t, tc.failures)
+
+			cfg := &config{
+				SystemID:    "abcdef",
+				Secret:      "0123456789abcdef",
+				Controllers: []string{"10.0.0.1"},
+			}
+
+			c, _, err := getTemporalClient(cfg, tls.Certificate{}, x509.NewCertPool(),
+				temporalotel.NewMetricsHandler(temporalotel.MetricsHandlerOptions{
+					Meter: metricnoop.NewMeterProvider().Meter("temporal"),
+				}),
+				tracenoop.NewTracerProvider().Tracer("temporal"),
+				nil,
+			)
+
+			require.NoError(t, err)
+			assert.NotNil(t, c)
+			assert.Len(t, *dialed, tc.attempts)
+
+			for _, options := range *dialed {
+				assert.Equal(t, "10.0.0.1:5271", options.HostPort)
+				assert.Regexp(t, "^abcdef@agent:[0-9]+$", options.Identity)
+			}
+		})
+	}
+}
+
+func TestGetTemporalClientFailover(t *testing.T) {
+	dialed := fakeDialer(t, 1)
+
+	cfg := &config{
+		SystemID:    "abcdef",
+		Secret:      "0123456789abcdef",
+		Controllers: []string{"10.0.0.1", "10.0.0.2"},
+	}
+
+	c, endpoint, err := getTemporalClient(cfg, tls.Certificate{}, x509.NewCertPool(),
+		temporalotel.NewMetricsHandler(temporalotel.MetricsHandlerOptions{
+			Meter: metricnoop.NewMeterProvider().Meter("temporal"),
+		}),
+		tracenoop.NewTracerProvider().Tracer("temporal"),
+		nil,
+	)
+
+	require.NoError(t, err)
+	assert.NotNil(t, c)
+	require.Len(t, *dialed, 2)
+	assert.Equal(t, "10.0.0.1:5271", (*dialed)[0].HostPort)
+	assert.Equal(t, "10.0.0.2:5271", (*dialed)[1].HostPort)
+	assert.Equal(t, "10.0.0.2:5271", endpoint)
+}
+
+func TestGetTemporalClientInvalidSecret(t *testing.T) {
+	dialed := fakeDialer(t, 0)
+
+	cfg := &config{
+		SystemID:    "abcdef",
+		Secret:      "short",
+		Controllers: []string{"10.0.0.1"},
+	}
+
+	_, _, err := getTemporalClient(cfg, tls.Certificate{}, x509.NewCertPool(),
+		temporalotel.NewMetricsHandler(temporalotel.MetricsHandlerOptions{
+			Meter: metricnoop.NewMeterProvider().Meter("temporal"),
+		}),
+		tracenoop.NewTracerProvider().Tracer("temporal"),
+		nil,
+	)
+
+	assert.Error(t, err)
+	assert.Empty(t, *dialed)
+}
+
+func TestTemporalTarget(t *testing.T) {
+	testcases := map[string]struct {
+		dnsServer string
+		hostPort  string
+		out       string
+	}{
+		"system resolver": {
+			hostPort: "maas.internal:5271",
+			out:      "maas.internal:5271",
+		},
+		"dns server without port": {
+			dnsServer: "10.0.0.53",
+			hostPort:  "maas.internal:5271",
+			out:       "dns://10.0.0.53:53/maas.internal:5271",
+		},
+		"dns server with port": {
+			dnsServer: "10.0.0.53:5353",
+			hostPort:  "maas.internal:5271",
+			out:       "dns://10.0.0.53:5353/maas.internal:5271",
+		},
+		"ipv6 dns server": {
+			dnsServer: "fd00::53",
+			hostPort:  "maas.internal:5271",
+			out:       "dns://[fd00::53]:53/maas.internal:5271",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.out, temporalTarget(tc.dnsServer, tc.hostPort))
+		})
+	}
+}
+
+func TestNewPayloadCodecs(t *testing.T) {
+	testcases := map[string]struct {
+		codecs   []string
+		secret   string
+		encoding string
+		err      string
+	}{
+		"default": {
+			secret:   "0123456789abcdef",
+			encoding: "binary/encrypted",
+		},
+		"compress then encrypt": {
+			codecs:   []string{"compress", "encrypt"},
+			secret:   "0123456789abcdef",
+			encoding: "binary/encrypted",
+		},
+		"compress only": {
+			codecs:   []string{"compress"},
+			encoding: "binary/zlib",
+		},
+		"none": {
+			codecs:   []string{},
+			encoding: "json/plain",
+		},
+		"unknown codec": {
+			codecs: []string{"rot13"},
+			err:    `unknown codec "rot13"`,
+		},
+		"encrypt without secret": {
+			codecs: []string{"encrypt"},
+			err:    "secret is required",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			codecs, err := newPayloadCodecs(&config{Secret: tc.secret, Codecs: tc.codecs})
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			dc := converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), codecs...)
+
+			value := strings.Repeat("maas", 256)
+
+			payload, err := dc.ToPayload(value)
+			require.NoError(t, err)
+			assert.Equal(t, tc.encoding, string(payload.Metadata[converter.MetadataEncoding]))
+
+			var result string
+			require.NoError(t, dc.FromPayload(payload, &result))
+			assert.Equal(t, value, result)
+		})
+	}
+}
+
+func TestNewDataConverterTenants(t *testing.T) {
+	cfg := &config{
+		MAASUUID: "uuid-a",
+		Secret:   "0123456789abcdef",
+		Secrets:  map[string]string{"uuid-b": "fedcba9876543210"},
+	}
+
+	dc, err := newDataConverter(cfg)
+	require.NoError(t, err)
+
+	aware, ok := dc.(workflow.ContextAware)
+	require.True(t, ok)
+
+	payload, err := aware.WithContext(codec.WithTenant(context.Background(), "uuid-b")).
+		ToPayload("maas")
+	require.NoError(t, err)
+	assert.Equal(t, "uuid-b", string(payload.Metadata[codec.MetadataEncryptionKeyID]))
+
+	// Payloads of any configured installation can be decoded
+	var result string
+	require.NoError(t, dc.FromPayload(payload, &result))
+	assert.Equal(t, "maas", result)
+
+	payload.Metadata[codec.MetadataEncryptionKeyID] = []byte("uuid-c")
+	assert.ErrorIs(t, dc.FromPayload(payload, &result), codec.ErrUnknownTenant)
+}
+
+func TestNewDataConverterPassthrough(t *testing.T) {
+	cfg := &config{
+		MAASUUID: "uuid-a",
+		Secret:   "0123456789abcdef",
+		Secrets:  map[string]string{"uuid-b": "fedcba9876543210"},
+	}
+	cfg.Codec.PassthroughWorkflows = []string{"heartbeat"}
+
+	dc, err := newDataConverter(cfg)
+	require.NoError(t, err)
+	require.IsType(t, &codec.PassthroughDataConverter{}, dc)
+
+	// Context of a tenant outside of passthrough workflows is still used
+	payload, err := dc.(workflow.ContextAware).
+		WithContext(codec.WithTenant(context.Background(), "uuid-b")).
+		ToPayload("maas")
+	require.NoError(t, err)
+	assert.Equal(t, "uuid-b", string(payload.Metadata[codec.MetadataEncryptionKeyID]))
+
+	var result string
+	require.NoError(t, dc.FromPayload(payload, &result))
+	assert.Equal(t, "maas", result)
+}
+
+func TestSetupMetricsIdentityLabels(t *testing.T) {
+	var meterProvider metric.MeterProvider
+
+	mux := http.NewServeMux()
+
+	identity := identityAttributes(&config{SystemID: "abcdef", MAASUUID: "1234"})
+	require.NoError(t, setupMetrics(&meterProvider, mux, identity))
+
+	counter, err := meterProvider.Meter("test").Int64Counter("identity_test")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 1)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Regexp(t, `identity_test_total\{[^}]*maas_system_id="abcdef"`, rec.Body.String())
+	assert.Regexp(t, `identity_test_total\{[^}]*maas_uuid="1234"`, rec.Body.String())
+}
+
+func TestStartStagger(t *testing.T) {
+	assert.Zero(t, startStagger(0))
+	assert.Zero(t, startStagger(-time.Second))
+
+	for i := 0; i < 100; i++ {
+		delay := startStagger(time.Second)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.Less(t, delay, time.Second)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"slices"
+
+	"maas.io/core/src/maasagent/internal/dhcp"
+	"maas.io/core/src/maasagent/internal/httpproxy"
+	"maas.io/core/src/maasagent/internal/power"
+	"maas.io/core/src/maasagent/internal/workflow/worker"
+)
+
+// manifestVersion is a version of the agentManifest format, it should be
+// bumped on every change that is not backwards compatible.
+const manifestVersion = 1
+
+// agentManifest describes workflows, activities and power drivers supported
+// by the agent binary, so Region Controller can validate compatibility
+// ahead of deployment. Unlike agentCapabilities it does not depend on
+// configuration or runtime state.
+type agentManifest struct {
+	Version int `json:"version"`
+	// AgentVersion is a module version the binary was built from, if known
+	AgentVersion string           `json:"agent_version,omitempty"`
+	Workers      []manifestWorker `json:"workers"`
+	PowerDrivers []string         `json:"power_drivers"`
+}
+
+// manifestWorker describes workflows and activities registered on task
+// queues of a worker group, empty for the main worker.
+type manifestWorker struct {
+	Group      string   `json:"group,omitempty"`
+	Workflows  []string `json:"workflows,omitempty"`
+	Activities []string `json:"activities,omitempty"`
+}
+
+// Manifest prints agentManifest as JSON and returns exit code.
+// It neither reads configuration, nor connects to Temporal server.
+//
+// Usage: maas-agent manifest
+func Manifest(w io.Writer, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(w, "Usage: maas-agent manifest")
+		return 2
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(newAgentManifest()); err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	return 0
+}
+
+// newAgentManifest returns agentManifest of services registered by Run.
+// Services are constructed only to collect names of their workflows and
+// activities, so their dependencies are not set.
+func newAgentManifest() agentManifest {
+	powerService := power.NewPowerService("", nil)
+
+	// Load test service is left out on purpose, because it is not meant to
+	// be used by Region Controller.
+	configurators := []worker.Configurator{
+		powerService,
+		httpproxy.NewHTTPProxyService("", nil),
+		dhcp.NewDHCPService("", nil, nil),
+		&capabilitiesService{},
+	}
+
+	var mainWorker manifestWorker
+
+	for _, c := range configurators {
+		for name := range c.ConfigurationWorkflows() {
+			mainWorker.Workflows = append(mainWorker.Workflows, name)
+		}
+
+		for name := range c.ConfigurationActivities() {
+			mainWorker.Activities = append(mainWorker.Activities, name)
+		}
+	}
+
+	slices.Sort(mainWorker.Workflows)
+	slices.Sort(mainWorker.Activities)
+
+	powerWorker := powerService.WorkerRegistration()
+
+	m := agentManifest{
+		Version: manifestVersion,
+		Workers: []manifestWorker{mainWorker, {
+			Group:      powerWorker.Group,
+			Workflows:  powerWorker.Workflows,
+			Activities: powerWorker.Activities,
+		}},
+		PowerDrivers: power.RegisteredDrivers(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "(devel)" {
+		m.AgentVersion = info.Main.Version
+	}
+
+	return m
+}
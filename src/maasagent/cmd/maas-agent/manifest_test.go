@@ -0,0 +1,62 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"maas.io/core/src/maasagent/internal/power"
+)
+
+func TestManifest(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	require.Equal(t, 0, Manifest(&buf, nil))
+
+	var m agentManifest
+
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+
+	assert.Equal(t, manifestVersion, m.Version)
+	assert.Equal(t, power.RegisteredDrivers(), m.PowerDrivers)
+	require.Len(t, m.Workers, 2)
+
+	assert.Empty(t, m.Workers[0].Group)
+	assert.Contains(t, m.Workers[0].Workflows, "configure-power-service")
+	assert.Contains(t, m.Workers[0].Workflows, "agent-capabilities")
+	assert.NotContains(t, m.Workers[0].Workflows, "loadtest")
+	assert.IsNonDecreasing(t, m.Workers[0].Workflows)
+	assert.IsNonDecreasing(t, m.Workers[0].Activities)
+
+	assert.Equal(t, "power-service", m.Workers[1].Group)
+	assert.Contains(t, m.Workers[1].Activities, "power-on")
+}
+
+func TestManifestUsage(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	assert.Equal(t, 2, Manifest(&buf, []string{"extra"}))
+	assert.Contains(t, buf.String(), "Usage: maas-agent manifest")
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"maas.io/core/src/maasagent/internal/atomicfile"
+	"maas.io/core/src/maasagent/internal/pathutil"
+)
+
+const (
+	configFetchTimeout = 10 * time.Second
+	// configMaxSize limits size of configuration fetched from a remote URL
+	configMaxSize = 1 << 20
+)
+
+// configHTTPClient fetches configuration from remote URLs. Default client
+// verifies TLS certificates against the system roots.
+var configHTTPClient = http.DefaultClient
+
+// isConfigURL returns true if MAAS Agent configuration should be fetched
+// from name, rather than read from a file
+func isConfigURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// configCachePath returns path of the last configuration successfully fetched
+// from a remote URL
+func configCachePath() string {
+	if p := os.Getenv("MAAS_AGENT_CONFIG_CACHE"); p != "" {
+		return p
+	}
+
+	return pathutil.GetDataPath("agent/agent.yaml.cache")
+}
+
+// errInsecureConfigURL is returned when the bearer token would be sent to
+// a configuration URL in cleartext
+var errInsecureConfigURL = errors.New("MAAS_AGENT_CONFIG_TOKEN requires an https:// configuration URL")
+
+// fetchConfig fetches configuration from url, authenticating with a bearer
+// token from MAAS_AGENT_CONFIG_TOKEN, if it is set. Fetched configuration
+// that passes check is cached at cachePath, and the cached copy is returned
+// if the fetch or the check fails, so the agent can start while the remote
+// endpoint is unavailable or serves a broken configuration.
+func fetchConfig(url, cachePath string, check func([]byte) error) ([]byte, error) {
+	token := os.Getenv("MAAS_AGENT_CONFIG_TOKEN")
+	if token != "" && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("%w: %q", errInsecureConfigURL, url)
+	}
+
+	data, err := fetchRemoteConfig(url, token)
+	if err == nil {
+		err = check(data)
+	}
+
+	if err == nil {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+			log.Warn().Err(err).Msg("Failed caching fetched configuration")
+		} else if err := atomicfile.WriteFile(cachePath, data, 0600); err != nil {
+			log.Warn().Err(err).Msg("Failed caching fetched configuration")
+		}
+
+		return data, nil
+	}
+
+	cached, cacheErr := os.ReadFile(filepath.Clean(cachePath))
+	if cacheErr != nil {
+		return nil, fmt.Errorf("failed fetching %q: %w", url, errors.Join(err, cacheErr))
+	}
+
+	log.Warn().Err(err).Str("cache", cachePath).
+		Msg("Failed fetching configuration, using the last fetched copy")
+
+	return cached, nil
+}
+
+// checkFetchedConfig returns an error if configuration fetched from url
+// cannot be loaded or is not valid.
+func checkFetchedConfig(url string, data []byte) error {
+	data, err := decompressConfig(url, data)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return err
+	}
+
+	return cfg.validate()
+}
+
+func fetchRemoteConfig(url, token string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), configFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := configHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:errcheck // nothing to do if close fails
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, configMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > configMaxSize {
+		return nil, fmt.Errorf("configuration exceeds %d bytes", configMaxSize)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConfigURL(t *testing.T) {
+	data := []byte("system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\n")
+	invalid := []byte("controllers: [10.0.0.1]\n")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer token":
+			//nolint:errcheck // test server
+			w.Write(data)
+		case "Bearer invalid":
+			//nolint:errcheck // test server
+			w.Write(invalid)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	tlsSrv := httptest.NewTLSServer(handler)
+	t.Cleanup(tlsSrv.Close)
+
+	testcases := map[string]struct {
+		url       string
+		token     string
+		untrusted bool
+		cached    []byte
+		err       error
+		ok        bool
+	}{
+		"fetched": {
+			url:   tlsSrv.URL,
+			token: "token",
+			ok:    true,
+		},
+		"fetched without token over http": {
+			url:    srv.URL,
+			cached: data,
+			ok:     true,
+		},
+		"unauthorized": {
+			url:   tlsSrv.URL,
+			token: "wrong",
+			err:   ErrConfigNotFound,
+		},
+		"unauthorized with cached copy": {
+			url:    tlsSrv.URL,
+			token:  "wrong",
+			cached: data,
+			ok:     true,
+		},
+		"invalid": {
+			url:   tlsSrv.URL,
+			token: "invalid",
+			err:   ErrConfigNotFound,
+		},
+		"invalid with cached copy": {
+			url:    tlsSrv.URL,
+			token:  "invalid",
+			cached: data,
+			ok:     true,
+		},
+		"token over http": {
+			url:    srv.URL,
+			token:  "token",
+			cached: data,
+			err:    errInsecureConfigURL,
+		},
+		"untrusted certificate": {
+			url:       tlsSrv.URL,
+			token:     "token",
+			untrusted: true,
+			err:       ErrConfigNotFound,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			cache := filepath.Join(t.TempDir(), "agent", "agent.yaml.cache")
+			if tc.cached != nil {
+				require.NoError(t, os.MkdirAll(filepath.Dir(cache), 0700))
+				require.NoError(t, os.WriteFile(cache, tc.cached, 0600))
+			}
+
+			client := tlsSrv.Client()
+			if tc.untrusted {
+				client = http.DefaultClient
+			}
+
+			configHTTPClient = client
+			t.Cleanup(func() { configHTTPClient = http.DefaultClient })
+
+			t.Setenv("MAAS_AGENT_CONFIG", tc.url)
+			t.Setenv("MAAS_AGENT_CONFIG_TOKEN", tc.token)
+			t.Setenv("MAAS_AGENT_CONFIG_CACHE", cache)
+
+			cfg, err := getConfig()
+			if !tc.ok {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "abcdef", cfg.SystemID)
+
+			cached, err := os.ReadFile(cache)
+			require.NoError(t, err)
+			assert.Equal(t, data, cached)
+		})
+	}
+}
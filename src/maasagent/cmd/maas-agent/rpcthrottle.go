@@ -0,0 +1,127 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rpcThrottle is a gRPC client interceptor that limits rate of RPCs sent to
+// Temporal server and, when the server reports it is overloaded with
+// RESOURCE_EXHAUSTED, delays all the RPCs with an exponential backoff, so
+// agents ease the pressure instead of amplifying an outage.
+type rpcThrottle struct {
+	// limiter is nil if the rate is not limited
+	limiter    *rate.Limiter
+	now        func() time.Time
+	pausedTill time.Time
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	delay      time.Duration
+	mutex      sync.Mutex
+}
+
+// newRPCThrottle returns rpcThrottle allowing rps RPCs per second with the
+// given burst (no limit if rps <= 0), backing off between minBackoff and
+// maxBackoff on overload.
+func newRPCThrottle(rps float64, burst int,
+	minBackoff, maxBackoff time.Duration) *rpcThrottle {
+	t := &rpcThrottle{
+		now:        time.Now,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+	}
+
+	if rps > 0 {
+		t.limiter = rate.NewLimiter(rate.Limit(rps), max(burst, 1))
+	}
+
+	return t
+}
+
+// unaryInterceptor implements grpc.UnaryClientInterceptor.
+func (t *rpcThrottle) unaryInterceptor(ctx context.Context, method string,
+	req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption) error {
+	if err := t.wait(ctx); err != nil {
+		return err
+	}
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	t.observe(method, err)
+
+	return err
+}
+
+// wait blocks until RPC can be sent, or ctx is done.
+func (t *rpcThrottle) wait(ctx context.Context) error {
+	if t.limiter != nil {
+		if err := t.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	t.mutex.Lock()
+	d := t.pausedTill.Sub(t.now())
+	t.mutex.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// observe extends the backoff if err tells the server is overloaded, and
+// resets it once the server responds otherwise.
+func (t *rpcThrottle) observe(method string, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if status.Code(err) != codes.ResourceExhausted {
+		if t.delay > 0 {
+			log.Info().Msg("Temporal server is no longer overloaded, RPCs are not delayed")
+		}
+
+		t.delay = 0
+
+		return
+	}
+
+	if t.delay == 0 {
+		log.Warn().Err(err).Str("method", method).
+			Msg("Temporal server is overloaded, delaying RPCs")
+	}
+
+	t.delay = min(max(2*t.delay, t.minBackoff), t.maxBackoff)
+	t.pausedTill = t.now().Add(t.delay)
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRPCThrottleObserve(t *testing.T) {
+	overloaded := status.Error(codes.ResourceExhausted, "overloaded")
+
+	testcases := map[string]struct {
+		errs  []error
+		delay time.Duration
+	}{
+		"success": {
+			errs: []error{nil},
+		},
+		"other error": {
+			errs: []error{status.Error(codes.Unavailable, "unavailable")},
+		},
+		"overloaded once": {
+			errs:  []error{overloaded},
+			delay: 100 * time.Millisecond,
+		},
+		"overloaded doubles": {
+			errs:  []error{overloaded, overloaded, overloaded},
+			delay: 400 * time.Millisecond,
+		},
+		"overloaded capped": {
+			errs:  []error{overloaded, overloaded, overloaded, overloaded, overloaded},
+			delay: time.Second,
+		},
+		"reset on success": {
+			errs: []error{overloaded, overloaded, nil},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			now := time.Unix(0, 0)
+			throttle := newRPCThrottle(0, 0, 100*time.Millisecond, time.Second)
+			throttle.now = func() time.Time { return now }
+
+			for _, err := range tc.errs {
+				throttle.observe("/test", err)
+			}
+
+			assert.Equal(t, tc.delay, throttle.delay)
+
+			if tc.delay > 0 {
+				assert.Equal(t, now.Add(tc.delay), throttle.pausedTill)
+			}
+		})
+	}
+}
+
+func TestRPCThrottleWaitCanceled(t *testing.T) {
+	t.Parallel()
+
+	throttle := newRPCThrottle(0, 0, time.Hour, time.Hour)
+	throttle.observe("/test", status.Error(codes.ResourceExhausted, "overloaded"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, throttle.wait(ctx), context.DeadlineExceeded)
+}
+
+func TestRPCThrottleUnaryInterceptor(t *testing.T) {
+	t.Parallel()
+
+	throttle := newRPCThrottle(1000, 1, time.Millisecond, time.Millisecond)
+
+	var calls int
+
+	invoker := func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+
+		if calls == 1 {
+			return status.Error(codes.ResourceExhausted, "overloaded")
+		}
+
+		return nil
+	}
+
+	err := throttle.unaryInterceptor(context.Background(), "/test", nil, nil, nil, invoker)
+	require.Error(t, err)
+	assert.Equal(t, time.Millisecond, throttle.delay)
+
+	err = throttle.unaryInterceptor(context.Background(), "/test", nil, nil, nil, invoker)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Zero(t, throttle.delay)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = throttle.unaryInterceptor(ctx, "/test", nil, nil, nil, invoker)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 2, calls)
+}
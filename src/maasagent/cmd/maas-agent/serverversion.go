@@ -0,0 +1,154 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.temporal.io/api/workflowservice/v1"
+	"golang.org/x/mod/semver"
+)
+
+const defaultServerVersionCheckTimeout = 5 * time.Second
+
+// versionComparisonOperators are operators that can be used in
+// require_server_version, longest first so that ">=" is not parsed as ">".
+var versionComparisonOperators = []string{">=", "<=", ">", "<", "="}
+
+// versionComparison compares a version with the given one using op
+type versionComparison struct {
+	op      string
+	version string
+}
+
+// versionConstraint is a whitespace separated list of comparisons that all
+// must be satisfied, e.g. ">=1.22.0 <2.0.0". Version without an operator
+// must be matched exactly.
+type versionConstraint []versionComparison
+
+// parseVersionConstraint parses versionConstraint. Empty string is a valid
+// constraint satisfied by any version.
+func parseVersionConstraint(s string) (versionConstraint, error) {
+	fields := strings.Fields(s)
+	c := make(versionConstraint, 0, len(fields))
+
+	for _, f := range fields {
+		cmp := versionComparison{op: "=", version: f}
+
+		for _, op := range versionComparisonOperators {
+			if strings.HasPrefix(f, op) {
+				cmp = versionComparison{op: op, version: strings.TrimPrefix(f, op)}
+				break
+			}
+		}
+
+		cmp.version = canonicalVersion(cmp.version)
+		if cmp.version == "" {
+			return nil, fmt.Errorf("invalid version in %q", f)
+		}
+
+		c = append(c, cmp)
+	}
+
+	return c, nil
+}
+
+// satisfiedBy returns true if version satisfies all of the comparisons.
+// Version that cannot be parsed satisfies only an empty constraint.
+func (c versionConstraint) satisfiedBy(version string) bool {
+	if len(c) == 0 {
+		return true
+	}
+
+	v := canonicalVersion(version)
+	if v == "" {
+		return false
+	}
+
+	for _, cmp := range c {
+		res := semver.Compare(v, cmp.version)
+
+		var ok bool
+
+		switch cmp.op {
+		case ">=":
+			ok = res >= 0
+		case "<=":
+			ok = res <= 0
+		case ">":
+			ok = res > 0
+		case "<":
+			ok = res < 0
+		default:
+			ok = res == 0
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// canonicalVersion returns version in the format used by semver package,
+// or empty string if version is invalid.
+func canonicalVersion(version string) string {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+
+	return semver.Canonical(version)
+}
+
+// checkServerVersion logs version of Temporal server. If required is not
+// empty, an error is returned when the version cannot be fetched or does
+// not satisfy the constraint. Otherwise problems are only logged.
+func checkServerVersion(ctx context.Context, svc workflowservice.WorkflowServiceClient,
+	required string) error {
+	constraint, err := parseVersionConstraint(required)
+	if err != nil {
+		return fmt.Errorf("require_server_version: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultServerVersionCheckTimeout)
+	defer cancel()
+
+	info, err := svc.GetSystemInfo(ctx, &workflowservice.GetSystemInfoRequest{})
+	if err != nil {
+		if len(constraint) > 0 {
+			return fmt.Errorf("cannot check Temporal server version: %w", err)
+		}
+
+		log.Warn().Err(err).Msg("Cannot fetch Temporal server version")
+
+		return nil
+	}
+
+	version := info.GetServerVersion()
+
+	log.Info().Str("version", version).Msg("Temporal server version")
+
+	if !constraint.satisfiedBy(version) {
+		return fmt.Errorf("server version %q does not satisfy %q", version, required)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/api/workflowservice/v1"
+	"google.golang.org/grpc"
+)
+
+type fakeWorkflowService struct {
+	workflowservice.WorkflowServiceClient
+	version string
+	err     error
+}
+
+func (s *fakeWorkflowService) GetSystemInfo(context.Context,
+	*workflowservice.GetSystemInfoRequest,
+	...grpc.CallOption) (*workflowservice.GetSystemInfoResponse, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return &workflowservice.GetSystemInfoResponse{ServerVersion: s.version}, nil
+}
+
+func TestParseVersionConstraint(t *testing.T) {
+	testcases := map[string]struct {
+		in  string
+		out versionConstraint
+		err bool
+	}{
+		"empty": {in: "", out: versionConstraint{}},
+		"range": {
+			in: ">=1.22 <2.0.0",
+			out: versionConstraint{
+				{op: ">=", version: "v1.22.0"},
+				{op: "<", version: "v2.0.0"},
+			},
+		},
+		"exact":           {in: "v1.24.2", out: versionConstraint{{op: "=", version: "v1.24.2"}}},
+		"invalid":         {in: ">=latest", err: true},
+		"missing version": {in: ">=", err: true},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := parseVersionConstraint(tc.in)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, c)
+		})
+	}
+}
+
+func TestCheckServerVersion(t *testing.T) {
+	testcases := map[string]struct {
+		svc      *fakeWorkflowService
+		required string
+		err      bool
+	}{
+		"log only": {
+			svc: &fakeWorkflowService{version: "1.20.0"},
+		},
+		"log only unavailable": {
+			svc: &fakeWorkflowService{err: errors.New("unavailable")},
+		},
+		"satisfied": {
+			svc:      &fakeWorkflowService{version: "1.24.2"},
+			required: ">=1.22.0 <2.0.0",
+		},
+		"too old": {
+			svc:      &fakeWorkflowService{version: "1.20.0"},
+			required: ">=1.22.0 <2.0.0",
+			err:      true,
+		},
+		"unparsable version": {
+			svc:      &fakeWorkflowService{version: "dev"},
+			required: ">=1.22.0",
+			err:      true,
+		},
+		"required unavailable": {
+			svc:      &fakeWorkflowService{err: errors.New("unavailable")},
+			required: ">=1.22.0",
+			err:      true,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := checkServerVersion(context.Background(), tc.svc, tc.required)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// preShutdownHookWaitDelay is how long the hook output is still read after
+// the hook was killed on timeout, in case its children keep it open.
+const preShutdownHookWaitDelay = time.Second
+
+// runPreShutdownHook runs the hook executable with the given timeout and
+// logs its output. Failures are only logged, so the hook never prevents the
+// agent from shutting down.
+func runPreShutdownHook(path string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.WaitDelay = preShutdownHookWaitDelay
+
+	start := time.Now()
+	err := cmd.Run()
+
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	logger := log.With().Str("hook", path).
+		Dur("duration", time.Since(start)).
+		Str("output", strings.TrimSpace(out.String())).Logger()
+
+	if err != nil {
+		logger.Warn().Err(err).Msg("Pre-shutdown hook failed")
+		return
+	}
+
+	logger.Info().Msg("Pre-shutdown hook finished")
+}
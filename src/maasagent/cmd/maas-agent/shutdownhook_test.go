@@ -0,0 +1,75 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPreShutdownHook(t *testing.T) {
+	testcases := map[string]struct {
+		script string
+		out    []string
+	}{
+		"success": {
+			script: "#!/bin/sh\necho flushed\n",
+			out:    []string{"Pre-shutdown hook finished", "flushed"},
+		},
+		"failure": {
+			script: "#!/bin/sh\necho boom >&2\nexit 3\n",
+			out:    []string{"Pre-shutdown hook failed", "boom", "exit status 3"},
+		},
+		"timeout": {
+			script: "#!/bin/sh\nexec sleep 10\n",
+			out:    []string{"Pre-shutdown hook failed", "deadline exceeded"},
+		},
+	}
+
+	// The global logger is replaced, so test cases are not parallel.
+	orig := log.Logger
+	t.Cleanup(func() { log.Logger = orig })
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			hook := filepath.Join(t.TempDir(), "hook")
+			require.NoError(t, os.WriteFile(hook, []byte(tc.script), 0700))
+
+			var buf bytes.Buffer
+
+			log.Logger = zerolog.New(&buf)
+
+			start := time.Now()
+			runPreShutdownHook(hook, 100*time.Millisecond)
+
+			assert.Less(t, time.Since(start), 5*time.Second)
+
+			for _, s := range tc.out {
+				assert.Contains(t, buf.String(), s)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validate checks configuration file without starting MAAS Agent and
+// returns exit code. Path to the file is taken from args, otherwise the
+// same file as for MAAS Agent is used.
+//
+// Usage: maas-agent validate [path]
+func Validate(w io.Writer, args []string) int {
+	var (
+		cfg *config
+		err error
+	)
+
+	switch len(args) {
+	case 0:
+		cfg, err = getConfig()
+	case 1:
+		cfg, err = loadConfig(args[0])
+	default:
+		fmt.Fprintln(w, "Usage: maas-agent validate [path]")
+		return 2
+	}
+
+	if err == nil {
+		err = cfg.validate()
+	}
+
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	controllers, _ := normalizeControllers(cfg.Controllers)
+	cfg.Controllers, _ = uniqueControllers(controllers)
+
+	redacted, err := redactedConfig(cfg)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	data, err := yaml.Marshal(redacted)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+
+	fmt.Fprintf(w, "config OK\n%s", data)
+
+	return 0
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	testcases := map[string]struct {
+		data string
+		code int
+		out  []string
+	}{
+		"valid": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [grpc://10.0.0.1:5271]\n",
+			out: []string{
+				"config OK",
+				"secret: <redacted>",
+				"controllers:\n    - 10.0.0.1\n",
+			},
+		},
+		"missing system_id": {
+			data: "secret: 0123456789abcdef\ncontrollers: [10.0.0.1]\n",
+			code: 1,
+			out:  []string{"system_id is required"},
+		},
+		"no valid controllers": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1:abc]\n",
+			code: 1,
+			out:  []string{"at least one valid controller is required"},
+		},
+		"invalid secret": {
+			data: "system_id: abcdef\nsecret: short\ncontrollers: [10.0.0.1]\n",
+			code: 1,
+			out:  []string{"failed setting up encryption codec"},
+		},
+		"fast start": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nfast_start: true\n",
+			out:  []string{"config OK", "fast_start: true"},
+		},
+		"fast start with invalid secret": {
+			data: "system_id: abcdef\nsecret: short\ncontrollers: [10.0.0.1]\nfast_start: true\n",
+			code: 1,
+			out:  []string{"failed setting up encryption codec"},
+		},
+		"unknown bmc lock mode": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {bmc_lock_mode: sometimes}\n",
+			code: 1,
+			out:  []string{"power.bmc_lock_mode"},
+		},
+		"relative exec power command": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {exec_commands: {pdu: \"pdu {action}\"}}\n",
+			code: 1,
+			out:  []string{"power.exec_commands"},
+		},
+		"circuit breaker without cooldown": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {circuit_breaker: {failure_threshold: 3, window: 1m}}\n",
+			code: 1,
+			out:  []string{"power.circuit_breaker"},
+		},
+		"invalid bmc allowed cidr": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {bmc_allowed_cidrs: [10.0.0.0/33]}\n",
+			code: 1,
+			out:  []string{"power.bmc_allowed_cidrs"},
+		},
+		"bmc retry without interval": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {bmc_retry: {max_retries: 3}}\n",
+			code: 1,
+			out:  []string{"power.bmc_retry"},
+		},
+		"power history without retention": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {history: {size: 10}}\n",
+			code: 1,
+			out:  []string{"power.history.retention"},
+		},
+		"vault secret provider without token": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {secret_provider: {type: vault, vault_address: https://vault:8200}}\n",
+			code: 1,
+			out:  []string{"power.secret_provider"},
+		},
+		"negative settle delay": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {settle_delay: -1s}\n",
+			code: 1,
+			out:  []string{"power.settle_delay"},
+		},
+		"unknown boot target": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {boot_profiles: {deploy: [disk, floppy]}}\n",
+			code: 1,
+			out:  []string{"power.boot_profiles"},
+		},
+		"allowed signals without token": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nadmin: {allowed_signals: [confirm]}\n",
+			code: 1,
+			out:  []string{"admin.signal_token"},
+		},
+		"grpc keepalive too frequent": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\ngrpc_keepalive: {time: 1s}\n",
+			code: 1,
+			out:  []string{"grpc_keepalive.time"},
+		},
+		"result webhook with unsupported scheme": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nresult_webhook: {url: ftp://example.com}\n",
+			code: 1,
+			out:  []string{"result_webhook.url"},
+		},
+		"unknown backoff strategy": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nbackoff_strategy: linear\n",
+			code: 1,
+			out:  []string{"backoff_strategy"},
+		},
+		"negative clock skew warning threshold": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nworker_pool: {clock_skew_warning_threshold: -1s}\n",
+			code: 1,
+			out:  []string{"worker_pool.clock_skew_warning_threshold"},
+		},
+		"negative max concurrent workflows": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nworker_pool: {max_concurrent_workflows: -1}\n",
+			code: 1,
+			out:  []string{"worker_pool.max_concurrent_workflows"},
+		},
+		"negative start stagger": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nworker_pool: {start_stagger: -1s}\n",
+			code: 1,
+			out:  []string{"worker_pool.start_stagger"},
+		},
+		"negative dial timeout": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\ndial_timeout: -1s\n",
+			code: 1,
+			out:  []string{"dial_timeout"},
+		},
+		"negative codec decode retries": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\ncodec: {decode_retries: -1}\n",
+			code: 1,
+			out:  []string{"codec.decode_retries"},
+		},
+		"grpc message limit below payload limit": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\ngrpc_max_message_bytes: 1048576\n",
+			code: 1,
+			out:  []string{"grpc_max_message_bytes"},
+		},
+		"negative http server limit": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nhttp_server: {max_connections: -1}\n",
+			code: 1,
+			out:  []string{"http_server"},
+		},
+		"negative rpc throttle": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nrpc_throttle: {rate: -1}\n",
+			code: 1,
+			out:  []string{"rpc_throttle"},
+		},
+		"invalid required server version": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nrequire_server_version: \">=latest\"\n",
+			code: 1,
+			out:  []string{"require_server_version"},
+		},
+		"invalid power metric label": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npower: {metric_labels: [zone, Rack-Name]}\n",
+			code: 1,
+			out:  []string{"power.metric_labels"},
+		},
+		"relative pre-shutdown hook": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\npre_shutdown_hook: hook.sh\n",
+			code: 1,
+			out:  []string{"pre_shutdown_hook"},
+		},
+		"unknown shutdown signal": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nshutdown_signals: [TERM, STOP]\n",
+			code: 1,
+			out:  []string{"shutdown_signals"},
+		},
+		"invalid log level": {
+			data: "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\nlog_level: loud\n",
+			code: 1,
+			out:  []string{"log_level"},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			fname := filepath.Join(t.TempDir(), "agent.yaml")
+			require.NoError(t, os.WriteFile(fname, []byte(tc.data), 0600))
+
+			var out bytes.Buffer
+
+			assert.Equal(t, tc.code, Validate(&out, []string{fname}))
+
+			for _, s := range tc.out {
+				assert.Contains(t, out.String(), s)
+			}
+
+			assert.NotContains(t, out.String(), "0123456789abcdef")
+		})
+	}
+}
+
+func TestValidateUsage(t *testing.T) {
+	var out bytes.Buffer
+
+	assert.Equal(t, 2, Validate(&out, []string{"a.yaml", "b.yaml"}))
+	assert.Contains(t, out.String(), "Usage: maas-agent validate [path]")
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// configWatchDebounce is for how long the configuration file should remain
+// unchanged before it is considered, so partial writes are not acted upon.
+const configWatchDebounce = 2 * time.Second
+
+// watchConfig calls onChange every time the configuration file fname was
+// changed and its new content is valid, until ctx is cancelled. Invalid
+// configuration is logged and ignored. The directory of the file is watched,
+// so the file can be replaced, as configuration management tools often do.
+func watchConfig(ctx context.Context, fname string, debounce time.Duration,
+	onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Close()
+
+	fname = filepath.Clean(fname)
+
+	if err := watcher.Add(filepath.Dir(fname)); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if filepath.Clean(event.Name) != fname || event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			log.Warn().Err(err).Str("file", fname).Msg("Configuration file watch error")
+		case <-timer.C:
+			cfg, err := loadConfig(fname)
+			if err == nil {
+				err = cfg.validate()
+			}
+
+			if err != nil {
+				log.Error().Err(err).Str("file", fname).
+					Msg("Ignoring change of configuration file, configuration is invalid")
+
+				continue
+			}
+
+			log.Info().Str("file", fname).Msg("Configuration file changed")
+
+			onChange()
+		}
+	}
+}
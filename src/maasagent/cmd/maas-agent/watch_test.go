@@ -0,0 +1,87 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchConfig(t *testing.T) {
+	valid := "system_id: abcdef\nsecret: 0123456789abcdef\ncontrollers: [10.0.0.1]\n"
+
+	testcases := map[string]struct {
+		writes  []string
+		changes int
+	}{
+		"change": {
+			writes:  []string{valid + "log_level: debug\n"},
+			changes: 1,
+		},
+		"partial writes": {
+			writes:  []string{"system_id: abcdef\n", valid + "log_level: debug\n"},
+			changes: 1,
+		},
+		"invalid change": {
+			writes: []string{"secret: 0123456789abcdef\n"},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			fname := filepath.Join(t.TempDir(), "agent.yaml")
+			require.NoError(t, os.WriteFile(fname, []byte(valid), 0600))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			changes := make(chan struct{}, 10)
+			done := make(chan error)
+
+			go func() {
+				done <- watchConfig(ctx, fname, 100*time.Millisecond,
+					func() { changes <- struct{}{} })
+			}()
+
+			// Let the watcher start
+			time.Sleep(50 * time.Millisecond)
+
+			// Unrelated files are ignored
+			require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(fname), "other"),
+				[]byte("data"), 0600))
+
+			for _, data := range tc.writes {
+				require.NoError(t, os.WriteFile(fname, []byte(data), 0600))
+			}
+
+			time.Sleep(300 * time.Millisecond)
+			cancel()
+
+			assert.NoError(t, <-done)
+			assert.Len(t, changes, tc.changes)
+		})
+	}
+}
@@ -55,3 +55,16 @@ func (c *FakeFileCache) Get(key string) (io.ReadSeekCloser, error) {
 
 	return data, nil
 }
+
+func (c *FakeFileCache) Delete(key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.storage[key]; !ok {
+		return ErrKeyDoesntExist
+	}
+
+	delete(c.storage, key)
+
+	return nil
+}
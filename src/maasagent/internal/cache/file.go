@@ -305,11 +305,31 @@ func (c *FileCache) get(key string) (io.ReadSeekCloser, error) {
 	return file, err
 }
 
+// Delete removes the value with the given key from cache, e.g. because its
+// content turned out to be corrupted.
+func (c *FileCache) Delete(key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	idx, ok := c.index.Peek(key)
+	if !ok {
+		return ErrKeyDoesntExist
+	}
+
+	return c.remove(key, idx)
+}
+
 // evict removes the oldest item from cache.
 // Should be used only during add operation if new item doesn't fit.
 func (c *FileCache) evict() error {
 	key, idx, _ := c.index.GetOldest()
 
+	return c.remove(key, idx)
+}
+
+// remove removes file of the item and the item from the index.
+// Should be used only with the mutex held.
+func (c *FileCache) remove(key, idx string) error {
 	stat, err := os.Stat(idx)
 	if err != nil {
 		return err
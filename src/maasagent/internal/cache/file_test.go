@@ -367,6 +367,27 @@ func (r *lockedReader) unlock() {
 	close(r.ch)
 }
 
+func TestFileCacheDelete(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := NewFileCache(10, dir)
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Set("key", strings.NewReader("value"), 5))
+	assert.Equal(t, int64(5), cache.size.Load())
+
+	require.NoError(t, cache.Delete("key"))
+	assert.Equal(t, int64(0), cache.size.Load())
+	assert.NoFileExists(t, path.Join(dir, "key"))
+
+	_, err = cache.Get("key")
+	assert.ErrorIs(t, err, ErrKeyDoesntExist)
+	assert.ErrorIs(t, cache.Delete("key"), ErrKeyDoesntExist)
+
+	// Deleted key can be set again.
+	require.NoError(t, cache.Set("key", strings.NewReader("value"), 5))
+}
+
 func TestFileCacheConcurrentSet(t *testing.T) {
 	cache, err := NewFileCache(1, t.TempDir())
 	if err != nil {
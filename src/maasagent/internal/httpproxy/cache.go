@@ -60,6 +60,7 @@ func (r *CacheRule) getKey(req *http.Request) (string, bool) {
 type Cache interface {
 	Set(key string, value io.Reader, valueSize int64) error
 	Get(key string) (io.ReadSeekCloser, error)
+	Delete(key string) error
 }
 
 type Cacher struct {
@@ -0,0 +1,206 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package httpproxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.temporal.io/sdk/activity"
+	"maas.io/core/src/maasagent/internal/cache"
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+var (
+	// ErrNotConfigured is returned when boot resources are requested before
+	// the service was configured with Region Controller endpoints.
+	ErrNotConfigured = errors.New("httpproxy-service is not configured")
+	// ErrChecksumMismatch is returned when content of a boot resource does not
+	// match the expected SHA256 checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// FetchBootResourceParam is the activity parameter for fetching a boot
+// resource (e.g. kernel, initrd or image) from the Region Controller.
+type FetchBootResourceParam struct {
+	// Path is relative to the Region Controller endpoint,
+	// e.g. boot-resources/<sha256>/ubuntu/amd64/ga-24.04/noble/stable/boot-kernel
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// FetchBootResourceResult is the result of fetching a boot resource
+type FetchBootResourceResult struct {
+	// Key under which the boot resource can be retrieved from the cache
+	Key    string `json:"key"`
+	Cached bool   `json:"cached"`
+}
+
+// FetchBootResource ensures that a boot resource is present in the local cache.
+// Resources are keyed by their checksum, so the same image requested by
+// multiple deployments is downloaded only once. Integrity is verified both
+// before storing the resource and before reusing a cached copy.
+func (s *HTTPProxyService) FetchBootResource(ctx context.Context,
+	param FetchBootResourceParam) (FetchBootResourceResult, error) {
+	log := activity.GetLogger(ctx)
+
+	key := strings.ToLower(param.SHA256)
+	result := FetchBootResourceResult{Key: key}
+
+	if _, err := hex.DecodeString(key); err != nil || len(key) != sha256.Size*2 {
+		return result, fmt.Errorf("invalid sha256 checksum %q", param.SHA256)
+	}
+
+	err := s.verifyCached(key)
+	if err == nil {
+		result.Cached = true
+		return result, nil
+	}
+
+	// Corrupted copy would fail every retry, so it is fetched again.
+	if errors.Is(err, ErrChecksumMismatch) {
+		log.Warn("Cached boot resource is corrupted, fetching it again",
+			tag.Builder().Error(err).KV("path", param.Path).KeyVals...)
+
+		err = s.cache.Delete(key)
+		if err == nil {
+			err = cache.ErrKeyDoesntExist
+		}
+	}
+
+	if !errors.Is(err, cache.ErrKeyDoesntExist) {
+		return result, err
+	}
+
+	proxy := s.proxy.Load()
+	if proxy == nil {
+		return result, ErrNotConfigured
+	}
+
+	if s.fetches != nil {
+		if err := s.fetches.Acquire(ctx, 1); err != nil {
+			return result, err
+		}
+
+		defer s.fetches.Release(1)
+	}
+
+	// Region Controller endpoints might be flaky, so we try every known target
+	// before giving up and let Temporal retry the activity.
+	var errs []error
+
+	for _, target := range proxy.targets {
+		err = s.fetch(ctx, target.JoinPath(param.Path).String(), key, param.Size)
+		if err == nil || errors.Is(err, cache.ErrKeyExist) {
+			return result, nil
+		}
+
+		log.Warn("Failed to fetch boot resource", tag.Builder().Error(err).
+			KV("target", target.String()).
+			KV("path", param.Path).KeyVals...)
+
+		errs = append(errs, err)
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// verifyCached checks if a cached value with the given key exists and its
+// content matches the checksum.
+func (s *HTTPProxyService) verifyCached(key string) error {
+	r, err := s.cache.Get(key)
+	if err != nil {
+		return err
+	}
+
+	//nolint:errcheck // nothing to do if close fails on a read-only file
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != key {
+		return fmt.Errorf("cached boot resource %s: %w", key, ErrChecksumMismatch)
+	}
+
+	return nil
+}
+
+func (s *HTTPProxyService) fetch(ctx context.Context, url, key string,
+	size int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	//nolint:errcheck // response body is fully consumed or discarded
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %q fetching %s", resp.Status, url)
+	}
+
+	if size <= 0 {
+		size = resp.ContentLength
+	}
+
+	var body io.Reader = resp.Body
+	if s.fetchLimiter != nil {
+		body = &throttledReader{ctx: ctx, r: body, limiter: s.fetchLimiter}
+	}
+
+	// Value is verified while being written to the cache, and in case of
+	// a mismatch the cache discards partially written content.
+	return s.cache.Set(key, &verifyingReader{
+		r:        body,
+		h:        sha256.New(),
+		checksum: key,
+	}, size)
+}
+
+// verifyingReader computes checksum of the data read from the underlying
+// reader and returns ErrChecksumMismatch instead of io.EOF if it differs.
+type verifyingReader struct {
+	r        io.Reader
+	h        hash.Hash
+	checksum string
+}
+
+func (v *verifyingReader) Read(b []byte) (int, error) {
+	n, err := v.r.Read(b)
+	v.h.Write(b[:n])
+
+	if errors.Is(err, io.EOF) && hex.EncodeToString(v.h.Sum(nil)) != v.checksum {
+		return n, ErrChecksumMismatch
+	}
+
+	return n, err
+}
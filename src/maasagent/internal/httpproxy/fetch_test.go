@@ -0,0 +1,228 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package httpproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+	"maas.io/core/src/maasagent/internal/cache"
+)
+
+func TestFetchBootResource(t *testing.T) {
+	content := []byte("boot-kernel")
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	testcases := map[string]struct {
+		body       []byte
+		cached     []byte
+		checksum   string
+		configured bool
+		calls      int
+		want       []FetchBootResourceResult
+		err        string
+	}{
+		"fetch once and reuse cached copy": {
+			body:       content,
+			checksum:   checksum,
+			configured: true,
+			calls:      1,
+			want: []FetchBootResourceResult{
+				{Key: checksum},
+				{Key: checksum, Cached: true},
+			},
+		},
+		"corrupted cached copy is fetched again": {
+			body:       content,
+			cached:     []byte("corrupted"),
+			checksum:   checksum,
+			configured: true,
+			calls:      1,
+			want: []FetchBootResourceResult{
+				{Key: checksum},
+				{Key: checksum, Cached: true},
+			},
+		},
+		"checksum mismatch": {
+			body:       []byte("corrupted"),
+			checksum:   checksum,
+			configured: true,
+			calls:      1,
+			err:        ErrChecksumMismatch.Error(),
+		},
+		"invalid checksum": {
+			body:       content,
+			checksum:   "abc",
+			configured: true,
+			err:        "invalid sha256 checksum",
+		},
+		"not configured": {
+			body:     content,
+			checksum: checksum,
+			err:      ErrNotConfigured.Error(),
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls atomic.Int32
+
+			upstream := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					calls.Add(1)
+					assert.Equal(t, "/boot-resources/kernel", r.URL.Path)
+					w.Write(tc.body)
+				}))
+			t.Cleanup(upstream.Close)
+
+			fileCache, err := cache.NewFileCache(1024, t.TempDir())
+			require.NoError(t, err)
+
+			if tc.cached != nil {
+				require.NoError(t, fileCache.Set(tc.checksum,
+					bytes.NewReader(tc.cached), int64(len(tc.cached))))
+			}
+
+			svc := NewHTTPProxyService(t.TempDir(), fileCache)
+
+			if tc.configured {
+				target, err := url.Parse(upstream.URL)
+				require.NoError(t, err)
+
+				proxy, err := NewProxy([]*url.URL{target})
+				require.NoError(t, err)
+				svc.proxy.Store(proxy)
+			}
+
+			suite := testsuite.WorkflowTestSuite{}
+			env := suite.NewTestActivityEnvironment()
+			env.RegisterActivity(svc.FetchBootResource)
+
+			param := FetchBootResourceParam{
+				Path:   "boot-resources/kernel",
+				SHA256: tc.checksum,
+				Size:   int64(len(tc.body)),
+			}
+
+			if tc.err != "" {
+				_, err := env.ExecuteActivity(svc.FetchBootResource, param)
+				assert.ErrorContains(t, err, tc.err)
+
+				// Content that failed verification must not be cached.
+				_, err = fileCache.Get(tc.checksum)
+				assert.ErrorIs(t, err, cache.ErrKeyDoesntExist)
+			}
+
+			for _, want := range tc.want {
+				res, err := env.ExecuteActivity(svc.FetchBootResource, param)
+				require.NoError(t, err)
+
+				var result FetchBootResourceResult
+				require.NoError(t, res.Get(&result))
+				assert.Equal(t, want, result)
+			}
+
+			assert.Equal(t, tc.calls, int(calls.Load()))
+
+			if len(tc.want) > 0 {
+				r, err := fileCache.Get(tc.checksum)
+				require.NoError(t, err)
+
+				data, err := io.ReadAll(r)
+				require.NoError(t, err)
+				assert.Equal(t, content, data)
+				assert.NoError(t, r.Close())
+			}
+		})
+	}
+}
+
+func TestFetchBootResourceMaxConcurrentFetches(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(r.URL.Path))
+		}))
+	t.Cleanup(upstream.Close)
+
+	fileCache, err := cache.NewFileCache(1024, t.TempDir())
+	require.NoError(t, err)
+
+	svc := NewHTTPProxyService(t.TempDir(), fileCache, WithMaxConcurrentFetches(1))
+
+	target, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	proxy, err := NewProxy([]*url.URL{target})
+	require.NoError(t, err)
+	svc.proxy.Store(proxy)
+
+	var wg sync.WaitGroup
+
+	for _, name := range []string{"kernel", "initrd", "squashfs"} {
+		path := "/boot-resources/" + name
+		sum := sha256.Sum256([]byte(path))
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			suite := testsuite.WorkflowTestSuite{}
+			env := suite.NewTestActivityEnvironment()
+			env.RegisterActivity(svc.FetchBootResource)
+
+			_, err := env.ExecuteActivity(svc.FetchBootResource, FetchBootResourceParam{
+				Path:   path,
+				SHA256: hex.EncodeToString(sum[:]),
+				Size:   int64(len(path)),
+			})
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), maxInFlight.Load())
+}
@@ -22,10 +22,14 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	tworkflow "go.temporal.io/sdk/workflow"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+	"maas.io/core/src/maasagent/internal/workflow"
 	"maas.io/core/src/maasagent/internal/workflow/log/tag"
 )
 
@@ -60,19 +64,72 @@ var (
 // HTTPProxyService is a service that is used to proxy HTTP requests to the Region.
 // Invocation of this service normally should happen via Temporal.
 type HTTPProxyService struct {
-	listener   net.Listener
-	cache      Cache
-	proxy      *Proxy
-	fatal      chan error
-	socketPath string
+	listener               net.Listener
+	cache                  Cache
+	fatal                  chan error
+	socketPath             string
+	scheduleToStartTimeout time.Duration
+	// fetches limits number of boot resources written to the cache concurrently
+	fetches *semaphore.Weighted
+	// fetchLimiter limits total download rate of boot resources
+	fetchLimiter *rate.Limiter
+	// proxy is replaced by the configuration workflow, while activities
+	// read it
+	proxy atomic.Pointer[Proxy]
 }
 
+// HTTPProxyServiceOption allows to set additional HTTPProxyService options
+type HTTPProxyServiceOption func(*HTTPProxyService)
+
 // NewHTTPProxyService returns an instance of HTTPProxyService
-// TODO: consider switching to opts pattern
-func NewHTTPProxyService(socketDir string, cache Cache) *HTTPProxyService {
+func NewHTTPProxyService(socketDir string, cache Cache,
+	options ...HTTPProxyServiceOption) *HTTPProxyService {
 	socketPath := path.Join(socketDir, socketFileName)
 
-	return &HTTPProxyService{cache: cache, socketPath: socketPath}
+	s := &HTTPProxyService{
+		cache:                  cache,
+		socketPath:             socketPath,
+		scheduleToStartTimeout: workflow.DefaultScheduleToStartTimeout,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithScheduleToStartTimeout sets ScheduleToStart timeout for activities
+// scheduled by the httpproxy service configuration workflow on the Region
+// task queue. (default: workflow.DefaultScheduleToStartTimeout)
+func WithScheduleToStartTimeout(timeout time.Duration) HTTPProxyServiceOption {
+	return func(s *HTTPProxyService) {
+		s.scheduleToStartTimeout = timeout
+	}
+}
+
+// WithMaxConcurrentFetches limits number of boot resources fetched into the
+// cache at the same time. Fetches beyond the limit wait for a slot, so burst
+// deployments don't exhaust memory and disk bandwidth of the controller.
+// Value <= 0 means no limit. (default: 0)
+func WithMaxConcurrentFetches(n int64) HTTPProxyServiceOption {
+	return func(s *HTTPProxyService) {
+		if n > 0 {
+			s.fetches = semaphore.NewWeighted(n)
+		} else {
+			s.fetches = nil
+		}
+	}
+}
+
+// WithMaxFetchRate limits total rate in bytes per second at which boot
+// resources are downloaded from the Region Controller. The rate is shared by
+// concurrent fetches, so deployment bursts don't saturate the uplink.
+// Value <= 0 means no limit. (default: 0)
+func WithMaxFetchRate(bytesPerSecond int64) HTTPProxyServiceOption {
+	return func(s *HTTPProxyService) {
+		s.fetchLimiter = newFetchLimiter(bytesPerSecond)
+	}
 }
 
 type getRegionEndpointsResult struct {
@@ -84,7 +141,7 @@ func (s *HTTPProxyService) ConfigurationWorkflows() map[string]interface{} {
 }
 
 func (s *HTTPProxyService) ConfigurationActivities() map[string]interface{} {
-	return map[string]interface{}{}
+	return map[string]interface{}{"fetch-boot-resource": s.FetchBootResource}
 }
 
 func (s *HTTPProxyService) configure(ctx tworkflow.Context, systemID string) error {
@@ -110,10 +167,12 @@ func (s *HTTPProxyService) configure(ctx tworkflow.Context, systemID string) err
 		tworkflow.WithActivityOptions(ctx,
 			tworkflow.ActivityOptions{
 				TaskQueue:              "region",
+				ScheduleToStartTimeout: s.scheduleToStartTimeout,
 				ScheduleToCloseTimeout: 60 * time.Second,
 			}),
 		"get-region-controller-endpoints").
 		Get(ctx, &endpointsResult); err != nil {
+		workflow.ReportScheduleToStartTimeout(ctx, "get-region-controller-endpoints", "region", err)
 		return err
 	}
 
@@ -165,9 +224,7 @@ func (s *HTTPProxyService) configure(ctx tworkflow.Context, systemID string) err
 	//nolint:errcheck // nothing to check here
 	_ = tworkflow.Await(ctx, func() bool { return counter == 0 })
 
-	var err error
-
-	s.proxy, err = NewProxy(targets,
+	proxy, err := NewProxy(targets,
 		WithRewriter(NewRewriter(rewriteRules)),
 		WithCacher(NewCacher(cacheRules, s.cache)),
 	)
@@ -175,6 +232,8 @@ func (s *HTTPProxyService) configure(ctx tworkflow.Context, systemID string) err
 		return err
 	}
 
+	s.proxy.Store(proxy)
+
 	s.listener, err = net.Listen("unix", s.socketPath)
 	if err != nil {
 		return err
@@ -189,7 +248,7 @@ func (s *HTTPProxyService) configure(ctx tworkflow.Context, systemID string) err
 	// there is nothing bad about not setting the timeout on the listener/server
 
 	//nolint:gosec // this is okay in the current situation
-	go func() { s.fatal <- http.Serve(s.listener, s.proxy) }()
+	go func() { s.fatal <- http.Serve(s.listener, proxy) }()
 
 	log.Info("Starting httpproxy-service", tag.Builder().KV("targets", targets).KeyVals...)
 	// We consider this workflow to be successful without checking if the service
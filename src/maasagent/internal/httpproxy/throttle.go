@@ -0,0 +1,61 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package httpproxy
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// maxFetchBurst is the largest chunk of a boot resource read at once when
+// fetches are rate limited. Small chunks let concurrent fetches share the
+// available bandwidth fairly.
+const maxFetchBurst = 64 * 1024
+
+// newFetchLimiter returns rate.Limiter allowing bytesPerSecond shared by all
+// the fetches, or nil if bytesPerSecond <= 0.
+func newFetchLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(min(bytesPerSecond, maxFetchBurst)))
+}
+
+// throttledReader waits for limiter after every read from the underlying
+// reader, so the rate of all the readers sharing the limiter is bounded.
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(b []byte) (int, error) {
+	if burst := t.limiter.Burst(); len(b) > burst {
+		b = b[:burst]
+	}
+
+	n, err := t.r.Read(b)
+	if n > 0 {
+		if werr := t.limiter.WaitN(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
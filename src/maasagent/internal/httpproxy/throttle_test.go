@@ -0,0 +1,85 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package httpproxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFetchLimiter(t *testing.T) {
+	assert.Nil(t, newFetchLimiter(0))
+	assert.Nil(t, newFetchLimiter(-1))
+	assert.Equal(t, 1024, newFetchLimiter(1024).Burst())
+	assert.Equal(t, maxFetchBurst, newFetchLimiter(1024*1024).Burst())
+}
+
+func TestThrottledReaderSharedLimit(t *testing.T) {
+	const (
+		rate = 1024 * 1024
+		size = 128 * 1024
+	)
+
+	limiter := newFetchLimiter(rate)
+	content := bytes.Repeat([]byte("x"), size)
+
+	var wg sync.WaitGroup
+
+	start := time.Now()
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			data, err := io.ReadAll(&throttledReader{
+				ctx:     context.Background(),
+				r:       bytes.NewReader(content),
+				limiter: limiter,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, content, data)
+		}()
+	}
+
+	wg.Wait()
+
+	// Both readers share the limit, so everything beyond the initial burst
+	// is read at the limited rate.
+	assert.GreaterOrEqual(t, time.Since(start),
+		time.Duration(2*size-maxFetchBurst)*time.Second/rate)
+}
+
+func TestThrottledReaderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := &throttledReader{
+		ctx:     ctx,
+		r:       bytes.NewReader(make([]byte, 1024)),
+		limiter: newFetchLimiter(1024),
+	}
+
+	_, err := io.ReadAll(r)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// MaxActivities is a maximum number of activities a single load test
+	// workflow can schedule
+	MaxActivities = 1000
+	// MaxPayloadBytes is a maximum size of a payload passed to and returned
+	// by each activity
+	MaxPayloadBytes = 1 << 20
+	// MaxWorkDuration is a maximum of sleep and spin durations per activity
+	MaxWorkDuration = 10 * time.Minute
+)
+
+// LoadTestService provides a workflow doing configurable artificial work,
+// so it is possible to drive load through the full path of the agent
+// (payload codecs and worker pool) for capacity planning.
+// It must not be enabled in production.
+type LoadTestService struct{}
+
+func NewLoadTestService() *LoadTestService {
+	return &LoadTestService{}
+}
+
+func (s *LoadTestService) ConfigurationWorkflows() map[string]interface{} {
+	return map[string]interface{}{"loadtest": s.loadTest}
+}
+
+func (s *LoadTestService) ConfigurationActivities() map[string]interface{} {
+	return map[string]interface{}{"loadtest-work": s.work}
+}
+
+// LoadTestParam is a parameter of the loadtest workflow
+type LoadTestParam struct {
+	// Activities is a number of activities executed concurrently
+	Activities int `json:"activities"`
+	// PayloadBytes is a size of a payload passed to and returned by each
+	// activity
+	PayloadBytes int `json:"payload_bytes"`
+	// Sleep is for how long each activity sleeps
+	Sleep time.Duration `json:"sleep"`
+	// Spin is for how long each activity keeps CPU busy
+	Spin time.Duration `json:"spin"`
+}
+
+// LoadTestResult is a result of the loadtest workflow
+type LoadTestResult struct {
+	Activities int `json:"activities"`
+	// PayloadBytes is a total size of payloads returned by activities
+	PayloadBytes int `json:"payload_bytes"`
+}
+
+// WorkParam is a parameter of the loadtest-work activity
+type WorkParam struct {
+	Payload []byte        `json:"payload"`
+	Sleep   time.Duration `json:"sleep"`
+	Spin    time.Duration `json:"spin"`
+}
+
+func (p LoadTestParam) validate() error {
+	if p.Activities < 0 || p.Activities > MaxActivities {
+		return temporal.NewNonRetryableApplicationError(
+			"activities must be between 0 and 1000", "InvalidParam", nil)
+	}
+
+	if p.PayloadBytes < 0 || p.PayloadBytes > MaxPayloadBytes {
+		return temporal.NewNonRetryableApplicationError(
+			"payload_bytes must be between 0 and 1MiB", "InvalidParam", nil)
+	}
+
+	if p.Sleep < 0 || p.Sleep > MaxWorkDuration || p.Spin < 0 || p.Spin > MaxWorkDuration {
+		return temporal.NewNonRetryableApplicationError(
+			"sleep and spin must be between 0 and 10m", "InvalidParam", nil)
+	}
+
+	return nil
+}
+
+func (s *LoadTestService) loadTest(ctx workflow.Context, param LoadTestParam) (LoadTestResult, error) {
+	var result LoadTestResult
+
+	if err := param.validate(); err != nil {
+		return result, err
+	}
+
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 2*(param.Sleep+param.Spin) + time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 1,
+		},
+	})
+
+	work := WorkParam{
+		Payload: bytes.Repeat([]byte{'x'}, param.PayloadBytes),
+		Sleep:   param.Sleep,
+		Spin:    param.Spin,
+	}
+
+	futures := make([]workflow.Future, param.Activities)
+	for i := range futures {
+		futures[i] = workflow.ExecuteActivity(ctx, "loadtest-work", work)
+	}
+
+	for _, f := range futures {
+		var payload []byte
+		if err := f.Get(ctx, &payload); err != nil {
+			return result, err
+		}
+
+		result.Activities++
+		result.PayloadBytes += len(payload)
+	}
+
+	return result, nil
+}
+
+// work spins and sleeps for the given durations and returns the payload
+// it received, so it goes through payload codecs both ways.
+func (s *LoadTestService) work(ctx context.Context, param WorkParam) ([]byte, error) {
+	deadline := time.Now().Add(param.Spin)
+	for time.Now().Before(deadline) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	if param.Sleep > 0 {
+		activity.RecordHeartbeat(ctx)
+
+		select {
+		case <-time.After(param.Sleep):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return param.Payload, nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package loadtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestLoadTest(t *testing.T) {
+	testcases := map[string]struct {
+		param  LoadTestParam
+		result LoadTestResult
+		err    string
+	}{
+		"no activities": {},
+		"activities with payload": {
+			param: LoadTestParam{
+				Activities:   5,
+				PayloadBytes: 1024,
+				Sleep:        time.Millisecond,
+				Spin:         time.Millisecond,
+			},
+			result: LoadTestResult{Activities: 5, PayloadBytes: 5 * 1024},
+		},
+		"too many activities": {
+			param: LoadTestParam{Activities: MaxActivities + 1},
+			err:   "activities",
+		},
+		"payload too large": {
+			param: LoadTestParam{PayloadBytes: MaxPayloadBytes + 1},
+			err:   "payload_bytes",
+		},
+		"negative sleep": {
+			param: LoadTestParam{Sleep: -time.Second},
+			err:   "sleep",
+		},
+	}
+
+	svc := NewLoadTestService()
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var suite testsuite.WorkflowTestSuite
+
+			env := suite.NewTestWorkflowEnvironment()
+
+			for k, v := range svc.ConfigurationWorkflows() {
+				env.RegisterWorkflowWithOptions(v, workflow.RegisterOptions{Name: k})
+			}
+
+			for k, v := range svc.ConfigurationActivities() {
+				env.RegisterActivityWithOptions(v, activity.RegisterOptions{Name: k})
+			}
+
+			env.ExecuteWorkflow("loadtest", tc.param)
+			require.True(t, env.IsWorkflowCompleted())
+
+			if tc.err != "" {
+				assert.ErrorContains(t, env.GetWorkflowError(), tc.err)
+				return
+			}
+
+			require.NoError(t, env.GetWorkflowError())
+
+			var result LoadTestResult
+			require.NoError(t, env.GetWorkflowResult(&result))
+			assert.Equal(t, tc.result, result)
+		})
+	}
+}
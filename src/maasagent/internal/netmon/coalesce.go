@@ -0,0 +1,167 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package netmon
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultCoalescingWindow is for how long a scan result is shared with
+	// subsequent scans of the same addresses.
+	DefaultCoalescingWindow = time.Second
+
+	// coalescedScanTimeout bounds a shared probe, that is not cancelled
+	// together with the context of the scan that started it. Scan completes
+	// within OperationTimeout after requests are sent.
+	coalescedScanTimeout = 2 * OperationTimeout
+)
+
+type scanFunc func(context.Context, []netip.Addr, ScanOptions) (map[netip.Addr]net.HardwareAddr, error)
+
+type scanResult struct {
+	value map[netip.Addr]net.HardwareAddr
+	time  time.Time
+}
+
+// CoalescingScanner deduplicates concurrent scans of the same set of
+// addresses, so they share a single probe. Result of a probe is also reused
+// by scans started within the coalescing window after it has completed.
+type CoalescingScanner struct {
+	scan    scanFunc
+	results map[string]scanResult
+	group   singleflight.Group
+	window  time.Duration
+	mutex   sync.Mutex
+}
+
+// CoalescingScannerOption allows to set additional CoalescingScanner options
+type CoalescingScannerOption func(*CoalescingScanner)
+
+// NewCoalescingScanner returns CoalescingScanner that uses Scan for probes
+func NewCoalescingScanner(options ...CoalescingScannerOption) *CoalescingScanner {
+	s := &CoalescingScanner{
+		scan:    ScanWithOptions,
+		results: make(map[string]scanResult),
+		window:  DefaultCoalescingWindow,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithCoalescingWindow sets for how long a completed probe result is reused
+// (default: DefaultCoalescingWindow)
+func WithCoalescingWindow(window time.Duration) CoalescingScannerOption {
+	return func(s *CoalescingScanner) {
+		s.window = window
+	}
+}
+
+// withScanFunc sets function used for probes, for tests
+func withScanFunc(fn scanFunc) CoalescingScannerOption {
+	return func(s *CoalescingScanner) {
+		s.scan = fn
+	}
+}
+
+// Scan sends ICMP Echo requests to provided IP addresses, unless a probe of
+// the same addresses is in progress or has completed within the window.
+func (s *CoalescingScanner) Scan(ctx context.Context,
+	ips []netip.Addr) (map[netip.Addr]net.HardwareAddr, error) {
+	return s.ScanWithOptions(ctx, ips, ScanOptions{})
+}
+
+// ScanWithOptions is like Scan, but requests are sent with the given options.
+// Only probes with the same options are shared.
+func (s *CoalescingScanner) ScanWithOptions(ctx context.Context,
+	ips []netip.Addr, opts ScanOptions) (map[netip.Addr]net.HardwareAddr, error) {
+	key := scanKey(ips, opts)
+
+	s.mutex.Lock()
+	res, ok := s.results[key]
+	s.mutex.Unlock()
+
+	if ok && time.Since(res.time) < s.window {
+		return maps.Clone(res.value), nil
+	}
+
+	// The probe is shared, so it is not cancelled together with ctx of
+	// the scan that started it, and every scan waits for it with its own ctx.
+	probe := s.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), coalescedScanTimeout)
+		defer cancel()
+
+		value, err := s.scan(ctx, ips, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+
+		s.mutex.Lock()
+		// Drop expired results, so the map doesn't grow unbounded.
+		for k, r := range s.results {
+			if now.Sub(r.time) >= s.window {
+				delete(s.results, k)
+			}
+		}
+
+		s.results[key] = scanResult{value: value, time: now}
+		s.mutex.Unlock()
+
+		return value, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-probe:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		//nolint:forcetypeassert // value is always returned by the function above
+		return maps.Clone(res.Val.(map[netip.Addr]net.HardwareAddr)), nil
+	}
+}
+
+// scanKey returns key identifying a set of addresses regardless of its order,
+// and the scan options. Address family is part of the address string
+// representation.
+func scanKey(ips []netip.Addr, opts ScanOptions) string {
+	keys := make([]string, len(ips))
+	for i, ip := range ips {
+		keys[i] = ip.String()
+	}
+
+	slices.Sort(keys)
+
+	return fmt.Sprintf("%s/ttl=%d", strings.Join(slices.Compact(keys), ","), opts.TTL)
+}
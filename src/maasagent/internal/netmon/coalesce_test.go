@@ -0,0 +1,170 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package netmon
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalescingScanner(t *testing.T) {
+	ip1 := netip.MustParseAddr("10.0.0.1")
+	ip2 := netip.MustParseAddr("10.0.0.2")
+	hwAddr := net.HardwareAddr{0x00, 0x16, 0x3e, 0x00, 0x00, 0x01}
+
+	var calls atomic.Int32
+
+	release := make(chan struct{})
+
+	scanner := NewCoalescingScanner(
+		WithCoalescingWindow(time.Hour),
+		withScanFunc(func(_ context.Context,
+			ips []netip.Addr, _ ScanOptions) (map[netip.Addr]net.HardwareAddr, error) {
+			calls.Add(1)
+			<-release
+
+			result := make(map[netip.Addr]net.HardwareAddr, len(ips))
+			for _, ip := range ips {
+				result[ip] = hwAddr
+			}
+
+			return result, nil
+		}),
+	)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		ips := []netip.Addr{ip1, ip2}
+		if i%2 == 0 {
+			ips = []netip.Addr{ip2, ip1}
+		}
+
+		go func() {
+			defer wg.Done()
+
+			result, err := scanner.Scan(context.Background(), ips)
+			assert.NoError(t, err)
+			assert.Equal(t, hwAddr, result[ip1])
+		}()
+	}
+
+	// Give all the goroutines a chance to join the in-flight probe.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Completed probe result is reused within the window
+	result, err := scanner.Scan(context.Background(), []netip.Addr{ip1, ip2})
+	require.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Different set of addresses requires a new probe
+	_, err = scanner.Scan(context.Background(), []netip.Addr{ip1})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// So do different options
+	_, err = scanner.ScanWithOptions(context.Background(), []netip.Addr{ip1, ip2},
+		ScanOptions{TTL: 64})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestCoalescingScannerCallerCancelled(t *testing.T) {
+	ip := netip.MustParseAddr("10.0.0.1")
+	hwAddr := net.HardwareAddr{0x00, 0x16, 0x3e, 0x00, 0x00, 0x01}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	scanner := NewCoalescingScanner(
+		withScanFunc(func(ctx context.Context,
+			_ []netip.Addr, _ ScanOptions) (map[netip.Addr]net.HardwareAddr, error) {
+			close(started)
+			<-release
+
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			return map[netip.Addr]net.HardwareAddr{ip: hwAddr}, nil
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+
+	go func() {
+		_, err := scanner.Scan(ctx, []netip.Addr{ip})
+		first <- err
+	}()
+
+	<-started
+
+	second := make(chan map[netip.Addr]net.HardwareAddr, 1)
+
+	go func() {
+		result, err := scanner.Scan(context.Background(), []netip.Addr{ip})
+		assert.NoError(t, err)
+		second <- result
+	}()
+
+	// Caller that started the probe gives up, the other one keeps waiting.
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+
+	// Give the second caller a chance to join the in-flight probe.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, hwAddr, (<-second)[ip])
+}
+
+func TestCoalescingScannerWindowExpired(t *testing.T) {
+	var calls atomic.Int32
+
+	scanner := NewCoalescingScanner(
+		WithCoalescingWindow(0),
+		withScanFunc(func(_ context.Context,
+			_ []netip.Addr, _ ScanOptions) (map[netip.Addr]net.HardwareAddr, error) {
+			calls.Add(1)
+			return map[netip.Addr]net.HardwareAddr{}, nil
+		}),
+	)
+
+	ips := []netip.Addr{netip.MustParseAddr("10.0.0.1")}
+
+	for i := 0; i < 3; i++ {
+		_, err := scanner.Scan(context.Background(), ips)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int32(3), calls.Load())
+}
@@ -63,8 +63,21 @@ var (
 	}
 )
 
+// ScanOptions are optional parameters of ICMP Echo requests sent by Scan
+type ScanOptions struct {
+	// TTL is the IPv4 TTL or IPv6 hop limit of requests. (default: OS default)
+	TTL int `json:"ttl,omitempty"`
+}
+
 // Scan sends ICMP Echo requests to provided IP addresses.
 func Scan(ctx context.Context, ips []netip.Addr) (map[netip.Addr]net.HardwareAddr, error) {
+	return ScanWithOptions(ctx, ips, ScanOptions{})
+}
+
+// ScanWithOptions sends ICMP Echo requests with the given options to provided
+// IP addresses.
+func ScanWithOptions(ctx context.Context, ips []netip.Addr,
+	opts ScanOptions) (map[netip.Addr]net.HardwareAddr, error) {
 	result := make(map[netip.Addr]net.HardwareAddr, len(ips))
 
 	if len(ips) == 0 {
@@ -91,7 +104,7 @@ func Scan(ctx context.Context, ips []netip.Addr) (map[netip.Addr]net.HardwareAdd
 
 		c, ok := conns[ip.BitLen()]
 		if !ok {
-			c, err = getConn(ip)
+			c, err = getConn(ip, opts)
 			if err != nil {
 				return nil, err
 			}
@@ -143,15 +156,34 @@ func Scan(ctx context.Context, ips []netip.Addr) (map[netip.Addr]net.HardwareAdd
 	}
 }
 
-func getConn(ip netip.Addr) (*icmp.PacketConn, error) {
+func getConn(ip netip.Addr, opts ScanOptions) (*icmp.PacketConn, error) {
+	var (
+		c   *icmp.PacketConn
+		err error
+	)
+
 	switch ip.BitLen() {
 	case 0, 32:
-		return icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+		c, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+		if err == nil && opts.TTL > 0 {
+			err = c.IPv4PacketConn().SetTTL(opts.TTL)
+		}
 	case 128:
-		return icmp.ListenPacket("ip6:ipv6-icmp", "::")
+		c, err = icmp.ListenPacket("ip6:ipv6-icmp", "::")
+		if err == nil && opts.TTL > 0 {
+			err = c.IPv6PacketConn().SetHopLimit(opts.TTL)
+		}
 	default:
 		return nil, errors.New("unsupported size")
 	}
+
+	if err != nil && c != nil {
+		//nolint:errcheck // error of setting the option is more relevant
+		c.Close()
+		return nil, err
+	}
+
+	return c, err
 }
 
 func icmpMessage(ip netip.Addr, id int) []byte {
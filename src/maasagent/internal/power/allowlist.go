@@ -0,0 +1,179 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+var (
+	// ErrBMCNotAllowed is an error for when BMC address is outside of the
+	// allowed subnets
+	ErrBMCNotAllowed = errors.New("BMC address is not allowed")
+)
+
+var (
+	// bmcAddressKeyRegexp matches keys of driver options that hold a BMC
+	// address, host or URI (e.g. power_address, power_on_uri, os_authurl)
+	bmcAddressKeyRegexp = regexp.MustCompile(`(address|addr|host|hostname|uri|url|(^|_)ip)$`)
+	// bmcAddresslessDrivers are power driver types that do not contact BMC
+	bmcAddresslessDrivers = []string{"manual"}
+)
+
+// bmcAllowlist restricts BMC addresses power drivers can contact, so
+// a malformed or malicious activity input cannot make the agent reach
+// arbitrary hosts.
+//
+// Hostnames are resolved when checked and resolved again by the driver, so
+// the allowlist applies to names as long as DNS is trusted. Drivers are
+// given the original name, because TLS and SSH verify it. IP addresses
+// should be used as BMC addresses if DNS is not trusted.
+type bmcAllowlist struct {
+	prefixes []netip.Prefix
+	lookup   func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+func newBMCAllowlist(prefixes []netip.Prefix) *bmcAllowlist {
+	return &bmcAllowlist{
+		prefixes: prefixes,
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+}
+
+// check returns ErrBMCNotAllowed if any BMC address from driver options is
+// not within allowed prefixes. Hostnames are allowed only if all their
+// addresses are. Driver options without any address are not allowed either,
+// unless driverType does not contact BMC.
+func (a *bmcAllowlist) check(ctx context.Context, driverType string,
+	opts map[string]interface{}) error {
+	var hosts []string
+
+	for key, value := range opts {
+		if value == nil || !isBMCAddressKey(key) {
+			continue
+		}
+
+		if host := bmcHost(fmt.Sprintf("%v", value)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	if len(hosts) == 0 {
+		if slices.Contains(bmcAddresslessDrivers, driverType) {
+			return nil
+		}
+
+		return fmt.Errorf("%w: no BMC address in %s driver options", ErrBMCNotAllowed, driverType)
+	}
+
+	// Sorted, so the same error is returned every time.
+	slices.Sort(hosts)
+
+	for _, host := range hosts {
+		if err := a.checkHost(ctx, host); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isBMCAddressKey returns true if driver option key holds a BMC address.
+// Keys of MAC addresses are not, even though they end with "address".
+func isBMCAddressKey(key string) bool {
+	key = strings.ToLower(key)
+	return !strings.Contains(key, "mac_") && bmcAddressKeyRegexp.MatchString(key)
+}
+
+func (a *bmcAllowlist) checkHost(ctx context.Context, host string) error {
+	var addrs []netip.Addr
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		addrs, err = a.lookup(ctx, host)
+		if err != nil {
+			return fmt.Errorf("failed resolving BMC address %q: %w", host, err)
+		}
+	}
+
+	for _, addr := range addrs {
+		if !a.allowed(addr.WithZone("").Unmap()) {
+			return fmt.Errorf("%w: %s", ErrBMCNotAllowed, addr)
+		}
+	}
+
+	return nil
+}
+
+func (a *bmcAllowlist) allowed(addr netip.Addr) bool {
+	for _, prefix := range a.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bmcHost returns host of BMC address, that can be an URL
+// (e.g. qemu+ssh://10.0.0.1/system), host:port pair or host.
+func bmcHost(address string) string {
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+
+	return strings.Trim(address, "[]")
+}
+
+// checkBMCAllowed fails power command, if BMC address is not allowed.
+func (s *PowerService) checkBMCAllowed(ctx context.Context, action string, param PowerParam) error {
+	if s.bmcAllowlist == nil {
+		return nil
+	}
+
+	err := s.bmcAllowlist.check(ctx, param.DriverType, param.DriverOpts)
+	if !errors.Is(err, ErrBMCNotAllowed) {
+		return err
+	}
+
+	activity.GetLogger(ctx).Warn("Power command rejected, BMC address is not allowed",
+		tag.Builder().Error(err).
+			KV("action", action).
+			KV("driver", param.DriverType).KeyVals...)
+
+	// Retry would not change the configuration, so fail immediately.
+	return temporal.NewNonRetryableApplicationError(err.Error(), "BMCNotAllowed", err)
+}
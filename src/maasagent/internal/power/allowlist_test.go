@@ -0,0 +1,179 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestBMCHost(t *testing.T) {
+	testcases := map[string]struct {
+		in  string
+		out string
+	}{
+		"address":      {in: "10.0.0.1", out: "10.0.0.1"},
+		"address port": {in: "10.0.0.1:623", out: "10.0.0.1"},
+		"ipv6":         {in: "fd00::1", out: "fd00::1"},
+		"ipv6 port":    {in: "[fd00::1]:623", out: "fd00::1"},
+		"hostname":     {in: "bmc.example.com:623", out: "bmc.example.com"},
+		"url":          {in: "qemu+ssh://ubuntu@10.0.0.1/system", out: "10.0.0.1"},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.out, bmcHost(tc.in))
+		})
+	}
+}
+
+func TestBMCAllowlist(t *testing.T) {
+	allowlist := newBMCAllowlist([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("fd00::/64"),
+	})
+
+	allowlist.lookup = func(_ context.Context, host string) ([]netip.Addr, error) {
+		switch host {
+		case "bmc.example.com":
+			return []netip.Addr{netip.MustParseAddr("10.0.0.2")}, nil
+		case "multi.example.com":
+			return []netip.Addr{
+				netip.MustParseAddr("10.0.0.3"),
+				netip.MustParseAddr("192.168.0.3"),
+			}, nil
+		default:
+			return nil, errors.New("no such host")
+		}
+	}
+
+	testcases := map[string]struct {
+		driver string
+		opts   map[string]interface{}
+		err    error
+		fail   bool
+	}{
+		"allowed":          {opts: map[string]interface{}{"power_address": "10.0.0.1"}},
+		"allowed ipv6":     {opts: map[string]interface{}{"power_address": "[fd00::1]:623"}},
+		"allowed url":      {opts: map[string]interface{}{"power_address": "qemu+ssh://10.0.0.1/system"}},
+		"allowed hostname": {opts: map[string]interface{}{"power_address": "bmc.example.com"}},
+		"allowed uris": {opts: map[string]interface{}{
+			"power_on_uri":  "https://10.0.0.1/on",
+			"power_off_uri": "https://bmc.example.com/off",
+		}},
+		"mac address ignored": {opts: map[string]interface{}{
+			"power_address": "10.0.0.1",
+			"mac_address":   "52:54:00:00:00:01",
+		}},
+		"no address manual": {driver: "manual"},
+		"no address":        {driver: "ipmi", err: ErrBMCNotAllowed},
+		"no address exec": {
+			driver: ExecDriverType,
+			opts:   map[string]interface{}{"exec_command": "script", "power_user": "admin"},
+			err:    ErrBMCNotAllowed,
+		},
+		"not allowed": {
+			opts: map[string]interface{}{"power_address": "192.168.0.1"},
+			err:  ErrBMCNotAllowed,
+		},
+		"not allowed ipv4 mapped": {
+			opts: map[string]interface{}{"power_address": "::ffff:192.168.0.1"},
+			err:  ErrBMCNotAllowed,
+		},
+		"not allowed uri": {
+			opts: map[string]interface{}{
+				"power_on_uri":  "https://10.0.0.1/on",
+				"power_off_uri": "https://192.168.0.1/off",
+			},
+			err: ErrBMCNotAllowed,
+		},
+		"not allowed host": {
+			opts: map[string]interface{}{"power_address": "10.0.0.1", "target_host": "192.168.0.1"},
+			err:  ErrBMCNotAllowed,
+		},
+		"partially allowed": {
+			opts: map[string]interface{}{"power_address": "multi.example.com"},
+			err:  ErrBMCNotAllowed,
+		},
+		"unresolved": {
+			opts: map[string]interface{}{"power_address": "unknown.example.com"},
+			fail: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			driver := tc.driver
+			if driver == "" {
+				driver = "ipmi"
+			}
+
+			err := allowlist.check(context.Background(), driver, tc.opts)
+
+			switch {
+			case tc.err != nil:
+				assert.ErrorIs(t, err, tc.err)
+			case tc.fail:
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrBMCNotAllowed)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPowerOnBMCNotAllowed(t *testing.T) {
+	svc := NewPowerService("abcdef", nil,
+		WithExecPower(map[string]string{"script": "/bin/true"}),
+		WithBMCAllowedPrefixes([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")}),
+	)
+
+	suite := testsuite.WorkflowTestSuite{}
+	env := suite.NewTestActivityEnvironment()
+	env.RegisterActivity(svc.PowerOn)
+
+	_, err := env.ExecuteActivity(svc.PowerOn, PowerOnParam{
+		PowerParam: PowerParam{
+			DriverType: ExecDriverType,
+			DriverOpts: map[string]interface{}{
+				"exec_command":  "script",
+				"power_address": "192.168.0.1",
+			},
+		},
+	})
+
+	var appErr *temporal.ApplicationError
+
+	require.ErrorAs(t, err, &appErr)
+	assert.Equal(t, "BMCNotAllowed", appErr.Type())
+	assert.True(t, appErr.NonRetryable())
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"go.temporal.io/sdk/activity"
+
+	"maas.io/core/src/maasagent/internal/retry"
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+// bmcRetry retries power commands that failed because BMC could not be
+// reached, within a single activity attempt. It is separate from the activity
+// RetryPolicy, so fragile BMCs can get gentler retries without activity churn.
+type bmcRetry struct {
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	jitter          float64
+	maxRetries      uint64
+}
+
+// newBackOff returns backoff for the given strategy. Retries stop before the
+// deadline of the activity, so the BMC error is returned rather than a timeout.
+func (r *bmcRetry) newBackOff(ctx context.Context, strategy string) backoff.BackOffContext {
+	if strategy == retry.StrategyDecorrelated {
+		// The number of retries is limited instead of elapsed time
+		b := retry.NewDecorrelatedJitterBackOff(r.initialInterval, r.maxInterval, 0)
+
+		return backoff.WithContext(retry.WithDeadline(ctx,
+			backoff.WithMaxRetries(b, r.maxRetries)), ctx)
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = r.initialInterval
+	b.MaxInterval = r.maxInterval
+	b.RandomizationFactor = r.jitter
+	// The number of retries is limited instead
+	b.MaxElapsedTime = 0
+	b.Reset()
+
+	return backoff.WithContext(retry.WithDeadline(ctx,
+		backoff.WithMaxRetries(b, r.maxRetries)), ctx)
+}
+
+// powerCommandWithRetry executes power command and retries it, if BMC is
+// unreachable and BMC retries are enabled. Other errors are returned as is.
+// It also returns the number of retries made.
+func (s *PowerService) powerCommandWithRetry(ctx context.Context, action, driver string,
+	opts map[string]interface{}, bootOrder ...map[string]interface{}) (string, int, error) {
+	if s.bmcRetry == nil {
+		out, err := s.powerCommand(ctx, action, driver, opts, bootOrder...)
+		return out, 0, err
+	}
+
+	var retries int
+
+	operation := func() (string, error) {
+		out, err := s.powerCommand(ctx, action, driver, opts, bootOrder...)
+		if err != nil && !errors.Is(err, ErrBMCUnreachable) {
+			return out, backoff.Permanent(err)
+		}
+
+		return out, err
+	}
+
+	notify := func(err error, next time.Duration) {
+		retries++
+
+		activity.GetLogger(ctx).Warn("BMC is unreachable, retrying power command",
+			tag.Builder().Error(err).
+				KV("action", action).
+				KV("driver", driver).
+				KV("retry_in", next).KeyVals...)
+	}
+
+	out, err := backoff.RetryNotifyWithData(operation, s.bmcRetry.newBackOff(ctx, s.backoffStrategy), notify)
+
+	return out, retries, err
+}
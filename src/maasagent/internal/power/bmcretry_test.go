@@ -0,0 +1,145 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestPowerOnBMCRetry(t *testing.T) {
+	// The script fails with the given message, until it was called more than
+	// the given number of times.
+	script := filepath.Join(t.TempDir(), "power")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+n=$(cat "$2" 2>/dev/null || echo 0)
+echo $((n + 1)) > "$2"
+[ "$n" -ge "$3" ] && exit 0
+echo "$4" >&2
+exit 1
+`), 0700))
+
+	testcases := map[string]struct {
+		failures string
+		message  string
+		attempts string
+		err      error
+		ok       bool
+	}{
+		"recovers": {
+			failures: "2",
+			message:  "Connection refused",
+			attempts: "3",
+			ok:       true,
+		},
+		"retries exhausted": {
+			failures: "5",
+			message:  "No route to host",
+			attempts: "4",
+			err:      ErrBMCUnreachable,
+		},
+		"not retried": {
+			failures: "5",
+			message:  "invalid power state",
+			attempts: "1",
+		},
+	}
+
+	svc := NewPowerService("abcdef", nil,
+		WithExecPower(map[string]string{
+			"script": script + " {action} {counter} {failures} {message}",
+		}),
+		WithBMCRetry(time.Millisecond, 10*time.Millisecond, 0.5, 3),
+	)
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			counter := filepath.Join(t.TempDir(), "counter")
+
+			suite := testsuite.WorkflowTestSuite{}
+			env := suite.NewTestActivityEnvironment()
+			env.RegisterActivity(svc.PowerOn)
+
+			_, err := env.ExecuteActivity(svc.PowerOn, PowerOnParam{
+				PowerParam: PowerParam{
+					DriverType: ExecDriverType,
+					DriverOpts: map[string]interface{}{
+						"exec_command": "script",
+						"counter":      counter,
+						"failures":     tc.failures,
+						"message":      tc.message,
+					},
+				},
+			})
+
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			if tc.err != nil {
+				assert.ErrorContains(t, err, tc.err.Error())
+			}
+
+			attempts, err := os.ReadFile(counter)
+			require.NoError(t, err)
+			assert.Equal(t, tc.attempts+"\n", string(attempts))
+		})
+	}
+}
+
+func TestDriverError(t *testing.T) {
+	testcases := map[string]struct {
+		stderr string
+		err    error
+	}{
+		"authentication": {stderr: "Error: Unauthorized", err: ErrAuthenticationFailed},
+		"refused":        {stderr: "dial tcp 10.0.0.1:623: connection refused", err: ErrBMCUnreachable},
+		"timeout":        {stderr: "ipmitool: Timed out waiting for response", err: ErrBMCUnreachable},
+		"unreachable":    {stderr: "connect: network is unreachable", err: ErrBMCUnreachable},
+		"other":          {stderr: "unsupported boot device"},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cause := assert.AnError
+			err := driverError(tc.stderr, cause)
+
+			assert.ErrorIs(t, err, cause)
+
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+			} else {
+				assert.Equal(t, cause, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// BootTarget is a kind of boot device used by boot profiles
+type BootTarget string
+
+const (
+	// BootTargetNetwork matches network interfaces (PXE boot)
+	BootTargetNetwork BootTarget = "network"
+	// BootTargetDisk matches block devices
+	BootTargetDisk BootTarget = "disk"
+)
+
+var (
+	// ErrUnknownBootProfile is an error for when set-boot-order references
+	// a boot profile that is not configured.
+	ErrUnknownBootProfile = errors.New("unknown boot profile")
+)
+
+// ValidateBootProfile checks that targets of a boot profile are known
+// and not repeated.
+func ValidateBootProfile(targets []string) error {
+	if len(targets) == 0 {
+		return errors.New("at least one boot target is required")
+	}
+
+	for i, target := range targets {
+		switch BootTarget(target) {
+		case BootTargetNetwork, BootTargetDisk:
+		default:
+			return fmt.Errorf("unknown boot target %q", target)
+		}
+
+		if slices.Contains(targets[:i], target) {
+			return fmt.Errorf("boot target %q is repeated", target)
+		}
+	}
+
+	return nil
+}
+
+// bootTarget returns kind of the boot device sent by Region Controller.
+// Network interfaces are the only devices that have a MAC address.
+func bootTarget(device map[string]interface{}) BootTarget {
+	if mac, ok := device["mac_address"]; ok && mac != nil && mac != "" {
+		return BootTargetNetwork
+	}
+
+	return BootTargetDisk
+}
+
+// applyBootProfile returns devices ordered by the boot targets of a profile.
+// Relative order of devices of the same kind is preserved. Devices of kinds
+// not listed by the profile are dropped.
+func applyBootProfile(order []map[string]interface{},
+	targets []BootTarget) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(order))
+
+	for _, target := range targets {
+		for _, device := range order {
+			if bootTarget(device) == target {
+				result = append(result, device)
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBootProfile(t *testing.T) {
+	testcases := map[string]struct {
+		in  []string
+		err bool
+	}{
+		"network then disk": {in: []string{"network", "disk"}},
+		"disk only":         {in: []string{"disk"}},
+		"empty":             {in: []string{}, err: true},
+		"unknown target":    {in: []string{"cdrom"}, err: true},
+		"repeated target":   {in: []string{"disk", "disk"}, err: true},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateBootProfile(tc.in)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestApplyBootProfile(t *testing.T) {
+	eth0 := map[string]interface{}{"name": "eth0", "mac_address": "00:16:3e:00:00:01"}
+	eth1 := map[string]interface{}{"name": "eth1", "mac_address": "00:16:3e:00:00:02"}
+	sda := map[string]interface{}{"name": "sda", "serial": "abc"}
+
+	order := []map[string]interface{}{eth0, sda, eth1}
+
+	testcases := map[string]struct {
+		in  []BootTarget
+		out []map[string]interface{}
+	}{
+		"network first": {
+			in:  []BootTarget{BootTargetNetwork, BootTargetDisk},
+			out: []map[string]interface{}{eth0, eth1, sda},
+		},
+		"disk first": {
+			in:  []BootTarget{BootTargetDisk, BootTargetNetwork},
+			out: []map[string]interface{}{sda, eth0, eth1},
+		},
+		"disk only": {
+			in:  []BootTarget{BootTargetDisk},
+			out: []map[string]interface{}{sda},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.out, applyBootProfile(order, tc.in))
+		})
+	}
+}
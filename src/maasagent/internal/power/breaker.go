@@ -0,0 +1,131 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCircuitOpen is an error for when power action is not sent to BMC,
+	// because previous actions for the same machine kept failing.
+	ErrCircuitOpen = errors.New("BMC circuit breaker is open")
+)
+
+// circuit holds failure state of a single machine
+type circuit struct {
+	// failures is the number of consecutive failures since firstFailure
+	failures     int
+	firstFailure time.Time
+	// openedAt is zero when the circuit is closed
+	openedAt time.Time
+	// trial is true while a request is let through an open circuit
+	trial bool
+}
+
+// circuitBreakers stops sending power actions to a machine after threshold
+// consecutive failures within window. Once cooldown passes, a single trial
+// action is allowed. Success closes the circuit, failure opens it again.
+type circuitBreakers struct {
+	circuits  map[string]*circuit
+	now       func() time.Time
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	mutex     sync.Mutex
+}
+
+func newCircuitBreakers(threshold int, window, cooldown time.Duration) *circuitBreakers {
+	return &circuitBreakers{
+		circuits:  make(map[string]*circuit),
+		now:       time.Now,
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+	}
+}
+
+// allow returns ErrCircuitOpen if action for the given key must not be sent
+// to BMC. Every allowed action must be followed by a call to record.
+func (b *circuitBreakers) allow(key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	c, ok := b.circuits[key]
+	if !ok || c.openedAt.IsZero() {
+		return nil
+	}
+
+	if c.trial || b.now().Before(c.openedAt.Add(b.cooldown)) {
+		return ErrCircuitOpen
+	}
+
+	c.trial = true
+
+	return nil
+}
+
+// record updates state of the circuit for the given key with the result of
+// the action allowed by allow.
+func (b *circuitBreakers) record(key string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err == nil {
+		delete(b.circuits, key)
+		return
+	}
+
+	c, ok := b.circuits[key]
+
+	// Cancelled action tells nothing about the BMC, but an action that ran
+	// out of its deadline is a BMC that does not respond, hence a failure.
+	if errors.Is(err, context.Canceled) {
+		if ok {
+			c.trial = false
+		}
+
+		return
+	}
+
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+
+	now := b.now()
+
+	if c.trial {
+		c.trial = false
+		c.openedAt = now
+
+		return
+	}
+
+	if c.failures == 0 || now.Sub(c.firstFailure) > b.window {
+		c.failures = 0
+		c.firstFailure = now
+	}
+
+	c.failures++
+
+	if c.failures >= b.threshold {
+		c.openedAt = now
+	}
+}
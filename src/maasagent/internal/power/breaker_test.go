@@ -0,0 +1,96 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakers(t *testing.T) {
+	now := time.Now()
+	errBMC := errors.New("boom")
+
+	breakers := newCircuitBreakers(2, time.Minute, 30*time.Second)
+	breakers.now = func() time.Time { return now }
+
+	const key = "ipmi/10.0.0.1"
+
+	// Failures outside of the window are not consecutive
+	assert.NoError(t, breakers.allow(key))
+	breakers.record(key, errBMC)
+
+	now = now.Add(2 * time.Minute)
+
+	assert.NoError(t, breakers.allow(key))
+	breakers.record(key, errBMC)
+
+	// Cancellation is not a failure
+	assert.NoError(t, breakers.allow(key))
+	breakers.record(key, context.Canceled)
+
+	// Second failure within the window opens the circuit
+	assert.NoError(t, breakers.allow(key))
+	breakers.record(key, errBMC)
+
+	assert.ErrorIs(t, breakers.allow(key), ErrCircuitOpen)
+
+	// Different machine is not affected
+	assert.NoError(t, breakers.allow("ipmi/10.0.0.2"))
+
+	// Only one trial is allowed once cooldown passes
+	now = now.Add(31 * time.Second)
+
+	assert.NoError(t, breakers.allow(key))
+	assert.ErrorIs(t, breakers.allow(key), ErrCircuitOpen)
+
+	// Failed trial opens the circuit again
+	breakers.record(key, errBMC)
+	assert.ErrorIs(t, breakers.allow(key), ErrCircuitOpen)
+
+	now = now.Add(31 * time.Second)
+
+	// Successful trial closes the circuit
+	assert.NoError(t, breakers.allow(key))
+	breakers.record(key, nil)
+
+	assert.NoError(t, breakers.allow(key))
+	breakers.record(key, errBMC)
+	assert.NoError(t, breakers.allow(key))
+}
+
+func TestCircuitBreakersDeadlineExceeded(t *testing.T) {
+	breakers := newCircuitBreakers(2, time.Minute, 30*time.Second)
+
+	const key = "ipmi/10.0.0.1"
+
+	// Timed out actions are failures of unresponsive BMC
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		<-ctx.Done()
+		cancel()
+
+		assert.NoError(t, breakers.allow(key))
+		breakers.record(key, fmt.Errorf("running power command: %w", ctx.Err()))
+	}
+
+	assert.ErrorIs(t, breakers.allow(key), ErrCircuitOpen)
+}
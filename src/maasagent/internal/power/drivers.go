@@ -0,0 +1,96 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Driver performs power actions for a power driver type. The returned power
+// state has the same format as the output of MAAS power CLI.
+type Driver interface {
+	Run(ctx context.Context, action string, opts map[string]interface{},
+		bootOrder ...map[string]interface{}) (string, error)
+}
+
+// DriverFunc is an adapter to allow the use of ordinary functions as Driver.
+type DriverFunc func(ctx context.Context, action string, opts map[string]interface{},
+	bootOrder ...map[string]interface{}) (string, error)
+
+// Run calls f(ctx, action, opts, bootOrder...)
+func (f DriverFunc) Run(ctx context.Context, action string, opts map[string]interface{},
+	bootOrder ...map[string]interface{}) (string, error) {
+	return f(ctx, action, opts, bootOrder...)
+}
+
+// DriverConstructor returns Driver for the given service. It is called once
+// per service, after all of the PowerServiceOption were applied.
+type DriverConstructor func(s *PowerService) Driver
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]DriverConstructor)
+)
+
+// RegisterDriver makes a power driver available by the provided power driver
+// type. Power driver types that are not registered are handled by MAAS power
+// CLI. If RegisterDriver is called twice with the same type or if constructor
+// is nil, it panics.
+func RegisterDriver(driverType string, constructor DriverConstructor) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if constructor == nil {
+		panic("power: RegisterDriver constructor is nil")
+	}
+
+	if _, ok := drivers[driverType]; ok {
+		panic(fmt.Sprintf("power: RegisterDriver called twice for driver %q", driverType))
+	}
+
+	drivers[driverType] = constructor
+}
+
+// RegisteredDrivers returns a sorted list of registered power driver types.
+func RegisteredDrivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	types := make([]string, 0, len(drivers))
+	for driverType := range drivers {
+		types = append(types, driverType)
+	}
+
+	slices.Sort(types)
+
+	return types
+}
+
+// newDrivers constructs all of the registered power drivers for s.
+func newDrivers(s *PowerService) map[string]Driver {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	res := make(map[string]Driver, len(drivers))
+	for driverType, constructor := range drivers {
+		res[driverType] = constructor(s)
+	}
+
+	return res
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestRegisterDriver(t *testing.T) {
+	var calls []string
+
+	RegisterDriver("test-registered", func(s *PowerService) Driver {
+		return DriverFunc(func(_ context.Context, action string, opts map[string]interface{},
+			_ ...map[string]interface{}) (string, error) {
+			calls = append(calls, action+" "+opts["power_address"].(string))
+			return "on", nil
+		})
+	})
+
+	assert.Contains(t, RegisteredDrivers(), "test-registered")
+	assert.Contains(t, RegisteredDrivers(), ExecDriverType)
+
+	svc := NewPowerService("abcdef", nil)
+
+	suite := testsuite.WorkflowTestSuite{}
+	env := suite.NewTestActivityEnvironment()
+	env.RegisterActivity(svc.PowerQuery)
+
+	res, err := env.ExecuteActivity(svc.PowerQuery, PowerQueryParam{
+		PowerParam: PowerParam{
+			DriverType: "test-registered",
+			DriverOpts: map[string]interface{}{"power_address": "10.0.0.1"},
+		},
+	})
+	require.NoError(t, err)
+
+	var result PowerQueryResult
+	require.NoError(t, res.Get(&result))
+	assert.Equal(t, "on", result.State)
+	assert.Equal(t, []string{"status 10.0.0.1"}, calls)
+	assert.Contains(t, svc.Capabilities().Drivers, "test-registered")
+}
+
+func TestRegisterDriverPanics(t *testing.T) {
+	assert.Panics(t, func() { RegisterDriver("test-nil", nil) })
+	assert.Panics(t, func() {
+		RegisterDriver(ExecDriverType, func(*PowerService) Driver { return nil })
+	})
+}
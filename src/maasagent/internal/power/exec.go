@@ -0,0 +1,254 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"maas.io/core/src/maasagent/internal/workflow"
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+// ExecDriverType is the power driver type that runs operator defined
+// commands, instead of the MAAS power CLI.
+const ExecDriverType = "exec"
+
+func init() {
+	RegisterDriver(ExecDriverType, func(s *PowerService) Driver {
+		return DriverFunc(s.execCommand)
+	})
+}
+
+// execCommandOpt is the driver option with the name of the allowed command
+const execCommandOpt = "exec_command"
+
+var (
+	// ErrExecPowerDisabled is an error for when exec power driver is used,
+	// but it was not enabled in the configuration.
+	ErrExecPowerDisabled = errors.New("exec power driver is disabled")
+	// ErrExecCommandNotAllowed is an error for when exec power driver is
+	// asked to run a command that is not in the allowlist.
+	ErrExecCommandNotAllowed = errors.New("exec power command is not allowed")
+	// ErrExecActionNotSupported is an error for power actions that cannot be
+	// performed by the exec power driver.
+	ErrExecActionNotSupported = errors.New("action is not supported by exec power driver")
+	// ErrExecInvalidOption is an error for power driver option values that
+	// cannot be substituted into the exec power command.
+	ErrExecInvalidOption = errors.New("invalid exec power command option")
+
+	// execPlaceholderRegexp matches {name} placeholders in command templates
+	execPlaceholderRegexp = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// Exit codes of the status command. Any other exit code is an error.
+const (
+	execStatusOn      = 0
+	execStatusOff     = 1
+	execStatusUnknown = 2
+)
+
+// ValidateExecCommand checks that template can be used by exec power driver.
+// Template is split on whitespace into the executable (must be an absolute
+// path) and its arguments. Arguments can reference {action} and any of the
+// power driver options, e.g. {power_address}.
+func ValidateExecCommand(template string) error {
+	argv := strings.Fields(template)
+	if len(argv) == 0 {
+		return errors.New("empty command")
+	}
+
+	if !filepath.IsAbs(argv[0]) {
+		return fmt.Errorf("executable %q must be an absolute path", argv[0])
+	}
+
+	if execPlaceholderRegexp.MatchString(argv[0]) {
+		return fmt.Errorf("executable %q cannot contain placeholders", argv[0])
+	}
+
+	return nil
+}
+
+// execDriver runs allowlisted commands to perform power actions.
+// Commands are executed directly (not via shell), so substituted values
+// cannot be used to inject other commands. Values starting with '-' are
+// rejected at the start of an argument, so they cannot inject flags.
+type execDriver struct {
+	commands map[string][]string
+}
+
+func newExecDriver(commands map[string]string) *execDriver {
+	d := &execDriver{commands: make(map[string][]string, len(commands))}
+
+	for name, template := range commands {
+		if ValidateExecCommand(template) != nil {
+			continue
+		}
+
+		d.commands[name] = strings.Fields(template)
+	}
+
+	return d
+}
+
+// args returns argv of the command for the given action with placeholders
+// substituted by the action and the power driver options.
+func (d *execDriver) args(action string, opts map[string]interface{}) ([]string, error) {
+	name, _ := opts[execCommandOpt].(string)
+
+	template, ok := d.commands[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrExecCommandNotAllowed, name)
+	}
+
+	argv := make([]string, len(template))
+
+	for i, arg := range template {
+		var err error
+
+		argv[i] = execPlaceholderRegexp.ReplaceAllStringFunc(arg, func(ref string) string {
+			key := ref[1 : len(ref)-1]
+			if key == "action" {
+				return action
+			}
+
+			v, ok := opts[key]
+			if !ok || v == nil {
+				err = fmt.Errorf("command %q references unknown option %q", name, key)
+				return ""
+			}
+
+			value := fmt.Sprintf("%v", v)
+
+			// A value at the start of an argument could be parsed as a flag
+			// of the command.
+			if strings.HasPrefix(arg, ref) && strings.HasPrefix(value, "-") {
+				err = fmt.Errorf("%w: option %q of command %q starts with '-'",
+					ErrExecInvalidOption, key, name)
+				return ""
+			}
+
+			return value
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return argv, nil
+}
+
+// run executes the command for the given action and returns the power state
+// in the same format as the MAAS power CLI does. Zero exit code means success
+// for on, off and cycle. For status exit code is mapped to the power state.
+func (d *execDriver) run(ctx context.Context, action string,
+	opts map[string]interface{}) (string, error) {
+	if action == "set-boot-order" || action == "get-boot-order" {
+		return "", fmt.Errorf("%w: %s", ErrExecActionNotSupported, action)
+	}
+
+	log := activity.GetLogger(ctx)
+
+	argv, err := d.args(action, opts)
+	if err != nil {
+		return "", err
+	}
+
+	log.Debug("Executing exec power command", tag.Builder().
+		KV("command", opts[execCommandOpt]).
+		KV("action", action).KeyVals...)
+
+	//nolint:gosec // command is taken from the allowlist in the configuration
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil && ctx.Err() != nil {
+		log.Warn("Power command was cancelled", tag.Builder().
+			KV("action", action).
+			KV("reason", workflow.GetCancellationReason(ctx)).KeyVals...)
+
+		return "", ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return "", err
+	}
+
+	if action == "status" {
+		switch cmd.ProcessState.ExitCode() {
+		case execStatusOn:
+			return "on", nil
+		case execStatusOff:
+			return "off", nil
+		case execStatusUnknown:
+			return "unknown", nil
+		}
+	}
+
+	if err != nil {
+		t := tag.Builder().Error(err).KV("action", action)
+		if stdout.String() != "" {
+			t = t.KV("stdout", stdout.String())
+		}
+
+		if stderr.String() != "" {
+			t = t.KV("stderr", stderr.String())
+		}
+
+		log.Error("Error executing exec power command", t.KeyVals...)
+
+		return "", driverError(stderr.String(), err)
+	}
+
+	switch action {
+	case "off":
+		return "off", nil
+	default:
+		return "on", nil
+	}
+}
+
+// execCommand executes power command using exec power driver, if it was
+// enabled in the service configuration.
+func (s *PowerService) execCommand(ctx context.Context, action string,
+	opts map[string]interface{}, _ ...map[string]interface{}) (string, error) {
+	if s.exec == nil {
+		return "", temporal.NewNonRetryableApplicationError(
+			ErrExecPowerDisabled.Error(), "ExecPowerDisabled", ErrExecPowerDisabled)
+	}
+
+	out, err := s.exec.run(ctx, action, opts)
+	if errors.Is(err, ErrExecCommandNotAllowed) || errors.Is(err, ErrExecActionNotSupported) {
+		// Retry would not change the configuration, so fail immediately.
+		return "", temporal.NewNonRetryableApplicationError(err.Error(), "ExecPowerRejected", err)
+	}
+
+	return out, err
+}
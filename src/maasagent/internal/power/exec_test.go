@@ -0,0 +1,185 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestValidateExecCommand(t *testing.T) {
+	testcases := map[string]struct {
+		in  string
+		err bool
+	}{
+		"valid":                     {in: "/usr/local/bin/pdu {action} --host {power_address}"},
+		"empty":                     {in: " ", err: true},
+		"relative executable":       {in: "pdu {action}", err: true},
+		"placeholder in executable": {in: "/usr/local/bin/{action}", err: true},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateExecCommand(tc.in)
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestExecDriverArgs(t *testing.T) {
+	d := newExecDriver(map[string]string{
+		"pdu": "/usr/local/bin/pdu {action} --host={power_address} --outlet {outlet}",
+	})
+
+	testcases := map[string]struct {
+		opts map[string]interface{}
+		out  []string
+		err  error
+	}{
+		"substituted": {
+			opts: map[string]interface{}{
+				"exec_command": "pdu", "power_address": "10.0.0.1", "outlet": 3,
+			},
+			out: []string{"/usr/local/bin/pdu", "on", "--host=10.0.0.1", "--outlet", "3"},
+		},
+		"not allowed": {
+			opts: map[string]interface{}{"exec_command": "rm"},
+			err:  ErrExecCommandNotAllowed,
+		},
+		"missing option": {
+			opts: map[string]interface{}{"exec_command": "pdu", "power_address": "10.0.0.1"},
+		},
+		"flag injection": {
+			opts: map[string]interface{}{
+				"exec_command": "pdu", "power_address": "10.0.0.1", "outlet": "--all",
+			},
+			err: ErrExecInvalidOption,
+		},
+		"negative number": {
+			opts: map[string]interface{}{
+				"exec_command": "pdu", "power_address": "10.0.0.1", "outlet": -1,
+			},
+			err: ErrExecInvalidOption,
+		},
+		"dash after prefix": {
+			opts: map[string]interface{}{
+				"exec_command": "pdu", "power_address": "-host", "outlet": 3,
+			},
+			out: []string{"/usr/local/bin/pdu", "on", "--host=-host", "--outlet", "3"},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := d.args("on", tc.opts)
+
+			switch {
+			case tc.err != nil:
+				assert.ErrorIs(t, err, tc.err)
+			case tc.out == nil:
+				assert.Error(t, err)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tc.out, res)
+			}
+		})
+	}
+}
+
+func TestPowerQueryExec(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "power")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nexit $2\n"), 0700))
+
+	testcases := map[string]struct {
+		code       string
+		state      string
+		confidence PowerStateConfidence
+		err        bool
+	}{
+		"on":      {code: "0", state: "on", confidence: PowerStateLive},
+		"off":     {code: "1", state: "off", confidence: PowerStateLive},
+		"unknown": {code: "2", state: "unknown", confidence: PowerStateInferred},
+		"failure": {code: "3", err: true},
+	}
+
+	svc := NewPowerService("abcdef", nil, WithExecPower(map[string]string{
+		"script": script + " {action} {code}",
+	}))
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			suite := testsuite.WorkflowTestSuite{}
+			env := suite.NewTestActivityEnvironment()
+			env.RegisterActivity(svc.PowerQuery)
+
+			res, err := env.ExecuteActivity(svc.PowerQuery, PowerQueryParam{
+				PowerParam: PowerParam{
+					DriverType: ExecDriverType,
+					DriverOpts: map[string]interface{}{
+						"exec_command": "script", "code": tc.code,
+					},
+				},
+			})
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			var result PowerQueryResult
+			require.NoError(t, res.Get(&result))
+			assert.Equal(t, tc.state, result.State)
+			assert.Equal(t, tc.confidence, result.Confidence)
+			assert.False(t, result.ObservedAt.IsZero())
+		})
+	}
+}
+
+func TestPowerOnExecDisabled(t *testing.T) {
+	svc := NewPowerService("abcdef", nil)
+
+	suite := testsuite.WorkflowTestSuite{}
+	env := suite.NewTestActivityEnvironment()
+	env.RegisterActivity(svc.PowerOn)
+
+	_, err := env.ExecuteActivity(svc.PowerOn, PowerOnParam{
+		PowerParam: PowerParam{
+			DriverType: ExecDriverType,
+			DriverOpts: map[string]interface{}{"exec_command": "script"},
+		},
+	})
+	assert.ErrorContains(t, err, ErrExecPowerDisabled.Error())
+}
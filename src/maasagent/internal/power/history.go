@@ -0,0 +1,156 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"maas.io/core/src/maasagent/internal/workflow"
+)
+
+// PowerObservation is a power state of a machine returned by PowerQuery
+type PowerObservation struct {
+	State      string    `json:"state"`
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+// PowerHistoryParam is the activity parameter for power history of a host
+type PowerHistoryParam struct {
+	PowerParam
+}
+
+// PowerHistoryResult is the result of power history query
+type PowerHistoryResult struct {
+	Machine workflow.MachineRef `json:"machine"`
+	// Observations are ordered from the oldest to the most recent one
+	Observations []PowerObservation `json:"observations"`
+}
+
+// powerHistory keeps recent power states observed by PowerQuery per machine.
+// It is best-effort and kept in memory only, so it is lost on restart.
+type powerHistory struct {
+	machines  map[string][]PowerObservation
+	now       func() time.Time
+	lastSweep time.Time
+	size      int
+	retention time.Duration
+	mutex     sync.Mutex
+}
+
+func newPowerHistory(size int, retention time.Duration) *powerHistory {
+	return &powerHistory{
+		machines:  make(map[string][]PowerObservation),
+		now:       time.Now,
+		size:      size,
+		retention: retention,
+	}
+}
+
+// record adds observation of the machine identified by key, dropping the
+// oldest one, if there are already size observations.
+func (h *powerHistory) record(key string, o PowerObservation) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	observations := append(h.recent(key), o)
+	if len(observations) > h.size {
+		observations = observations[len(observations)-h.size:]
+	}
+
+	h.machines[key] = observations
+
+	// Machines are not queried any more once they are gone, so their
+	// observations are removed once in a retention period.
+	if now := h.now(); now.Sub(h.lastSweep) > h.retention {
+		for k := range h.machines {
+			if len(h.recent(k)) == 0 {
+				delete(h.machines, k)
+			}
+		}
+
+		h.lastSweep = now
+	}
+}
+
+// get returns observations of the machine identified by key, that are within
+// the retention period.
+func (h *powerHistory) get(key string) []PowerObservation {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return append([]PowerObservation{}, h.recent(key)...)
+}
+
+// latest returns the most recent observation of the machine identified by
+// key, if it was observed up to maxAge ago.
+func (h *powerHistory) latest(key string, maxAge time.Duration) (PowerObservation, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	observations := h.recent(key)
+	if len(observations) == 0 {
+		return PowerObservation{}, false
+	}
+
+	o := observations[len(observations)-1]
+	if h.now().Sub(o.ObservedAt) > maxAge {
+		return PowerObservation{}, false
+	}
+
+	return o, true
+}
+
+// recent drops observations of the machine that are older than retention
+// period and returns the remaining ones. Caller must hold the mutex.
+func (h *powerHistory) recent(key string) []PowerObservation {
+	observations := h.machines[key]
+	cutoff := h.now().Add(-h.retention)
+
+	i := 0
+	for i < len(observations) && observations[i].ObservedAt.Before(cutoff) {
+		i++
+	}
+
+	if i == 0 {
+		return observations
+	}
+
+	observations = observations[i:]
+
+	if len(observations) == 0 {
+		delete(h.machines, key)
+	} else {
+		h.machines[key] = observations
+	}
+
+	return observations
+}
+
+// PowerHistory returns recent power states of a host observed by PowerQuery.
+// Empty history is returned if power history is disabled.
+func (s *PowerService) PowerHistory(_ context.Context,
+	param PowerHistoryParam) (*PowerHistoryResult, error) {
+	ref := machineRef(param.PowerParam)
+	res := &PowerHistoryResult{Machine: ref, Observations: []PowerObservation{}}
+
+	if key := ref.Key(); s.history != nil && key != "" {
+		res.Observations = s.history.get(key)
+	}
+
+	return res, nil
+}
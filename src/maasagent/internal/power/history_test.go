@@ -0,0 +1,180 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestPowerHistory(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := newPowerHistory(3, time.Minute)
+	h.now = func() time.Time { return now }
+
+	observe := func(key, state string) PowerObservation {
+		o := PowerObservation{State: state, ObservedAt: now}
+		h.record(key, o)
+		now = now.Add(10 * time.Second)
+
+		return o
+	}
+
+	observe("10.0.0.1", "off")
+	on := observe("10.0.0.1", "on")
+	off := observe("10.0.0.1", "off")
+	other := observe("10.0.0.2", "on")
+	last := observe("10.0.0.1", "on")
+
+	// Only the most recent observations are kept
+	assert.Equal(t, []PowerObservation{on, off, last}, h.get("10.0.0.1"))
+	assert.Equal(t, []PowerObservation{other}, h.get("10.0.0.2"))
+	assert.Empty(t, h.get("10.0.0.3"))
+
+	// Observations older than retention are dropped
+	now = now.Add(40 * time.Second)
+	assert.Equal(t, []PowerObservation{last}, h.get("10.0.0.1"))
+
+	now = now.Add(time.Minute)
+	observe("10.0.0.1", "off")
+	assert.NotContains(t, h.machines, "10.0.0.2")
+}
+
+func TestPowerHistoryLatest(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := newPowerHistory(3, time.Minute)
+	h.now = func() time.Time { return now }
+
+	_, ok := h.latest("10.0.0.1", time.Minute)
+	assert.False(t, ok)
+
+	h.record("10.0.0.1", PowerObservation{State: "off", ObservedAt: now.Add(-20 * time.Second)})
+	on := PowerObservation{State: "on", ObservedAt: now.Add(-10 * time.Second)}
+	h.record("10.0.0.1", on)
+
+	o, ok := h.latest("10.0.0.1", 15*time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, on, o)
+
+	_, ok = h.latest("10.0.0.1", 5*time.Second)
+	assert.False(t, ok)
+}
+
+func TestPowerQueryCached(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "power")
+	// Every call to the BMC is counted
+	require.NoError(t, os.WriteFile(script,
+		[]byte("#!/bin/sh\necho >> \"$(dirname \"$0\")/calls\"\nexit 0\n"), 0700))
+
+	svc := NewPowerService("abcdef", nil,
+		WithExecPower(map[string]string{"script": script}),
+		WithPowerHistory(10, time.Hour),
+	)
+
+	param := PowerParam{
+		DriverType: ExecDriverType,
+		DriverOpts: map[string]interface{}{
+			"exec_command":  "script",
+			"power_address": "10.0.0.1",
+		},
+	}
+
+	suite := testsuite.WorkflowTestSuite{}
+	env := suite.NewTestActivityEnvironment()
+	env.RegisterActivity(svc.PowerQuery)
+
+	query := func(maxAge time.Duration) PowerQueryResult {
+		res, err := env.ExecuteActivity(svc.PowerQuery, PowerQueryParam{PowerParam: param, MaxAge: maxAge})
+		require.NoError(t, err)
+
+		var result PowerQueryResult
+		require.NoError(t, res.Get(&result))
+
+		return result
+	}
+
+	calls := func() int {
+		data, err := os.ReadFile(filepath.Join(dir, "calls"))
+		require.NoError(t, err)
+
+		return len(data)
+	}
+
+	// Nothing was observed yet, so the BMC is queried
+	live := query(time.Hour)
+	assert.False(t, live.Cached)
+	assert.Equal(t, PowerStateLive, live.Confidence)
+	assert.Equal(t, 1, calls())
+
+	cached := query(time.Hour)
+	assert.True(t, cached.Cached)
+	assert.Equal(t, PowerStateCached, cached.Confidence)
+	assert.Equal(t, "on", cached.State)
+	assert.Equal(t, live.ObservedAt, cached.ObservedAt)
+	assert.Equal(t, 1, calls())
+
+	// Without MaxAge the BMC is always queried
+	again := query(0)
+	assert.False(t, again.Cached)
+	assert.Equal(t, 2, calls())
+}
+
+func TestPowerHistoryActivity(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "power")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nexit 0\n"), 0700))
+
+	svc := NewPowerService("abcdef", nil,
+		WithExecPower(map[string]string{"script": script}),
+		WithPowerHistory(10, time.Hour),
+	)
+
+	param := PowerParam{
+		DriverType: ExecDriverType,
+		DriverOpts: map[string]interface{}{
+			"exec_command":  "script",
+			"power_address": "10.0.0.1",
+		},
+	}
+
+	suite := testsuite.WorkflowTestSuite{}
+	env := suite.NewTestActivityEnvironment()
+	env.RegisterActivity(svc.PowerQuery)
+	env.RegisterActivity(svc.PowerHistory)
+
+	for i := 0; i < 2; i++ {
+		_, err := env.ExecuteActivity(svc.PowerQuery, PowerQueryParam{PowerParam: param})
+		require.NoError(t, err)
+	}
+
+	res, err := env.ExecuteActivity(svc.PowerHistory, PowerHistoryParam{PowerParam: param})
+	require.NoError(t, err)
+
+	var result PowerHistoryResult
+	require.NoError(t, res.Get(&result))
+
+	assert.Equal(t, "10.0.0.1", result.Machine.BMCEndpoint)
+	require.Len(t, result.Observations, 2)
+	assert.Equal(t, "on", result.Observations[1].State)
+}
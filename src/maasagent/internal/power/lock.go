@@ -0,0 +1,107 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"maas.io/core/src/maasagent/internal/workflow"
+)
+
+// BMCLockMode defines what happens to a mutating power action, when another
+// one is in progress for the same machine.
+type BMCLockMode string
+
+const (
+	// BMCLockQueue makes power action wait until the previous one completes
+	BMCLockQueue BMCLockMode = "queue"
+	// BMCLockFailFast makes power action fail immediately
+	BMCLockFailFast BMCLockMode = "fail-fast"
+	// BMCLockDisabled allows concurrent power actions
+	BMCLockDisabled BMCLockMode = "disabled"
+)
+
+var (
+	// ErrBMCBusy is an error for when another power action is in progress
+	// for the same machine and BMCLockFailFast mode is used.
+	ErrBMCBusy = errors.New("another power action is in progress")
+)
+
+// bmcLocks serializes power actions per machine, so conflicting actions
+// triggered by different workflows do not interleave on the same BMC.
+type bmcLocks struct {
+	locks map[string]chan struct{}
+	mutex sync.Mutex
+}
+
+func newBMCLocks() *bmcLocks {
+	return &bmcLocks{locks: make(map[string]chan struct{})}
+}
+
+// acquire obtains lock for the given key. If wait is false and the lock is
+// held, ErrBMCBusy is returned, otherwise it blocks until the lock is
+// released or ctx is done. Returned function must be called to release lock.
+func (l *bmcLocks) acquire(ctx context.Context, key string, wait bool) (func(), error) {
+	l.mutex.Lock()
+
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		l.locks[key] = lock
+	}
+
+	l.mutex.Unlock()
+
+	release := func() { <-lock }
+
+	select {
+	case lock <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if !wait {
+		return nil, ErrBMCBusy
+	}
+
+	select {
+	case lock <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// machineRef returns reference of the machine managed by the power driver.
+// Fields not provided by the caller are taken from the driver options.
+// Several machines might share the same address (e.g. VM hosts), so the
+// power_id is used as the machine ID.
+func machineRef(param PowerParam) workflow.MachineRef {
+	ref := param.Machine
+
+	if ref.BMCEndpoint == "" {
+		ref.BMCEndpoint = powerEndpoint(param.DriverOpts)
+	}
+
+	if id, ok := param.DriverOpts["power_id"]; ok && id != nil && ref.MachineID == "" {
+		ref.MachineID = fmt.Sprintf("%v", id)
+	}
+
+	return ref
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"maas.io/core/src/maasagent/internal/workflow"
+)
+
+func TestBMCLocks(t *testing.T) {
+	locks := newBMCLocks()
+	ctx := context.Background()
+
+	release, err := locks.acquire(ctx, "ipmi/10.0.0.1", true)
+	require.NoError(t, err)
+
+	// Different machine is not affected
+	other, err := locks.acquire(ctx, "ipmi/10.0.0.2", false)
+	require.NoError(t, err)
+	other()
+
+	_, err = locks.acquire(ctx, "ipmi/10.0.0.1", false)
+	assert.ErrorIs(t, err, ErrBMCBusy)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	_, err = locks.acquire(timeoutCtx, "ipmi/10.0.0.1", true)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan struct{})
+
+	go func() {
+		r, err := locks.acquire(ctx, "ipmi/10.0.0.1", true)
+		assert.NoError(t, err)
+		close(acquired)
+		r()
+	}()
+
+	release()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("queued power action did not acquire the lock")
+	}
+}
+
+func TestMachineRef(t *testing.T) {
+	testcases := map[string]struct {
+		in  PowerParam
+		out workflow.MachineRef
+	}{
+		"address": {
+			in: PowerParam{
+				DriverType: "ipmi",
+				DriverOpts: map[string]interface{}{"power_address": "10.0.0.1"},
+			},
+			out: workflow.MachineRef{BMCEndpoint: "10.0.0.1"},
+		},
+		"address and power id": {
+			in: PowerParam{
+				DriverType: "virsh",
+				DriverOpts: map[string]interface{}{
+					"power_address": "qemu+ssh://10.0.0.1/system",
+					"power_id":      "vm1",
+				},
+			},
+			out: workflow.MachineRef{
+				MachineID:   "vm1",
+				BMCEndpoint: "qemu+ssh://10.0.0.1/system",
+			},
+		},
+		"provided by caller": {
+			in: PowerParam{
+				DriverType: "ipmi",
+				DriverOpts: map[string]interface{}{"power_address": "10.0.0.1"},
+				Machine:    workflow.MachineRef{SystemID: "abcdef", BMCEndpoint: "10.0.0.2"},
+			},
+			out: workflow.MachineRef{SystemID: "abcdef", BMCEndpoint: "10.0.0.2"},
+		},
+		"unknown address": {
+			in: PowerParam{
+				DriverType: "manual",
+				DriverOpts: map[string]interface{}{},
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.out, machineRef(tc.in))
+		})
+	}
+}
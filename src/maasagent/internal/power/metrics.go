@@ -0,0 +1,127 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// powerMetrics is a set of instruments used to record power actions.
+// Only bounded cardinality attributes (driver, action, result and allowlisted
+// machine labels) are allowed, attributes identifying machines must never be
+// used here, machineBucket can be used instead.
+type powerMetrics struct {
+	duration metric.Float64Histogram
+	retries  metric.Int64Counter
+}
+
+func newPowerMetrics(meter metric.Meter) *powerMetrics {
+	return &powerMetrics{
+		duration: must(meter.Float64Histogram("power.action.duration",
+			metric.WithDescription("Duration of power actions executed via BMC"),
+			metric.WithUnit("s"),
+		)),
+		retries: must(meter.Int64Counter("power.action.retries",
+			metric.WithDescription("Retries of power actions, including BMC and activity retries"),
+		)),
+	}
+}
+
+func newNoopPowerMetrics() *powerMetrics {
+	return newPowerMetrics(noop.NewMeterProvider().Meter("power"))
+}
+
+// record records duration of a power action since start with its outcome.
+func (m *powerMetrics) record(ctx context.Context, action, driver string,
+	start time.Time, err error, labels ...attribute.KeyValue) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	m.duration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(
+			attribute.String("action", action),
+			attribute.String("driver", driver),
+			attribute.String("result", result),
+		),
+		metric.WithAttributes(labels...))
+}
+
+// recordRetries records retries a power action needed with its outcome.
+func (m *powerMetrics) recordRetries(ctx context.Context, driver, machine string,
+	retries int, err error, labels ...attribute.KeyValue) {
+	if retries < 1 {
+		return
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	m.retries.Add(ctx, int64(retries),
+		metric.WithAttributes(
+			attribute.String("driver", driver),
+			attribute.String("machine_bucket", machineBucket(machine)),
+			attribute.String("result", result),
+		),
+		metric.WithAttributes(labels...))
+}
+
+// labelAttributes returns attributes of machine labels with the given keys.
+// Labels missing on the machine are recorded empty, so all of the series of
+// an instrument have the same set of attributes.
+func labelAttributes(keys []string, labels map[string]string) []attribute.KeyValue {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	attrs := make([]attribute.KeyValue, len(keys))
+	for i, key := range keys {
+		attrs[i] = attribute.String("label_"+key, labels[key])
+	}
+
+	return attrs
+}
+
+// machineBucketCount is a number of buckets machines are spread across in
+// metrics, so flaky machines stand out while cardinality stays bounded.
+const machineBucketCount = 16
+
+// machineBucket returns a stable bucket of machine key
+func machineBucket(key string) string {
+	h := fnv.New32a()
+	//nolint:errcheck // hash.Hash never returns an error
+	h.Write([]byte(key))
+
+	return fmt.Sprintf("%02d", h.Sum32()%machineBucketCount)
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
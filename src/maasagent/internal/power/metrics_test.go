@@ -0,0 +1,172 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestPowerMetrics(t *testing.T) {
+	metricReader := metric.NewManualReader()
+	meterProvider := metric.NewMeterProvider(metric.WithReader(metricReader))
+
+	m := newPowerMetrics(meterProvider.Meter("test"))
+
+	ctx := context.Background()
+	m.record(ctx, "on", "ipmi", time.Now(), nil)
+	m.record(ctx, "on", "ipmi", time.Now(), nil)
+	m.record(ctx, "status", "redfish", time.Now(), errors.New("boom"))
+
+	var rm metricdata.ResourceMetrics
+
+	require.NoError(t, metricReader.Collect(ctx, &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+
+	metrics := rm.ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "power.action.duration", metrics.Name)
+	assert.Equal(t, "s", metrics.Unit)
+
+	histogram, ok := metrics.Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+
+	counts := map[attribute.Set]uint64{}
+	for _, dp := range histogram.DataPoints {
+		counts[dp.Attributes] = dp.Count
+	}
+
+	assert.Equal(t, map[attribute.Set]uint64{
+		attribute.NewSet(
+			attribute.String("action", "on"),
+			attribute.String("driver", "ipmi"),
+			attribute.String("result", "success"),
+		): 2,
+		attribute.NewSet(
+			attribute.String("action", "status"),
+			attribute.String("driver", "redfish"),
+			attribute.String("result", "failure"),
+		): 1,
+	}, counts)
+}
+
+func TestPowerMetricsRetries(t *testing.T) {
+	metricReader := metric.NewManualReader()
+	meterProvider := metric.NewMeterProvider(metric.WithReader(metricReader))
+
+	m := newPowerMetrics(meterProvider.Meter("test"))
+
+	ctx := context.Background()
+	m.recordRetries(ctx, "ipmi", "10.0.0.1/1", 2, nil)
+	m.recordRetries(ctx, "ipmi", "10.0.0.1/1", 3, errors.New("boom"))
+	m.recordRetries(ctx, "ipmi", "10.0.0.1/1", 0, nil)
+
+	var rm metricdata.ResourceMetrics
+
+	require.NoError(t, metricReader.Collect(ctx, &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+
+	metrics := rm.ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "power.action.retries", metrics.Name)
+
+	sum, ok := metrics.Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+
+	values := map[attribute.Set]int64{}
+	for _, dp := range sum.DataPoints {
+		values[dp.Attributes] = dp.Value
+	}
+
+	bucket := machineBucket("10.0.0.1/1")
+
+	assert.Equal(t, map[attribute.Set]int64{
+		attribute.NewSet(
+			attribute.String("driver", "ipmi"),
+			attribute.String("machine_bucket", bucket),
+			attribute.String("result", "success"),
+		): 2,
+		attribute.NewSet(
+			attribute.String("driver", "ipmi"),
+			attribute.String("machine_bucket", bucket),
+			attribute.String("result", "failure"),
+		): 3,
+	}, values)
+}
+
+func TestPowerMetricsLabels(t *testing.T) {
+	metricReader := metric.NewManualReader()
+	meterProvider := metric.NewMeterProvider(metric.WithReader(metricReader))
+
+	m := newPowerMetrics(meterProvider.Meter("test"))
+	keys := []string{"zone"}
+
+	ctx := context.Background()
+	m.record(ctx, "on", "ipmi", time.Now(), nil,
+		labelAttributes(keys, map[string]string{"zone": "z1", "rack": "r1"})...)
+	m.record(ctx, "on", "ipmi", time.Now(), nil,
+		labelAttributes(keys, nil)...)
+
+	var rm metricdata.ResourceMetrics
+
+	require.NoError(t, metricReader.Collect(ctx, &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+
+	histogram, ok := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+
+	counts := map[attribute.Set]uint64{}
+	for _, dp := range histogram.DataPoints {
+		counts[dp.Attributes] = dp.Count
+	}
+
+	assert.Equal(t, map[attribute.Set]uint64{
+		attribute.NewSet(
+			attribute.String("action", "on"),
+			attribute.String("driver", "ipmi"),
+			attribute.String("result", "success"),
+			attribute.String("label_zone", "z1"),
+		): 1,
+		attribute.NewSet(
+			attribute.String("action", "on"),
+			attribute.String("driver", "ipmi"),
+			attribute.String("result", "success"),
+			attribute.String("label_zone", ""),
+		): 1,
+	}, counts)
+}
+
+func TestMachineBucket(t *testing.T) {
+	buckets := map[string]struct{}{}
+
+	for i := 0; i < 1000; i++ {
+		bucket := machineBucket(fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+		buckets[bucket] = struct{}{}
+	}
+
+	assert.Len(t, buckets, machineBucketCount)
+	assert.Equal(t, machineBucket("10.0.0.1"), machineBucket("10.0.0.1"))
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"gopkg.in/yaml.v3"
+
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+var (
+	// ErrSecretNotFound is an error for when a secret reference cannot be
+	// resolved by the secret provider
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrNoSecretProvider is an error for when a power command references
+	// a secret, but no secret provider is configured
+	ErrNoSecretProvider = errors.New("no secret provider configured")
+)
+
+// SecretProvider resolves a secret reference into driver options (e.g.
+// power_user and power_pass), so BMC credentials are not part of activity
+// inputs and never enter workflow history.
+type SecretProvider interface {
+	// Resolve returns driver options referenced by ref. It returns an error
+	// wrapping ErrSecretNotFound, if there is no such secret.
+	Resolve(ctx context.Context, ref string) (map[string]interface{}, error)
+}
+
+// fileSecretProvider resolves references to YAML or JSON files with driver
+// options in a directory, e.g. ref "rack-1/node-3" is <dir>/rack-1/node-3.
+type fileSecretProvider struct {
+	dir string
+}
+
+// NewFileSecretProvider returns SecretProvider that reads secrets from
+// files in dir.
+func NewFileSecretProvider(dir string) SecretProvider {
+	return &fileSecretProvider{dir: dir}
+}
+
+func (p *fileSecretProvider) Resolve(_ context.Context, ref string) (map[string]interface{}, error) {
+	// References must not escape the directory.
+	if !filepath.IsLocal(ref) {
+		return nil, fmt.Errorf("%w: invalid reference %q", ErrSecretNotFound, ref)
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.dir, ref))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %q", ErrSecretNotFound, ref)
+		}
+
+		return nil, err
+	}
+
+	var opts map[string]interface{}
+
+	// YAML is a superset of JSON, so both formats are accepted.
+	if err := yaml.Unmarshal(data, &opts); err != nil {
+		return nil, fmt.Errorf("malformed secret %q: %w", ref, err)
+	}
+
+	return opts, nil
+}
+
+// vaultSecretProvider resolves references to paths of secrets in KV version 2
+// secrets engine of HashiCorp Vault, e.g. ref "bmc/node-3" is read from
+// <address>/v1/<mount>/data/bmc/node-3.
+type vaultSecretProvider struct {
+	client  *http.Client
+	address string
+	token   string
+	mount   string
+}
+
+// NewVaultSecretProvider returns SecretProvider that reads secrets from
+// Vault at address, authenticating with token. Mount is a path of the KV
+// version 2 secrets engine. (default: secret)
+func NewVaultSecretProvider(address, token, mount string) SecretProvider {
+	if mount == "" {
+		mount = "secret"
+	}
+
+	return &vaultSecretProvider{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+	}
+}
+
+func (p *vaultSecretProvider) Resolve(ctx context.Context, ref string) (map[string]interface{}, error) {
+	u, err := url.JoinPath(p.address, "v1", p.mount, "data", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Vault-Token", p.token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:errcheck // nothing to do if close fails
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %q", ErrSecretNotFound, ref)
+	default:
+		return nil, fmt.Errorf("failed reading secret %q from Vault: %s", ref, resp.Status)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("malformed secret %q: %w", ref, err)
+	}
+
+	return secret.Data.Data, nil
+}
+
+// resolveSecret returns param with driver options from the secret referenced
+// by param.SecretRef, that take precedence over the ones in DriverOpts.
+// Param without reference is returned as is.
+func (s *PowerService) resolveSecret(ctx context.Context, action string, param PowerParam) (PowerParam, error) {
+	if param.SecretRef == "" {
+		return param, nil
+	}
+
+	if s.secrets == nil {
+		return param, temporal.NewNonRetryableApplicationError(ErrNoSecretProvider.Error(),
+			"SecretNotFound", ErrNoSecretProvider)
+	}
+
+	secret, err := s.secrets.Resolve(ctx, param.SecretRef)
+	if err != nil {
+		activity.GetLogger(ctx).Warn("Failed resolving BMC credentials",
+			tag.Builder().Error(err).
+				KV("action", action).
+				KV("secret_ref", param.SecretRef).KeyVals...)
+
+		if errors.Is(err, ErrSecretNotFound) {
+			return param, temporal.NewNonRetryableApplicationError(err.Error(), "SecretNotFound", err)
+		}
+
+		return param, err
+	}
+
+	opts := maps.Clone(param.DriverOpts)
+	if opts == nil {
+		opts = make(map[string]interface{}, len(secret))
+	}
+
+	maps.Copy(opts, secret)
+
+	param.DriverOpts = opts
+
+	return param, nil
+}
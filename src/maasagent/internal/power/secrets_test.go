@@ -0,0 +1,213 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "rack-1"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rack-1", "node-1"),
+		[]byte("power_user: admin\npower_pass: hunter2\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node-2.json"),
+		[]byte(`{"power_pass": "s3cr3t"}`), 0600))
+
+	testcases := map[string]struct {
+		ref  string
+		opts map[string]interface{}
+		err  error
+	}{
+		"yaml": {
+			ref:  "rack-1/node-1",
+			opts: map[string]interface{}{"power_user": "admin", "power_pass": "hunter2"},
+		},
+		"json": {
+			ref:  "node-2.json",
+			opts: map[string]interface{}{"power_pass": "s3cr3t"},
+		},
+		"not found": {
+			ref: "node-3",
+			err: ErrSecretNotFound,
+		},
+		"outside of directory": {
+			ref: "../node-1",
+			err: ErrSecretNotFound,
+		},
+	}
+
+	p := NewFileSecretProvider(dir)
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts, err := p.Resolve(context.Background(), tc.ref)
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.opts, opts)
+		})
+	}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if r.URL.Path != "/v1/maas/data/bmc/node-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		//nolint:errcheck // test server
+		w.Write([]byte(`{"data": {"data": {"power_pass": "hunter2"}, "metadata": {}}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	testcases := map[string]struct {
+		token string
+		ref   string
+		opts  map[string]interface{}
+		err   error
+	}{
+		"found": {
+			token: "token",
+			ref:   "bmc/node-1",
+			opts:  map[string]interface{}{"power_pass": "hunter2"},
+		},
+		"not found": {
+			token: "token",
+			ref:   "bmc/node-2",
+			err:   ErrSecretNotFound,
+		},
+		"forbidden": {
+			token: "wrong",
+			ref:   "bmc/node-1",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p := NewVaultSecretProvider(srv.URL, tc.token, "maas")
+
+			opts, err := p.Resolve(context.Background(), tc.ref)
+
+			if tc.opts != nil {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+			}
+
+			assert.Equal(t, tc.opts, opts)
+		})
+	}
+}
+
+func TestPowerOnSecretRef(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node-1"),
+		[]byte("power_pass: hunter2\n"), 0600))
+
+	// The script writes power_pass it was called with to a file.
+	script := filepath.Join(t.TempDir(), "power")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho \"$1\" > \"$2\"\n"), 0700))
+
+	testcases := map[string]struct {
+		provider SecretProvider
+		ref      string
+		pass     string
+		ok       bool
+	}{
+		"resolved": {
+			provider: NewFileSecretProvider(dir),
+			ref:      "node-1",
+			pass:     "hunter2\n",
+			ok:       true,
+		},
+		"not found": {
+			provider: NewFileSecretProvider(dir),
+			ref:      "node-2",
+		},
+		"no provider": {
+			ref: "node-1",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out := filepath.Join(t.TempDir(), "out")
+
+			svc := NewPowerService("abcdef", nil,
+				WithExecPower(map[string]string{"script": script + " {power_pass} {out}"}),
+				WithSecretProvider(tc.provider),
+			)
+
+			suite := testsuite.WorkflowTestSuite{}
+			env := suite.NewTestActivityEnvironment()
+			env.RegisterActivity(svc.PowerOn)
+
+			_, err := env.ExecuteActivity(svc.PowerOn, PowerOnParam{
+				PowerParam: PowerParam{
+					DriverType: ExecDriverType,
+					DriverOpts: map[string]interface{}{
+						"exec_command": "script",
+						"out":          out,
+						"power_pass":   "inline",
+					},
+					SecretRef: tc.ref,
+				},
+			})
+
+			if !tc.ok {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(out)
+			require.NoError(t, err)
+			assert.Equal(t, tc.pass, string(data))
+		})
+	}
+}
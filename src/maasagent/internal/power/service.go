@@ -21,15 +21,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
 	"os/exec"
 	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/metric"
 	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
 	tworker "go.temporal.io/sdk/worker"
 	tworkflow "go.temporal.io/sdk/workflow"
+	"maas.io/core/src/maasagent/internal/workflow"
 	"maas.io/core/src/maasagent/internal/workflow/log/tag"
 	"maas.io/core/src/maasagent/internal/workflow/worker"
 )
@@ -40,17 +49,234 @@ var (
 	// ErrWrongPowerState is an error for when a power action executes
 	// and the machine is found in an incorrect power state
 	ErrWrongPowerState = errors.New("BMC is in the wrong power state")
+	// ErrAuthenticationFailed is an error for when BMC rejects credentials
+	ErrAuthenticationFailed = errors.New("BMC authentication failed")
+	// ErrBMCUnreachable is an error for when power driver cannot reach BMC
+	ErrBMCUnreachable = errors.New("BMC is unreachable")
+
+	// authFailureRegexp matches power driver errors caused by rejected credentials
+	authFailureRegexp = regexp.MustCompile(`(?i)(authenticat\w* fail|unauthori[sz]ed|\b401\b|` +
+		`invalid (user|username|password|credentials)|(username|password) invalid|` +
+		`access denied|login failed|incorrect password)`)
+	// transportFailureRegexp matches power driver errors caused by transient
+	// network problems between the agent and BMC
+	transportFailureRegexp = regexp.MustCompile(`(?i)(connection (refused|reset)|timed? ?out|` +
+		`no route to host|(host|network) is unreachable|broken pipe)`)
+	// driverWarningRegexp matches stderr lines of successful power driver
+	// commands, that report recoverable problems worth surfacing to Region
+	// Controller, rather than diagnostics
+	driverWarningRegexp = regexp.MustCompile(`(?i)(\bwarn(ing)?\b|\bsensor\b|\bfault|` +
+		`\bdegraded\b|\bfail(ed|ure)?\b)`)
 )
 
 // PowerService is a service that knows how to reach BMC to perform power
 // operations. Invocation of this service normally should happen via Temporal.
 type PowerService struct {
-	pool *worker.WorkerPool
+	pool                   *worker.WorkerPool
+	metrics                *powerMetrics
+	locks                  *bmcLocks
+	lockMode               BMCLockMode
+	exec                   *execDriver
+	drivers                map[string]Driver
+	breakers               *circuitBreakers
+	bootProfiles           map[string][]BootTarget
+	bmcRetry               *bmcRetry
+	backoffStrategy        string
+	bmcAllowlist           *bmcAllowlist
+	history                *powerHistory
+	secrets                SecretProvider
+	retryWarningThreshold  int
+	metricLabels           []string
+	settleDelay            time.Duration
+	scheduleToStartTimeout time.Duration
 }
 
-func NewPowerService(systemID string, pool *worker.WorkerPool) *PowerService {
-	return &PowerService{
-		pool: pool,
+// PowerServiceOption allows to set additional PowerService options
+type PowerServiceOption func(*PowerService)
+
+func NewPowerService(systemID string, pool *worker.WorkerPool,
+	options ...PowerServiceOption) *PowerService {
+	s := &PowerService{
+		pool:                   pool,
+		metrics:                newNoopPowerMetrics(),
+		locks:                  newBMCLocks(),
+		lockMode:               BMCLockQueue,
+		scheduleToStartTimeout: workflow.DefaultScheduleToStartTimeout,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	s.drivers = newDrivers(s)
+
+	return s
+}
+
+// WithScheduleToStartTimeout sets ScheduleToStart timeout for activities
+// scheduled by the power service configuration workflow on the Region task queue.
+// (default: workflow.DefaultScheduleToStartTimeout)
+func WithScheduleToStartTimeout(timeout time.Duration) PowerServiceOption {
+	return func(s *PowerService) {
+		s.scheduleToStartTimeout = timeout
+	}
+}
+
+// WithBMCLockMode sets behaviour of a mutating power action (on, off, cycle
+// and set-boot-order), when another one is in progress for the same machine.
+// (default: BMCLockQueue)
+func WithBMCLockMode(mode BMCLockMode) PowerServiceOption {
+	return func(s *PowerService) {
+		s.lockMode = mode
+	}
+}
+
+// WithExecPower enables exec power driver, that runs one of the given
+// commands (name to command template) to perform power actions.
+// (default: exec power driver is disabled)
+func WithExecPower(commands map[string]string) PowerServiceOption {
+	return func(s *PowerService) {
+		s.exec = newExecDriver(commands)
+	}
+}
+
+// WithBootProfiles sets named boot profiles (e.g. commission, deploy or
+// rescue), that set-boot-order can reference instead of providing the final
+// order. Profile is a sequence of boot targets, see ValidateBootProfile.
+// (default: no profiles)
+func WithBootProfiles(profiles map[string][]string) PowerServiceOption {
+	return func(s *PowerService) {
+		s.bootProfiles = make(map[string][]BootTarget, len(profiles))
+
+		for name, targets := range profiles {
+			profile := make([]BootTarget, len(targets))
+			for i, target := range targets {
+				profile[i] = BootTarget(target)
+			}
+
+			s.bootProfiles[name] = profile
+		}
+	}
+}
+
+// WithBMCRetry makes power commands retry up to maxRetries times with
+// jittered exponential backoff between initial and max interval, when BMC
+// is unreachable. Retries happen within a single activity attempt.
+// maxRetries below 1 disables BMC retries. (default: disabled)
+func WithBMCRetry(initial, maxInterval time.Duration, jitter float64, maxRetries int) PowerServiceOption {
+	return func(s *PowerService) {
+		if maxRetries < 1 {
+			s.bmcRetry = nil
+			return
+		}
+
+		s.bmcRetry = &bmcRetry{
+			initialInterval: initial,
+			maxInterval:     maxInterval,
+			jitter:          jitter,
+			maxRetries:      uint64(maxRetries),
+		}
+	}
+}
+
+// WithBackoffStrategy sets strategy of BMC retries, one of
+// retry.StrategyExponential or retry.StrategyDecorrelated. Decorrelated
+// jitter spreads retries of many machines more evenly, so BMCs shared by
+// them are not hit at the same time. (default: exponential)
+func WithBackoffStrategy(strategy string) PowerServiceOption {
+	return func(s *PowerService) {
+		s.backoffStrategy = strategy
+	}
+}
+
+// WithBMCAllowedPrefixes restricts power commands to BMC addresses within
+// the given prefixes. Commands targeting other addresses fail with
+// ErrBMCNotAllowed without contacting BMC. Empty prefixes allow any address.
+// (default: any address)
+func WithBMCAllowedPrefixes(prefixes []netip.Prefix) PowerServiceOption {
+	return func(s *PowerService) {
+		if len(prefixes) == 0 {
+			s.bmcAllowlist = nil
+			return
+		}
+
+		s.bmcAllowlist = newBMCAllowlist(prefixes)
+	}
+}
+
+// WithPowerHistory makes the service keep up to size power states observed
+// by PowerQuery per machine, for up to retention, so they can be returned by
+// PowerHistory. Size below 1 disables power history. (default: disabled)
+func WithPowerHistory(size int, retention time.Duration) PowerServiceOption {
+	return func(s *PowerService) {
+		if size < 1 {
+			s.history = nil
+			return
+		}
+
+		s.history = newPowerHistory(size, retention)
+	}
+}
+
+// WithSecretProvider makes the service resolve PowerParam.SecretRef into
+// driver options with provider. Without a provider, power commands with
+// secret references fail. (default: none)
+func WithSecretProvider(provider SecretProvider) PowerServiceOption {
+	return func(s *PowerService) {
+		s.secrets = provider
+	}
+}
+
+// WithRetryWarningThreshold makes the service log a warning naming the machine,
+// when a power action needed more than threshold retries. Threshold below 1
+// disables it. (default: disabled)
+func WithRetryWarningThreshold(threshold int) PowerServiceOption {
+	return func(s *PowerService) {
+		s.retryWarningThreshold = threshold
+	}
+}
+
+// WithSettleDelay makes power on, off and cycle wait for delay after the
+// action and query the power state again, instead of returning the state
+// reported right after the action, that might still be transitioning.
+// Delay below or equal to zero disables it. PowerParam.SettleDelay overrides
+// it for a single action. (default: disabled)
+func WithSettleDelay(delay time.Duration) PowerServiceOption {
+	return func(s *PowerService) {
+		s.settleDelay = delay
+	}
+}
+
+// WithCircuitBreaker makes power actions for a machine fail fast with
+// ErrCircuitOpen for cooldown, after threshold consecutive failures within
+// window. Threshold below 1 disables the circuit breaker.
+// (default: disabled)
+func WithCircuitBreaker(threshold int, window, cooldown time.Duration) PowerServiceOption {
+	return func(s *PowerService) {
+		if threshold < 1 {
+			s.breakers = nil
+			return
+		}
+
+		s.breakers = newCircuitBreakers(threshold, window, cooldown)
+	}
+}
+
+// WithMetricLabels makes power action metrics carry machine labels with the
+// given keys (as label_<key> attributes). Only labels with a small number of
+// values (e.g. zone) should be used, to keep cardinality of metrics bounded.
+// (default: none)
+func WithMetricLabels(keys []string) PowerServiceOption {
+	return func(s *PowerService) {
+		s.metricLabels = keys
+	}
+}
+
+// WithMetricMeter allows to set OpenTelemetry metric.Meter
+// to collect power actions stats.
+func WithMetricMeter(meter metric.Meter) PowerServiceOption {
+	return func(s *PowerService) {
+		s.metrics = newPowerMetrics(meter)
 	}
 }
 
@@ -62,6 +288,50 @@ func (s *PowerService) ConfigurationActivities() map[string]interface{} {
 	return map[string]interface{}{}
 }
 
+// workerWorkflows returns workflows registered on power task queues.
+func (s *PowerService) workerWorkflows() map[string]interface{} {
+	// TODO: register workflows once they are moved to the Agent
+	return map[string]interface{}{}
+}
+
+// workerActivities returns activities registered on power task queues.
+func (s *PowerService) workerActivities() map[string]interface{} {
+	return map[string]interface{}{
+		"power-on":       s.PowerOn,
+		"power-off":      s.PowerOff,
+		"power-query":    s.PowerQuery,
+		"power-cycle":    s.PowerCycle,
+		"set-boot-order": s.SetBootOrder,
+		"power-history":  s.PowerHistory,
+	}
+}
+
+// WorkerRegistration returns workflows and activities the service registers
+// on power task queues once configured. Task queues depend on VLANs of the
+// agent known by Region Controller, so TaskQueue is not set.
+func (s *PowerService) WorkerRegistration() worker.Registration {
+	return worker.Registration{
+		Group:      powerServiceWorkerPoolGroup,
+		Workflows:  sortedNames(s.workerWorkflows()),
+		Activities: sortedNames(s.workerActivities()),
+	}
+}
+
+func sortedNames(m map[string]interface{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
 func (s *PowerService) configure(ctx tworkflow.Context, systemID string) error {
 	log := tworkflow.GetLogger(ctx)
 
@@ -84,44 +354,39 @@ func (s *PowerService) configure(ctx tworkflow.Context, systemID string) error {
 		tworkflow.WithActivityOptions(ctx,
 			tworkflow.ActivityOptions{
 				TaskQueue:              "region",
+				ScheduleToStartTimeout: s.scheduleToStartTimeout,
 				ScheduleToCloseTimeout: 60 * time.Second,
 			}),
 		"get-rack-controller-vlans", param).
 		Get(ctx, &vlansResult)
 
 	if err != nil {
+		workflow.ReportScheduleToStartTimeout(ctx, "get-rack-controller-vlans", "region", err)
 		return err
 	}
 
-	activities := map[string]interface{}{
-		"power-on":       s.PowerOn,
-		"power-off":      s.PowerOff,
-		"power-query":    s.PowerQuery,
-		"power-cycle":    s.PowerCycle,
-		"set-boot-order": s.SetBootOrder,
-	}
-
-	// TODO: register workflows once they are moved to the Agent
-	workflows := map[string]interface{}{}
+	workflows, activities := s.workerWorkflows(), s.workerActivities()
 
 	// Register workers listening VLAN specific task queue and a common one
 	// for fallback scenario for routable access.
+	taskQueues := make([]string, 0, len(vlansResult.VLANs)+1)
 	for _, vlan := range vlansResult.VLANs {
-		taskQueue := fmt.Sprintf("agent:power@vlan-%d", vlan)
-		if err := s.pool.AddWorker(powerServiceWorkerPoolGroup, taskQueue,
-			workflows, activities, tworker.Options{}); err != nil {
-			s.pool.RemoveWorkers(powerServiceWorkerPoolGroup)
-			return err
-		}
+		taskQueues = append(taskQueues, fmt.Sprintf("agent:power@vlan-%d", vlan))
 	}
 
-	taskQueue := fmt.Sprintf("%s@agent:power", systemID)
-	if err := s.pool.AddWorker(powerServiceWorkerPoolGroup, taskQueue,
-		nil, activities, tworker.Options{}); err != nil {
-		s.pool.RemoveWorkers(powerServiceWorkerPoolGroup)
+	taskQueues = append(taskQueues, fmt.Sprintf("%s@agent:power", systemID))
+
+	report, err := s.pool.AddWorkers(powerServiceWorkerPoolGroup, taskQueues,
+		workflows, activities, tworker.Options{})
+	if err != nil {
 		return err
 	}
 
+	for taskQueue, err := range report.Failed {
+		log.Error("Power worker failed to start", tag.Builder().Error(err).
+			KV("task_queue", taskQueue).KeyVals...)
+	}
+
 	log.Info("Starting power-service")
 
 	return nil
@@ -131,6 +396,20 @@ func (s *PowerService) configure(ctx tworkflow.Context, systemID string) error {
 type PowerParam struct {
 	DriverOpts map[string]interface{} `json:"driver_opts"`
 	DriverType string                 `json:"driver_type"`
+	// Machine identifies the machine, fields that are not set are taken
+	// from DriverOpts.
+	Machine workflow.MachineRef `json:"machine,omitempty"`
+	// FallbackCredentials are driver options (e.g. power_user and power_pass)
+	// that replace the ones from DriverOpts for a single retry, if BMC rejects
+	// the primary credentials.
+	FallbackCredentials map[string]interface{} `json:"fallback_credentials,omitempty"`
+	// SecretRef references driver options (e.g. BMC credentials) resolved
+	// by the configured SecretProvider at runtime, so they are not part of
+	// workflow history. Resolved options take precedence over DriverOpts.
+	SecretRef string `json:"secret_ref,omitempty"`
+	// SettleDelay overrides the settle delay of the service for the action,
+	// see WithSettleDelay.
+	SettleDelay time.Duration `json:"settle_delay,omitempty"`
 }
 
 // PowerOnParam is the activity parameter for power management of a host
@@ -141,6 +420,9 @@ type PowerOnParam struct {
 // PowerOnResult is the result of power action
 type PowerOnResult struct {
 	State string `json:"state"`
+	// Warnings are non-fatal problems BMC or the agent reported for the
+	// action, that succeeded anyway
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 // PowerOffParam is the activity parameter for power management of a host
@@ -151,6 +433,9 @@ type PowerOffParam struct {
 // PowerOffResult is the result of power action
 type PowerOffResult struct {
 	State string `json:"state"`
+	// Warnings are non-fatal problems BMC or the agent reported for the
+	// action, that succeeded anyway
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 // PowerCycleParam is the activity parameter for power management of a host
@@ -161,20 +446,86 @@ type PowerCycleParam struct {
 // PowerCycleResult is the result of power action
 type PowerCycleResult struct {
 	State string `json:"state"`
+	// Warnings are non-fatal problems BMC or the agent reported for the
+	// action, that succeeded anyway
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 // PowerQueryParam is the activity parameter for power management of a host
 type PowerQueryParam struct {
 	PowerParam
+	// MaxAge allows to answer with a power state observed by PowerQuery up
+	// to MaxAge ago, instead of querying the BMC. It requires power history
+	// (see WithPowerHistory). Zero means the BMC is always queried.
+	MaxAge time.Duration `json:"max_age,omitempty"`
 }
 
 // PowerQueryResult is the result of power action
 type PowerQueryResult struct {
 	State string `json:"state"`
+	// Warnings are non-fatal problems reported for the query, see PowerOnResult
+	Warnings []string `json:"warnings,omitempty"`
+	// Driver is the power driver type that answered the query
+	Driver string `json:"driver"`
+	// Endpoint is the BMC address the query was sent to (if known)
+	Endpoint string `json:"endpoint,omitempty"`
+	// Cached is true when State was taken from power history, instead of
+	// a live call to the BMC, see PowerQueryParam.MaxAge
+	Cached bool `json:"cached"`
+	// ObservedAt is the time State was obtained from the BMC
+	ObservedAt time.Time `json:"observed_at"`
+	// Confidence tells how trustworthy State is, so the caller can decide
+	// whether to query again before a critical action
+	Confidence PowerStateConfidence `json:"confidence"`
+}
+
+// PowerStateConfidence is returned with a queried power state
+type PowerStateConfidence string
+
+const (
+	// PowerStateLive is a power state reported by the BMC
+	PowerStateLive PowerStateConfidence = "live"
+	// PowerStateCached is a power state observed earlier, see ObservedAt
+	PowerStateCached PowerStateConfidence = "cached"
+	// PowerStateInferred is an ambiguous reading, when the BMC answered, but
+	// did not report the host as either on or off (e.g. unknown)
+	PowerStateInferred PowerStateConfidence = "inferred"
+)
+
+// powerStateConfidence returns confidence of a power state
+func powerStateConfidence(state string, cached bool) PowerStateConfidence {
+	switch {
+	case cached:
+		return PowerStateCached
+	case state == "on" || state == "off":
+		return PowerStateLive
+	default:
+		return PowerStateInferred
+	}
 }
 
-func (s *PowerService) PowerOn(ctx context.Context, param PowerOnParam) (*PowerOnResult, error) {
-	out, err := powerCommand(ctx, "on", param.DriverType, param.DriverOpts)
+func (s *PowerService) PowerOn(ctx context.Context,
+	param PowerOnParam) (res *PowerOnResult, err error) {
+	defer func(start time.Time) {
+		s.metrics.record(ctx, "on", param.DriverType, start, err,
+			labelAttributes(s.metricLabels, param.Machine.Labels)...)
+	}(time.Now())
+
+	ctx, warns := withWarnings(ctx)
+
+	release, err := s.lockBMC(ctx, param.PowerParam)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	out, err := s.runPowerCommand(ctx, "on", param.PowerParam)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err = s.settle(ctx, param.PowerParam, out)
 	if err != nil {
 		return nil, err
 	}
@@ -185,10 +536,30 @@ func (s *PowerService) PowerOn(ctx context.Context, param PowerOnParam) (*PowerO
 		return nil, ErrWrongPowerState
 	}
 
-	return &PowerOnResult{State: out}, nil
+	return &PowerOnResult{State: out, Warnings: warns.get()}, nil
 }
-func (s *PowerService) PowerOff(ctx context.Context, param PowerOffParam) (*PowerOffResult, error) {
-	out, err := powerCommand(ctx, "off", param.DriverType, param.DriverOpts)
+func (s *PowerService) PowerOff(ctx context.Context,
+	param PowerOffParam) (res *PowerOffResult, err error) {
+	defer func(start time.Time) {
+		s.metrics.record(ctx, "off", param.DriverType, start, err,
+			labelAttributes(s.metricLabels, param.Machine.Labels)...)
+	}(time.Now())
+
+	ctx, warns := withWarnings(ctx)
+
+	release, err := s.lockBMC(ctx, param.PowerParam)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	out, err := s.runPowerCommand(ctx, "off", param.PowerParam)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err = s.settle(ctx, param.PowerParam, out)
 	if err != nil {
 		return nil, err
 	}
@@ -199,10 +570,30 @@ func (s *PowerService) PowerOff(ctx context.Context, param PowerOffParam) (*Powe
 		return nil, ErrWrongPowerState
 	}
 
-	return &PowerOffResult{State: out}, nil
+	return &PowerOffResult{State: out, Warnings: warns.get()}, nil
 }
-func (s *PowerService) PowerCycle(ctx context.Context, param PowerCycleParam) (*PowerCycleResult, error) {
-	out, err := powerCommand(ctx, "cycle", param.DriverType, param.DriverOpts)
+func (s *PowerService) PowerCycle(ctx context.Context,
+	param PowerCycleParam) (res *PowerCycleResult, err error) {
+	defer func(start time.Time) {
+		s.metrics.record(ctx, "cycle", param.DriverType, start, err,
+			labelAttributes(s.metricLabels, param.Machine.Labels)...)
+	}(time.Now())
+
+	ctx, warns := withWarnings(ctx)
+
+	release, err := s.lockBMC(ctx, param.PowerParam)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	out, err := s.runPowerCommand(ctx, "cycle", param.PowerParam)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err = s.settle(ctx, param.PowerParam, out)
 	if err != nil {
 		return nil, err
 	}
@@ -213,37 +604,402 @@ func (s *PowerService) PowerCycle(ctx context.Context, param PowerCycleParam) (*
 		return nil, ErrWrongPowerState
 	}
 
-	return &PowerCycleResult{State: out}, nil
+	return &PowerCycleResult{State: out, Warnings: warns.get()}, nil
 }
 
-func (s *PowerService) PowerQuery(ctx context.Context, param PowerQueryParam) (*PowerQueryResult, error) {
-	out, err := powerCommand(ctx, "status", param.DriverType, param.DriverOpts)
+// settle waits for the settle delay after a power action, so BMC finishes the
+// transition, and returns the power state queried afterwards. The output of
+// the action is returned as is, if there is no settle delay.
+func (s *PowerService) settle(ctx context.Context, param PowerParam, out string) (string, error) {
+	delay := s.settleDelay
+	if param.SettleDelay > 0 {
+		delay = param.SettleDelay
+	}
+
+	if delay <= 0 {
+		return out, nil
+	}
+
+	activity.RecordHeartbeat(ctx)
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	return s.queryStatus(ctx, param)
+}
+
+// queryStatus returns the power state queried after a power action. Unlike
+// runPowerCommand, it is not accounted as another power command, so retries
+// and the audit log of the action are not reported twice.
+func (s *PowerService) queryStatus(ctx context.Context, param PowerParam) (string, error) {
+	param, err := s.resolveSecret(ctx, "status", param)
+	if err != nil {
+		return "", err
+	}
+
+	out, _, err := s.runPowerCommandWithFallback(ctx, "status", param)
+
+	return out, err
+}
+
+func (s *PowerService) PowerQuery(ctx context.Context,
+	param PowerQueryParam) (res *PowerQueryResult, err error) {
+	key := machineRef(param.PowerParam).Key()
+
+	// Cached answers are not power commands, so they are not accounted.
+	if o, ok := s.cachedPowerState(key, param.MaxAge); ok {
+		return &PowerQueryResult{
+			State:      o.State,
+			Driver:     param.DriverType,
+			Endpoint:   powerEndpoint(param.DriverOpts),
+			Cached:     true,
+			ObservedAt: o.ObservedAt,
+			Confidence: powerStateConfidence(o.State, true),
+		}, nil
+	}
+
+	defer func(start time.Time) {
+		s.metrics.record(ctx, "status", param.DriverType, start, err,
+			labelAttributes(s.metricLabels, param.Machine.Labels)...)
+	}(time.Now())
+
+	ctx, warns := withWarnings(ctx)
+
+	out, err := s.runPowerCommand(ctx, "status", param.PowerParam)
 	if err != nil {
 		return nil, err
 	}
 
 	out = strings.TrimSpace(out)
+	observedAt := time.Now().UTC()
 
-	return &PowerQueryResult{State: out}, nil
+	if s.history != nil && key != "" {
+		s.history.record(key, PowerObservation{State: out, ObservedAt: observedAt})
+	}
+
+	return &PowerQueryResult{
+		State:      out,
+		Driver:     param.DriverType,
+		Endpoint:   powerEndpoint(param.DriverOpts),
+		ObservedAt: observedAt,
+		Confidence: powerStateConfidence(out, false),
+		Warnings:   warns.get(),
+	}, nil
+}
+
+// cachedPowerState returns the most recent power state of the machine
+// identified by key from power history, if it was observed up to maxAge ago.
+func (s *PowerService) cachedPowerState(key string, maxAge time.Duration) (PowerObservation, bool) {
+	if maxAge <= 0 || s.history == nil || key == "" {
+		return PowerObservation{}, false
+	}
+
+	return s.history.latest(key, maxAge)
 }
 
 type SetBootOrderParam struct {
 	SystemID    string                   `json:"system_id"`
 	PowerParams PowerParam               `json:"power_param"`
 	Order       []map[string]interface{} `json:"order"`
+	// Profile is a name of the boot profile used to reorder devices of Order
+	// by their kind. Order is used as is, if empty.
+	Profile string `json:"profile,omitempty"`
+}
+
+// SetBootOrderResult is the result of set-boot-order action
+type SetBootOrderResult struct {
+	SystemID string                   `json:"system_id"`
+	Order    []map[string]interface{} `json:"order"`
+	// Previous is the boot order before it was changed, that can be set
+	// again to restore it. It is empty, if the power driver could not tell
+	// (see Warnings).
+	Previous []map[string]interface{} `json:"previous,omitempty"`
+	// Warnings are non-fatal problems reported for the action, see PowerOnResult
+	Warnings []string `json:"warnings,omitempty"`
 }
 
-func (s *PowerService) SetBootOrder(ctx context.Context, param SetBootOrderParam) error {
+func (s *PowerService) SetBootOrder(ctx context.Context,
+	param SetBootOrderParam) (res *SetBootOrderResult, err error) {
+	defer func(start time.Time) {
+		s.metrics.record(ctx, "set-boot-order", param.PowerParams.DriverType, start, err,
+			labelAttributes(s.metricLabels, param.PowerParams.Machine.Labels)...)
+	}(time.Now())
+
+	ctx, warns := withWarnings(ctx)
+
 	log := activity.GetLogger(ctx)
 
 	log.Info("setting boot order of " + param.SystemID)
 
-	_, err := powerCommand(ctx, "set-boot-order", param.PowerParams.DriverType, param.PowerParams.DriverOpts)
+	order := param.Order
+
+	if param.Profile != "" {
+		targets, ok := s.bootProfiles[param.Profile]
+		if !ok {
+			err = fmt.Errorf("%w: %q", ErrUnknownBootProfile, param.Profile)
+			return nil, temporal.NewNonRetryableApplicationError(err.Error(),
+				"UnknownBootProfile", err)
+		}
+
+		order = applyBootProfile(param.Order, targets)
+	}
+
+	if param.PowerParams.Machine.SystemID == "" {
+		param.PowerParams.Machine.SystemID = param.SystemID
+	}
+
+	release, err := s.lockBMC(ctx, param.PowerParams)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	previous, err := s.queryBootOrder(ctx, param.PowerParams)
+	if err != nil {
+		log.Warn("Cannot query boot order before changing it", tag.Builder().
+			KV("system_id", param.SystemID).Error(err).KeyVals...)
+		addWarning(ctx, "previous boot order is unknown: %v", err)
+	}
+
+	_, err = s.runPowerCommand(ctx, "set-boot-order", param.PowerParams, order...)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Boot order applied", tag.Builder().
+		KV("system_id", param.SystemID).
+		KV("profile", param.Profile).
+		KV("previous", previous).
+		KV("order", order).KeyVals...)
+
+	return &SetBootOrderResult{
+		SystemID: param.SystemID,
+		Order:    order,
+		Previous: previous,
+		Warnings: warns.get(),
+	}, nil
+}
+
+// queryBootOrder returns the boot order reported by the power driver as
+// a JSON list of devices. Like queryStatus, it is not accounted as another
+// power command.
+func (s *PowerService) queryBootOrder(ctx context.Context,
+	param PowerParam) ([]map[string]interface{}, error) {
+	param, err := s.resolveSecret(ctx, "get-boot-order", param)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkBMCAllowed(ctx, "get-boot-order", param); err != nil {
+		return nil, err
+	}
+
+	out, _, err := s.runPowerCommandWithFallback(ctx, "get-boot-order", param)
+	if err != nil {
+		return nil, err
+	}
+
+	var order []map[string]interface{}
+
+	if err := json.Unmarshal([]byte(out), &order); err != nil {
+		return nil, fmt.Errorf("malformed boot order: %w", err)
+	}
+
+	return order, nil
+}
+
+// lockBMC acquires lock of the machine managed by the power driver according
+// to the lock mode. Returned function must be called to release the lock.
+func (s *PowerService) lockBMC(ctx context.Context, param PowerParam) (func(), error) {
+	key := machineRef(param).Key()
+	if s.lockMode == BMCLockDisabled || key == "" {
+		return func() {}, nil
+	}
+
+	release, err := s.locks.acquire(ctx, key, s.lockMode != BMCLockFailFast)
+	if errors.Is(err, ErrBMCBusy) {
+		// There is no point retrying, the caller asked to fail fast.
+		return nil, temporal.NewNonRetryableApplicationError(err.Error(), "BMCBusy", err)
+	}
+
+	return release, err
+}
+
+// runPowerCommand executes power command with the driver options from param,
+// unless BMC address is not allowed or circuit breaker of the machine is open.
+func (s *PowerService) runPowerCommand(ctx context.Context, action string, param PowerParam,
+	bootOrder ...map[string]interface{}) (string, error) {
+	param, err := s.resolveSecret(ctx, action, param)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.checkBMCAllowed(ctx, action, param); err != nil {
+		return "", err
+	}
+
+	ref := machineRef(param)
+	key := ref.Key()
+
+	// Previous attempts of the activity are retries as well.
+	retries := int(activity.GetInfo(ctx).Attempt) - 1
+
+	defer func() {
+		s.metrics.recordRetries(ctx, param.DriverType, key, retries, err,
+			labelAttributes(s.metricLabels, ref.Labels)...)
+		s.reportRetries(ctx, action, ref, retries)
+		s.audit(ctx, action, param.DriverType, ref, err)
+	}()
+
+	var (
+		out string
+		n   int
+	)
+
+	if s.breakers == nil || key == "" {
+		out, n, err = s.runPowerCommandWithFallback(ctx, action, param, bootOrder...)
+		retries += n
+
+		return out, err
+	}
+
+	if err = s.breakers.allow(key); err != nil {
+		md, _ := workflow.RequestMetadataFromContext(ctx)
+
+		activity.GetLogger(ctx).Warn("Power command rejected by circuit breaker",
+			tag.Builder().Request(md.RequestID, md.Tenant).
+				KV("action", action).KV("machine", key).KeyVals...)
+
+		return "", temporal.NewApplicationErrorWithCause(err.Error(), "CircuitOpen", err)
+	}
+
+	out, n, err = s.runPowerCommandWithFallback(ctx, action, param, bootOrder...)
+	retries += n
+
+	s.breakers.record(key, err)
+
+	return out, err
+}
+
+// reportRetries logs power commands that needed more retries than
+// the configured threshold, naming the machine, so BMCs that are about to
+// fail can be noticed.
+func (s *PowerService) reportRetries(ctx context.Context, action string,
+	ref workflow.MachineRef, retries int) {
+	if s.retryWarningThreshold < 1 || retries <= s.retryWarningThreshold {
+		return
+	}
+
+	md, _ := workflow.RequestMetadataFromContext(ctx)
+
+	activity.GetLogger(ctx).Warn("Power command required many retries",
+		tag.Builder().Request(md.RequestID, md.Tenant).
+			KV("action", action).
+			KV("system_id", ref.SystemID).
+			KV("machine_id", ref.MachineID).
+			KV("bmc_endpoint", ref.BMCEndpoint).
+			KV("labels", ref.Labels).
+			KV("retries", retries).
+			KV("threshold", s.retryWarningThreshold).KeyVals...)
+
+	addWarning(ctx, "power command needed %d retries", retries)
+}
+
+// audit logs the outcome of a power command with the machine and its labels,
+// so power actions can be traced back and grouped by machine attributes.
+func (s *PowerService) audit(ctx context.Context, action, driver string,
+	ref workflow.MachineRef, err error) {
+	md, _ := workflow.RequestMetadataFromContext(ctx)
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	activity.GetLogger(ctx).Info("Power command executed",
+		tag.Builder().Request(md.RequestID, md.Tenant).
+			KV("action", action).
+			KV("driver", driver).
+			KV("system_id", ref.SystemID).
+			KV("machine_id", ref.MachineID).
+			KV("bmc_endpoint", ref.BMCEndpoint).
+			KV("labels", ref.Labels).
+			KV("warnings", warningsFromContext(ctx)).
+			KV("result", result).KeyVals...)
+}
+
+// runPowerCommandWithFallback executes power command with the driver options
+// from param. If BMC rejects the credentials and fallback credentials are
+// provided, the command is retried once with them. Other errors are returned
+// as is. It also returns the number of retries made.
+func (s *PowerService) runPowerCommandWithFallback(ctx context.Context, action string,
+	param PowerParam, bootOrder ...map[string]interface{}) (string, int, error) {
+	out, retries, err := s.powerCommandWithRetry(ctx, action, param.DriverType, param.DriverOpts, bootOrder...)
+	if !errors.Is(err, ErrAuthenticationFailed) || len(param.FallbackCredentials) == 0 {
+		return out, retries, err
+	}
+
+	log := activity.GetLogger(ctx)
+
+	log.Warn("Primary BMC credentials rejected, retrying with fallback credentials",
+		tag.Builder().KV("action", action).KV("driver", param.DriverType).KeyVals...)
+
+	opts := maps.Clone(param.DriverOpts)
+	if opts == nil {
+		opts = make(map[string]interface{}, len(param.FallbackCredentials))
+	}
+
+	maps.Copy(opts, param.FallbackCredentials)
 
-	return err
+	out, n, err := s.powerCommandWithRetry(ctx, action, param.DriverType, opts, bootOrder...)
+	// The fallback attempt is a retry as well.
+	retries += n + 1
+
+	if err != nil {
+		return out, retries, err
+	}
+
+	// Region Controller can promote fallback credentials based on this message.
+	log.Warn("Power command succeeded with fallback BMC credentials",
+		tag.Builder().KV("action", action).
+			KV("driver", param.DriverType).
+			KV("credentials", "fallback").KeyVals...)
+
+	addWarning(ctx, "primary BMC credentials were rejected, fallback credentials were used")
+
+	return out, retries, nil
+}
+
+// powerCommand executes power command using the power driver registered for
+// the driver type or MAAS power CLI, if there is none.
+func (s *PowerService) powerCommand(ctx context.Context, action, driver string,
+	opts map[string]interface{}, bootOrder ...map[string]interface{}) (string, error) {
+	if d, ok := s.drivers[driver]; ok {
+		return d.Run(ctx, action, opts, bootOrder...)
+	}
+
+	return powerCLICommand(ctx, action, driver, opts, bootOrder...)
 }
 
-func powerCommand(ctx context.Context, action, driver string, opts map[string]interface{}, bootOrder ...map[string]interface{}) (string, error) {
+// driverError wraps err of a failed power driver command with
+// ErrAuthenticationFailed or ErrBMCUnreachable, if stderr of the command
+// tells so.
+func driverError(stderr string, err error) error {
+	switch {
+	case authFailureRegexp.MatchString(stderr):
+		return fmt.Errorf("%w: %w", ErrAuthenticationFailed, err)
+	case transportFailureRegexp.MatchString(stderr):
+		return fmt.Errorf("%w: %w", ErrBMCUnreachable, err)
+	default:
+		return err
+	}
+}
+
+func powerCLICommand(ctx context.Context, action, driver string, opts map[string]interface{}, bootOrder ...map[string]interface{}) (string, error) {
 	log := activity.GetLogger(ctx)
 
 	maasPowerCLI, err := exec.LookPath(powerCLIExecutableName())
@@ -272,7 +1028,8 @@ func powerCommand(ctx context.Context, action, driver string, opts map[string]in
 			bootOrderStr[i] = string(dev)
 		}
 
-		args = append(args, "--order", "'"+strings.Join(bootOrderStr, ",")+"'")
+		// The command is not run by a shell, so the order is not quoted.
+		args = append(args, "--order", strings.Join(bootOrderStr, ","))
 	}
 
 	log.Debug("Executing MAAS power CLI", tag.Builder().KV("args", args).KeyVals...)
@@ -285,8 +1042,18 @@ func powerCommand(ctx context.Context, action, driver string, opts map[string]in
 	cmd.Stderr = &stderr
 
 	err = cmd.Run()
+	if err != nil && ctx.Err() != nil {
+		log.Warn("Power command was cancelled", tag.Builder().
+			KV("action", action).
+			KV("reason", workflow.GetCancellationReason(ctx)).KeyVals...)
+
+		return "", ctx.Err()
+	}
+
 	if err != nil {
-		t := tag.Builder().Error(err)
+		md, _ := workflow.RequestMetadataFromContext(ctx)
+
+		t := tag.Builder().Request(md.RequestID, md.Tenant).Error(err)
 		if stdout.String() != "" {
 			t = t.KV("stdout", stdout.String())
 		}
@@ -297,12 +1064,88 @@ func powerCommand(ctx context.Context, action, driver string, opts map[string]in
 
 		log.Error("Error executing power command", t.KeyVals...)
 
-		return "", err
+		return "", driverError(stderr.String(), err)
+	}
+
+	// Drivers report recoverable problems (e.g. BMC sensor faults) to stderr,
+	// along with diagnostics, that are only logged.
+	warnings, other := driverWarnings(stderr.String())
+	for _, msg := range warnings {
+		addWarning(ctx, "power driver: %s", msg)
+	}
+
+	if other != "" {
+		log.Debug("Power command stderr", tag.Builder().
+			KV("action", action).
+			KV("stderr", other).KeyVals...)
 	}
 
 	return stdout.String(), nil
 }
 
+// driverWarnings splits stderr of a successful power driver command into
+// lines matching driverWarningRegexp and the rest of it.
+func driverWarnings(stderr string) ([]string, string) {
+	var warnings, other []string
+
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+		case driverWarningRegexp.MatchString(line):
+			warnings = append(warnings, line)
+		default:
+			other = append(other, line)
+		}
+	}
+
+	return warnings, strings.Join(other, "\n")
+}
+
+// Capabilities describes power drivers available to PowerService
+type Capabilities struct {
+	// PowerCLI is true if MAAS power CLI is installed
+	PowerCLI bool `json:"power_cli"`
+	// Drivers are power driver types handled by the agent itself,
+	// instead of MAAS power CLI
+	Drivers []string `json:"drivers,omitempty"`
+	// ExecCommands are names of commands allowed for the exec driver,
+	// empty if the exec driver is disabled
+	ExecCommands []string `json:"exec_commands,omitempty"`
+	// BootProfiles are names of boot profiles set-boot-order can reference
+	BootProfiles []string `json:"boot_profiles,omitempty"`
+}
+
+// Capabilities returns power drivers currently available to the service.
+func (s *PowerService) Capabilities() Capabilities {
+	_, err := LookPowerCLI()
+
+	c := Capabilities{PowerCLI: err == nil, Drivers: RegisteredDrivers()}
+
+	if s.exec != nil {
+		for name := range s.exec.commands {
+			c.ExecCommands = append(c.ExecCommands, name)
+		}
+
+		slices.Sort(c.ExecCommands)
+	}
+
+	for name := range s.bootProfiles {
+		c.BootProfiles = append(c.BootProfiles, name)
+	}
+
+	slices.Sort(c.BootProfiles)
+
+	return c
+}
+
+// LookPowerCLI returns path to MAAS power CLI, or an error if it is not
+// installed.
+func LookPowerCLI() (string, error) {
+	return exec.LookPath(powerCLIExecutableName())
+}
+
 // powerCLIExecutableName returns correct MAAS Power CLI executable name
 // depending on the installation type (snap or deb package)
 func powerCLIExecutableName() string {
@@ -313,6 +1156,30 @@ func powerCLIExecutableName() string {
 	return "maas-power"
 }
 
+// powerEndpoint returns BMC endpoint based on the power driver options.
+// Most of the power drivers use 'power_address' and optional 'power_port'.
+// Some (e.g. Redfish) use a URL as 'power_address', that is returned as is.
+func powerEndpoint(opts map[string]interface{}) string {
+	address, ok := opts["power_address"]
+	if !ok || address == nil {
+		return ""
+	}
+
+	endpoint := fmt.Sprintf("%v", address)
+
+	if u, err := url.Parse(endpoint); err == nil && u.Scheme != "" && u.Host != "" {
+		return endpoint
+	}
+
+	if port, ok := opts["power_port"]; ok && port != nil {
+		if portStr := fmt.Sprintf("%v", port); portStr != "" && endpoint != "" {
+			endpoint = net.JoinHostPort(endpoint, portStr)
+		}
+	}
+
+	return endpoint
+}
+
 func fmtPowerOpts(opts map[string]interface{}) []string {
 	var res []string
 
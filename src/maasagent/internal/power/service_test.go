@@ -16,9 +16,17 @@
 package power
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/testsuite"
 )
 
 func TestFmtPowerOpts(t *testing.T) {
@@ -67,3 +75,353 @@ func TestFmtPowerOpts(t *testing.T) {
 		})
 	}
 }
+
+func TestPowerEndpoint(t *testing.T) {
+	testcases := map[string]struct {
+		in  map[string]interface{}
+		out string
+	}{
+		"address": {
+			in:  map[string]interface{}{"power_address": "10.0.0.1"},
+			out: "10.0.0.1",
+		},
+		"address and port": {
+			in:  map[string]interface{}{"power_address": "10.0.0.1", "power_port": 623},
+			out: "10.0.0.1:623",
+		},
+		"empty port": {
+			in:  map[string]interface{}{"power_address": "10.0.0.1", "power_port": ""},
+			out: "10.0.0.1",
+		},
+		"url": {
+			in:  map[string]interface{}{"power_address": "https://10.0.0.1:8443/redfish/v1", "power_port": 623},
+			out: "https://10.0.0.1:8443/redfish/v1",
+		},
+		"host and port": {
+			in:  map[string]interface{}{"power_address": "bmc.example.com", "power_port": 623},
+			out: "bmc.example.com:623",
+		},
+		"no address": {
+			in:  map[string]interface{}{"power_port": 623},
+			out: "",
+		},
+		"null address": {
+			in:  map[string]interface{}{"power_address": nil},
+			out: "",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			res := powerEndpoint(tc.in)
+			assert.Equal(t, tc.out, res)
+		})
+	}
+}
+
+// fakePowerCLI installs a fake MAAS power CLI that reports "on" only when
+// called with the given password, and authentication failure otherwise.
+func fakePowerCLI(t *testing.T, password string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$*" in
+  *"--power-pass ` + password + `"*) echo on ;;
+  *) echo "Authentication failed" >&2; exit 1 ;;
+esac
+`
+
+	//nolint:gosec // the script has to be executable
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "maas.power"), []byte(script), 0700))
+
+	t.Setenv("SNAP", "")
+	t.Setenv("PATH", dir)
+}
+
+func TestPowerOnFallbackCredentials(t *testing.T) {
+	testcases := map[string]struct {
+		param    PowerOnParam
+		err      error
+		warnings int
+	}{
+		"primary credentials": {
+			param: PowerOnParam{PowerParam: PowerParam{
+				DriverType: "ipmi",
+				DriverOpts: map[string]interface{}{"power_pass": "current"},
+				FallbackCredentials: map[string]interface{}{
+					"power_pass": "next",
+				},
+			}},
+		},
+		"fallback credentials": {
+			param: PowerOnParam{PowerParam: PowerParam{
+				DriverType: "ipmi",
+				DriverOpts: map[string]interface{}{"power_pass": "previous"},
+				FallbackCredentials: map[string]interface{}{
+					"power_pass": "current",
+				},
+			}},
+			warnings: 1,
+		},
+		"no fallback credentials": {
+			param: PowerOnParam{PowerParam: PowerParam{
+				DriverType: "ipmi",
+				DriverOpts: map[string]interface{}{"power_pass": "previous"},
+			}},
+			err: ErrAuthenticationFailed,
+		},
+		"wrong fallback credentials": {
+			param: PowerOnParam{PowerParam: PowerParam{
+				DriverType: "ipmi",
+				DriverOpts: map[string]interface{}{"power_pass": "previous"},
+				FallbackCredentials: map[string]interface{}{
+					"power_pass": "next",
+				},
+			}},
+			err: ErrAuthenticationFailed,
+		},
+	}
+
+	fakePowerCLI(t, "current")
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			svc := NewPowerService("abcdef", nil)
+
+			suite := testsuite.WorkflowTestSuite{}
+			env := suite.NewTestActivityEnvironment()
+			env.RegisterActivity(svc.PowerOn)
+
+			res, err := env.ExecuteActivity(svc.PowerOn, tc.param)
+			if tc.err != nil {
+				assert.ErrorContains(t, err, tc.err.Error())
+				return
+			}
+
+			require.NoError(t, err)
+
+			var result PowerOnResult
+			require.NoError(t, res.Get(&result))
+			assert.Equal(t, "on", result.State)
+			assert.Len(t, result.Warnings, tc.warnings)
+		})
+	}
+}
+
+func TestPowerQueryDriverWarnings(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Using lanplus interface' >&2\necho 'PSU 2 sensor fault' >&2\necho on\n"
+
+	//nolint:gosec // the script has to be executable
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "maas.power"), []byte(script), 0700))
+
+	t.Setenv("SNAP", "")
+	t.Setenv("PATH", dir)
+
+	svc := NewPowerService("abcdef", nil)
+
+	suite := testsuite.WorkflowTestSuite{}
+	env := suite.NewTestActivityEnvironment()
+	env.RegisterActivity(svc.PowerQuery)
+
+	res, err := env.ExecuteActivity(svc.PowerQuery, PowerQueryParam{
+		PowerParam: PowerParam{DriverType: "ipmi", DriverOpts: map[string]interface{}{}},
+	})
+	require.NoError(t, err)
+
+	var result PowerQueryResult
+	require.NoError(t, res.Get(&result))
+	assert.Equal(t, "on", result.State)
+	assert.Equal(t, []string{"power driver: PSU 2 sensor fault"}, result.Warnings)
+}
+
+func TestSetBootOrder(t *testing.T) {
+	testcases := map[string]struct {
+		query    string
+		previous []map[string]interface{}
+		warnings int
+	}{
+		"previous order": {
+			query:    `echo '[{"name": "sda"}, {"name": "eth0", "mac_address": "00:16:3e:00:00:01"}]'`,
+			previous: []map[string]interface{}{{"name": "sda"}, {"name": "eth0", "mac_address": "00:16:3e:00:00:01"}},
+		},
+		"query not supported": {
+			query:    `echo 'unknown action' >&2; exit 2`,
+			warnings: 1,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			script := `#!/bin/sh
+case "$1" in
+  get-boot-order) ` + tc.query + ` ;;
+  set-boot-order) printf '%s\n' "$@" > "$(dirname "$0")/args" ;;
+esac
+`
+			//nolint:gosec // the script has to be executable
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "maas.power"), []byte(script), 0700))
+
+			t.Setenv("SNAP", "")
+			t.Setenv("PATH", dir+":/usr/bin:/bin")
+
+			svc := NewPowerService("abcdef", nil)
+
+			suite := testsuite.WorkflowTestSuite{}
+			env := suite.NewTestActivityEnvironment()
+			env.RegisterActivity(svc.SetBootOrder)
+
+			order := []map[string]interface{}{
+				{"name": "eth0", "mac_address": "00:16:3e:00:00:01"},
+				{"name": "sda"},
+			}
+
+			res, err := env.ExecuteActivity(svc.SetBootOrder, SetBootOrderParam{
+				SystemID:    "abcdef",
+				PowerParams: PowerParam{DriverType: "ipmi", DriverOpts: map[string]interface{}{}},
+				Order:       order,
+			})
+			require.NoError(t, err)
+
+			var result SetBootOrderResult
+			require.NoError(t, res.Get(&result))
+			assert.Equal(t, order, result.Order)
+			assert.Equal(t, tc.previous, result.Previous)
+			assert.Len(t, result.Warnings, tc.warnings)
+
+			// The order is passed as a single argument, without shell quoting
+			args, err := os.ReadFile(filepath.Join(dir, "args"))
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"set-boot-order", "ipmi", "--order",
+				`{"mac_address":"00:16:3e:00:00:01","name":"eth0"},{"name":"sda"}`,
+			}, strings.Split(strings.TrimSuffix(string(args), "\n"), "\n"))
+		})
+	}
+}
+
+func TestDriverWarnings(t *testing.T) {
+	testcases := map[string]struct {
+		stderr   string
+		warnings []string
+		other    string
+	}{
+		"empty":       {},
+		"diagnostics": {stderr: "Using lanplus interface\nSession opened\n", other: "Using lanplus interface\nSession opened"},
+		"warning":     {stderr: "WARNING: chassis intrusion detected\n", warnings: []string{"WARNING: chassis intrusion detected"}},
+		"mixed": {
+			stderr:   "Using lanplus interface\n  PSU 2 sensor fault\n\nFan 3 degraded\n",
+			warnings: []string{"PSU 2 sensor fault", "Fan 3 degraded"},
+			other:    "Using lanplus interface",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			warnings, other := driverWarnings(tc.stderr)
+
+			assert.Equal(t, tc.warnings, warnings)
+			assert.Equal(t, tc.other, other)
+		})
+	}
+}
+
+func TestSettleDelay(t *testing.T) {
+	dir := t.TempDir()
+	// BMC reports the transition right after the action
+	script := `#!/bin/sh
+case "$1" in
+  status) echo on ;;
+  *) echo transitioning ;;
+esac
+`
+
+	//nolint:gosec // the script has to be executable
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "maas.power"), []byte(script), 0700))
+
+	t.Setenv("SNAP", "")
+	t.Setenv("PATH", dir)
+
+	testcases := map[string]struct {
+		options []PowerServiceOption
+		delay   time.Duration
+		err     error
+	}{
+		"no settle delay": {
+			err: ErrWrongPowerState,
+		},
+		"service settle delay": {
+			options: []PowerServiceOption{WithSettleDelay(time.Millisecond)},
+		},
+		"action settle delay": {
+			delay: time.Millisecond,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			svc := NewPowerService("abcdef", nil, tc.options...)
+
+			logger := &auditLogger{}
+
+			suite := testsuite.WorkflowTestSuite{}
+			suite.SetLogger(logger)
+			env := suite.NewTestActivityEnvironment()
+			env.RegisterActivity(svc.PowerOn)
+
+			res, err := env.ExecuteActivity(svc.PowerOn, PowerOnParam{PowerParam: PowerParam{
+				DriverType:  "ipmi",
+				SettleDelay: tc.delay,
+			}})
+			if tc.err != nil {
+				assert.ErrorContains(t, err, tc.err.Error())
+				return
+			}
+
+			require.NoError(t, err)
+
+			var result PowerOnResult
+			require.NoError(t, res.Get(&result))
+			assert.Equal(t, "on", result.State)
+
+			// Status queried after the delay is a part of the action.
+			assert.Equal(t, 1, logger.audits())
+		})
+	}
+}
+
+// auditLogger counts audit log entries of power commands
+type auditLogger struct {
+	log.Logger
+	count atomic.Int32
+}
+
+func (l *auditLogger) Debug(string, ...interface{}) {}
+func (l *auditLogger) Warn(string, ...interface{})  {}
+func (l *auditLogger) Error(string, ...interface{}) {}
+
+func (l *auditLogger) Info(msg string, _ ...interface{}) {
+	if msg == "Power command executed" {
+		l.count.Add(1)
+	}
+}
+
+func (l *auditLogger) audits() int {
+	return int(l.count.Load())
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package power
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// maxWarningLength limits warnings taken from power driver output
+const maxWarningLength = 512
+
+type warningsKey struct{}
+
+// warnings collects non-fatal problems of a power action that succeeded
+// anyway, e.g. BMC reporting a recoverable fault, so they can be returned
+// with the result instead of hidden by it.
+type warnings struct {
+	list  []string
+	mutex sync.Mutex
+}
+
+// withWarnings returns a copy of ctx, that collects warnings added with
+// addWarning into the returned warnings.
+func withWarnings(ctx context.Context) (context.Context, *warnings) {
+	w := &warnings{}
+	return context.WithValue(ctx, warningsKey{}, w), w
+}
+
+// addWarning adds a warning to the warnings of ctx, if it collects them.
+func addWarning(ctx context.Context, format string, args ...interface{}) {
+	w, ok := ctx.Value(warningsKey{}).(*warnings)
+	if !ok {
+		return
+	}
+
+	msg := fmt.Sprintf(format, args...)
+	if len(msg) > maxWarningLength {
+		msg = msg[:maxWarningLength] + "..."
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.list = append(w.list, msg)
+}
+
+// warningsFromContext returns warnings collected by ctx so far
+func warningsFromContext(ctx context.Context) []string {
+	w, ok := ctx.Value(warningsKey{}).(*warnings)
+	if !ok {
+		return nil
+	}
+
+	return w.get()
+}
+
+// get returns a copy of the collected warnings, nil if there are none.
+func (w *warnings) get() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.list) == 0 {
+		return nil
+	}
+
+	return append([]string{}, w.list...)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package retry
+
+import (
+	"context"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+)
+
+type deadlineBackOff struct {
+	backoff.BackOff
+	ctx context.Context
+}
+
+// WithDeadline returns backoff.BackOff that returns backoff.Stop once the
+// next interval would end after the deadline of ctx. Within activities the
+// deadline is derived from Temporal server timestamps, so retries stop in time
+// with the last error, instead of being cut by the activity timeout.
+func WithDeadline(ctx context.Context, b backoff.BackOff) backoff.BackOff {
+	return &deadlineBackOff{BackOff: b, ctx: ctx}
+}
+
+// NextBackOff implements backoff.BackOff.NextBackOff.
+func (b *deadlineBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop {
+		return next
+	}
+
+	if deadline, ok := b.ctx.Deadline(); ok && time.Until(deadline) < next {
+		return backoff.Stop
+	}
+
+	return next
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDeadline(t *testing.T) {
+	testcases := map[string]struct {
+		timeout  time.Duration
+		interval time.Duration
+		out      time.Duration
+	}{
+		"no deadline": {
+			interval: time.Hour,
+			out:      time.Hour,
+		},
+		"within deadline": {
+			timeout:  time.Minute,
+			interval: time.Second,
+			out:      time.Second,
+		},
+		"past deadline": {
+			timeout:  time.Second,
+			interval: time.Minute,
+			out:      backoff.Stop,
+		},
+		"stop": {
+			timeout:  time.Minute,
+			interval: backoff.Stop,
+			out:      backoff.Stop,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				t.Cleanup(cancel)
+			}
+
+			b := WithDeadline(ctx, backoff.NewConstantBackOff(tc.interval))
+			assert.Equal(t, tc.out, b.NextBackOff())
+		})
+	}
+}
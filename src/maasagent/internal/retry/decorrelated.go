@@ -0,0 +1,91 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package retry provides retry strategies complementing the ones of
+// github.com/cenkalti/backoff/v4.
+package retry
+
+import (
+	"math/rand"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+)
+
+const (
+	// StrategyExponential is exponential backoff with randomization
+	StrategyExponential = "exponential"
+	// StrategyDecorrelated is exponential backoff with decorrelated jitter
+	StrategyDecorrelated = "decorrelated"
+)
+
+// DecorrelatedJitterBackOff is backoff.BackOff where each interval is random
+// between InitialInterval and three times the previous interval, capped at
+// MaxInterval. Unlike exponential backoff with randomization, intervals of
+// concurrent retries do not stay synchronized, so they spread more evenly.
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type DecorrelatedJitterBackOff struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// MaxElapsedTime after which backoff.Stop is returned, zero means never
+	MaxElapsedTime time.Duration
+
+	current time.Duration
+	start   time.Time
+	int63n  func(int64) int64
+}
+
+// NewDecorrelatedJitterBackOff returns DecorrelatedJitterBackOff with
+// the given intervals.
+func NewDecorrelatedJitterBackOff(initialInterval, maxInterval,
+	maxElapsedTime time.Duration) *DecorrelatedJitterBackOff {
+	b := &DecorrelatedJitterBackOff{
+		InitialInterval: initialInterval,
+		MaxInterval:     maxInterval,
+		MaxElapsedTime:  maxElapsedTime,
+		//nolint:gosec // jitter does not need a secure random generator
+		int63n: rand.Int63n,
+	}
+
+	b.Reset()
+
+	return b
+}
+
+// Reset implements backoff.BackOff.Reset.
+func (b *DecorrelatedJitterBackOff) Reset() {
+	b.current = b.InitialInterval
+	b.start = time.Now()
+}
+
+// NextBackOff implements backoff.BackOff.NextBackOff.
+func (b *DecorrelatedJitterBackOff) NextBackOff() time.Duration {
+	if b.MaxElapsedTime > 0 && time.Since(b.start) > b.MaxElapsedTime {
+		return backoff.Stop
+	}
+
+	next := b.InitialInterval
+	if spread := 3*b.current - b.InitialInterval; spread > 0 {
+		next += time.Duration(b.int63n(int64(spread)))
+	}
+
+	if b.MaxInterval > 0 && next > b.MaxInterval {
+		next = b.MaxInterval
+	}
+
+	b.current = next
+
+	return next
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package retry
+
+import (
+	"testing"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecorrelatedJitterBackOff(t *testing.T) {
+	testcases := map[string]struct {
+		int63n func(int64) int64
+		out    []time.Duration
+	}{
+		"lowest": {
+			int63n: func(int64) int64 { return 0 },
+			out:    []time.Duration{time.Second, time.Second, time.Second},
+		},
+		"highest": {
+			int63n: func(n int64) int64 { return n - 1 },
+			out: []time.Duration{
+				3*time.Second - 1,
+				9*time.Second - 4,
+				10 * time.Second,
+				10 * time.Second,
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			b := NewDecorrelatedJitterBackOff(time.Second, 10*time.Second, 0)
+			b.int63n = tc.int63n
+
+			for _, expected := range tc.out {
+				assert.Equal(t, expected, b.NextBackOff())
+			}
+		})
+	}
+}
+
+func TestDecorrelatedJitterBackOffMaxElapsedTime(t *testing.T) {
+	b := NewDecorrelatedJitterBackOff(time.Second, 10*time.Second, time.Minute)
+	assert.NotEqual(t, backoff.Stop, b.NextBackOff())
+
+	b.start = time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, backoff.Stop, b.NextBackOff())
+
+	b.Reset()
+	assert.NotEqual(t, backoff.Stop, b.NextBackOff())
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package workflow
+
+import (
+	"context"
+	"errors"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/workflow"
+)
+
+// CancellationReason describes why a workflow (and its activities) was cancelled.
+type CancellationReason string
+
+const (
+	CancellationReasonUnknown       CancellationReason = "unknown"
+	CancellationReasonUserRequested CancellationReason = "user-requested"
+	CancellationReasonSuperseded    CancellationReason = "superseded"
+	CancellationReasonTimeout       CancellationReason = "timeout"
+	CancellationReasonShutdown      CancellationReason = "shutdown"
+
+	// runs cancelled recently, there is no need to keep reasons for long
+	cancellationReasonsSize = 1024
+)
+
+// Temporal does not deliver any details together with activity cancellation,
+// so reasons are kept in-process keyed by the workflow run ID. This works for
+// workflows owned by the Agent, because their activities are executed by the
+// same process.
+var cancellationReasons = must(lru.New[string, CancellationReason](cancellationReasonsSize))
+
+// Cancel records a reason of the workflow run cancellation and calls cancel.
+// It is called by the worker pool when a workflow exceeds the maximum
+// execution time. Activities of workflows owned by Region Controller (e.g.
+// power actions) only get a reason that is known locally, see
+// GetCancellationReason.
+func Cancel(ctx workflow.Context, cancel workflow.CancelFunc, reason CancellationReason) {
+	// It is safe to do this on replay, because the same value is recorded.
+	cancellationReasons.Add(workflow.GetInfo(ctx).WorkflowExecution.RunID, reason)
+	cancel()
+}
+
+// GetCancellationReason returns a reason why the activity context was
+// cancelled: its deadline was exceeded, the worker is stopping, or a reason
+// recorded by Cancel for the workflow run. It must be called with an
+// activity context.
+func GetCancellationReason(ctx context.Context) CancellationReason {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return CancellationReasonTimeout
+	}
+
+	select {
+	case <-activity.GetWorkerStopChannel(ctx):
+		return CancellationReasonShutdown
+	default:
+	}
+
+	runID := activity.GetInfo(ctx).WorkflowExecution.RunID
+	if reason, ok := cancellationReasons.Get(runID); ok {
+		return reason
+	}
+
+	return CancellationReasonUnknown
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestCancel(t *testing.T) {
+	t.Cleanup(cancellationReasons.Purge)
+
+	var suite testsuite.WorkflowTestSuite
+
+	env := suite.NewTestWorkflowEnvironment()
+
+	var runID string
+
+	env.RegisterWorkflowWithOptions(func(ctx workflow.Context) error {
+		runID = workflow.GetInfo(ctx).WorkflowExecution.RunID
+
+		_, cancel := workflow.WithCancel(ctx)
+		Cancel(ctx, cancel, CancellationReasonSuperseded)
+
+		return nil
+	}, workflow.RegisterOptions{Name: "test"})
+
+	env.ExecuteWorkflow("test")
+	require.NoError(t, env.GetWorkflowError())
+
+	reason, ok := cancellationReasons.Get(runID)
+	assert.True(t, ok)
+	assert.Equal(t, CancellationReasonSuperseded, reason)
+}
+
+func TestGetCancellationReason(t *testing.T) {
+	t.Cleanup(cancellationReasons.Purge)
+
+	var suite testsuite.WorkflowTestSuite
+
+	env := suite.NewTestActivityEnvironment()
+
+	env.RegisterActivityWithOptions(func(ctx context.Context, record bool) (CancellationReason, error) {
+		if record {
+			cancellationReasons.Add(activity.GetInfo(ctx).WorkflowExecution.RunID,
+				CancellationReasonUserRequested)
+		}
+
+		return GetCancellationReason(ctx), nil
+	}, activity.RegisterOptions{Name: "test"})
+
+	var reason CancellationReason
+
+	res, err := env.ExecuteActivity("test", false)
+	require.NoError(t, err)
+	require.NoError(t, res.Get(&reason))
+	assert.Equal(t, CancellationReasonUnknown, reason)
+
+	res, err = env.ExecuteActivity("test", true)
+	require.NoError(t, err)
+	require.NoError(t, res.Get(&reason))
+	assert.Equal(t, CancellationReasonUserRequested, reason)
+}
@@ -25,9 +25,24 @@ import (
 	"maas.io/core/src/maasagent/internal/netmon"
 )
 
+// checkIPScanner is shared by CheckIP workflows running in the process, so
+// concurrent checks of the same addresses (e.g. during mass power on) result
+// in a single probe.
+var checkIPScanner = netmon.NewCoalescingScanner()
+
+// SetCheckIPCoalescingWindow sets for how long a CheckIP probe result is
+// shared with other CheckIP workflows checking the same addresses.
+// It is not safe to call while CheckIP workflows are running.
+func SetCheckIPCoalescingWindow(window time.Duration) {
+	checkIPScanner = netmon.NewCoalescingScanner(netmon.WithCoalescingWindow(window))
+}
+
 // CheckIPParam is a workflow parameter for the CheckIP workflow
 type CheckIPParam struct {
 	IPs []netip.Addr `json:"ips"`
+	// TTL of the probes, for networks where firewalls require a certain TTL.
+	// (default: OS default)
+	TTL int `json:"ttl,omitempty"`
 }
 
 // CheckIPResult is a value returned by the CheckIP workflow
@@ -44,7 +59,8 @@ func CheckIP(ctx workflow.Context, param CheckIPParam) (CheckIPResult, error) {
 
 	var scanned map[netip.Addr]net.HardwareAddr
 
-	err := workflow.ExecuteLocalActivity(ctx, netmon.Scan, param.IPs).Get(ctx, &scanned)
+	err := workflow.ExecuteLocalActivity(ctx, checkIPScanner.ScanWithOptions, param.IPs,
+		netmon.ScanOptions{TTL: param.TTL}).Get(ctx, &scanned)
 	if err != nil {
 		return CheckIPResult{}, err
 	}
@@ -0,0 +1,65 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package workflow
+
+import (
+	"maps"
+	"sync/atomic"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+// features holds feature flags of the agent, used to roll out new behavior
+// of workflows gradually.
+var features atomic.Pointer[map[string]bool]
+
+// SetFeatures replaces feature flags of the agent. Flags that are not set are
+// disabled.
+func SetFeatures(flags map[string]bool) {
+	flags = maps.Clone(flags)
+	features.Store(&flags)
+}
+
+// Features returns a copy of feature flags of the agent.
+func Features() map[string]bool {
+	flags := features.Load()
+	if flags == nil {
+		return map[string]bool{}
+	}
+
+	return maps.Clone(*flags)
+}
+
+// FeatureEnabled returns true if feature flag name is enabled, so a workflow
+// can switch between the old and the new code path. The value is recorded in
+// the workflow history, so a replay takes the same path, even if flags were
+// changed in between.
+func FeatureEnabled(ctx workflow.Context, name string) bool {
+	var enabled bool
+
+	encoded := workflow.SideEffect(ctx, func(workflow.Context) interface{} {
+		flags := features.Load()
+		return flags != nil && (*flags)[name]
+	})
+
+	if err := encoded.Get(&enabled); err != nil {
+		// Values recorded by this function always decode, but the old code
+		// path is the safe choice anyway.
+		return false
+	}
+
+	return enabled
+}
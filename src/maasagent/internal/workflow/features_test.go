@@ -0,0 +1,51 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package workflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestFeatureEnabled(t *testing.T) {
+	SetFeatures(map[string]bool{"new-path": true, "disabled": false})
+	t.Cleanup(func() { SetFeatures(nil) })
+
+	assert.Equal(t, map[string]bool{"new-path": true, "disabled": false}, Features())
+
+	var suite testsuite.WorkflowTestSuite
+
+	env := suite.NewTestWorkflowEnvironment()
+	env.RegisterWorkflowWithOptions(func(ctx workflow.Context) ([]bool, error) {
+		return []bool{
+			FeatureEnabled(ctx, "new-path"),
+			FeatureEnabled(ctx, "disabled"),
+			FeatureEnabled(ctx, "unknown"),
+		}, nil
+	}, workflow.RegisterOptions{Name: "test"})
+
+	env.ExecuteWorkflow("test")
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	var result []bool
+	require.NoError(t, env.GetWorkflowResult(&result))
+	assert.Equal(t, []bool{true, false, false}, result)
+}
@@ -28,6 +28,20 @@ func (b *builder) TargetSystemID(systemID string) *builder {
 	return b.KV("target_system_id", systemID)
 }
 
+// Request provides KVs with tags for the given request ID and tenant,
+// if they are set
+func (b *builder) Request(requestID, tenant string) *builder {
+	if requestID != "" {
+		b.KV("request_id", requestID)
+	}
+
+	if tenant != "" {
+		b.KV("tenant", tenant)
+	}
+
+	return b
+}
+
 // Error provides a KV with a tag for the given error
 func (b *builder) Error(err error) *builder {
 	return b.KV("error", err)
@@ -0,0 +1,48 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package workflow
+
+// MachineRef identifies a machine an activity acts on. Its key is used by
+// per-machine infrastructure, such as BMC locks and circuit breakers, so all
+// of them agree on what the same machine is.
+type MachineRef struct {
+	// SystemID is the MAAS system_id of the machine
+	SystemID string `json:"system_id,omitempty"`
+	// MachineID identifies the machine on its BMC, when the BMC manages
+	// several machines (e.g. power_id of a VM on a VM host)
+	MachineID string `json:"machine_id,omitempty"`
+	// BMCEndpoint is the address of the BMC managing the machine (if known)
+	BMCEndpoint string `json:"bmc_endpoint,omitempty"`
+	// Labels are attributes of the machine known to Region Controller (e.g.
+	// zone or rack), that are included in logs and allowlisted ones in
+	// metrics. They are not a part of the key.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Key returns a key identifying the machine. The BMC endpoint (with the
+// machine ID) is preferred, because the same physical machine can be
+// referenced by different system IDs, e.g. after it was deleted and
+// enlisted again. Empty key is returned if the machine is not known.
+func (m MachineRef) Key() string {
+	switch {
+	case m.BMCEndpoint != "" && m.MachineID != "":
+		return m.BMCEndpoint + "/" + m.MachineID
+	case m.BMCEndpoint != "":
+		return m.BMCEndpoint
+	default:
+		return m.SystemID
+	}
+}
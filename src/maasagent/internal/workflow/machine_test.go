@@ -0,0 +1,57 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package workflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMachineRefKey(t *testing.T) {
+	testcases := map[string]struct {
+		in  MachineRef
+		out string
+	}{
+		"bmc endpoint": {
+			in:  MachineRef{SystemID: "abcdef", BMCEndpoint: "10.0.0.1"},
+			out: "10.0.0.1",
+		},
+		"bmc endpoint and machine id": {
+			in: MachineRef{
+				SystemID:    "abcdef",
+				MachineID:   "vm1",
+				BMCEndpoint: "qemu+ssh://10.0.0.1/system",
+			},
+			out: "qemu+ssh://10.0.0.1/system/vm1",
+		},
+		"system id": {
+			in:  MachineRef{SystemID: "abcdef", MachineID: "vm1"},
+			out: "abcdef",
+		},
+		"unknown": {},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.out, tc.in.Key())
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package workflow
+
+import (
+	"context"
+
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+)
+
+// RequestHeader is Temporal header used to propagate RequestMetadata from
+// Region Controller to workflows and activities executed by the agent.
+const RequestHeader = "maas-request"
+
+// RequestMetadata identifies a request initiated by Region Controller, so logs
+// of the agent (and of services it calls) can be correlated with it.
+type RequestMetadata struct {
+	RequestID string `json:"request_id,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
+}
+
+type requestContextKey struct{}
+
+// WithRequestMetadata returns a copy of ctx carrying request metadata, which
+// is propagated to workflows and activities started with ctx.
+func WithRequestMetadata(ctx context.Context, md RequestMetadata) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, md)
+}
+
+// RequestMetadataFromContext returns request metadata carried by ctx.
+// ctx can be either context.Context or workflow.Context.
+func RequestMetadataFromContext(ctx interface{ Value(interface{}) interface{} }) (RequestMetadata, bool) {
+	md, ok := ctx.Value(requestContextKey{}).(RequestMetadata)
+	return md, ok
+}
+
+// requestPropagator propagates RequestMetadata via RequestHeader
+type requestPropagator struct{}
+
+// NewRequestPropagator returns workflow.ContextPropagator that propagates
+// RequestMetadata from workflows into their activities and child workflows.
+func NewRequestPropagator() workflow.ContextPropagator {
+	return requestPropagator{}
+}
+
+func (requestPropagator) Inject(ctx context.Context, w workflow.HeaderWriter) error {
+	return injectRequestMetadata(ctx, w)
+}
+
+func (requestPropagator) InjectFromWorkflow(ctx workflow.Context, w workflow.HeaderWriter) error {
+	return injectRequestMetadata(ctx, w)
+}
+
+func (requestPropagator) Extract(ctx context.Context, r workflow.HeaderReader) (context.Context, error) {
+	md, ok, err := extractRequestMetadata(r)
+	if err != nil || !ok {
+		return ctx, err
+	}
+
+	return WithRequestMetadata(ctx, md), nil
+}
+
+func (requestPropagator) ExtractToWorkflow(ctx workflow.Context,
+	r workflow.HeaderReader) (workflow.Context, error) {
+	md, ok, err := extractRequestMetadata(r)
+	if err != nil || !ok {
+		return ctx, err
+	}
+
+	return workflow.WithValue(ctx, requestContextKey{}, md), nil
+}
+
+func injectRequestMetadata(ctx interface{ Value(interface{}) interface{} }, w workflow.HeaderWriter) error {
+	md, ok := RequestMetadataFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	// Header is not passed through payload codecs, so the default converter
+	// is used.
+	payload, err := converter.GetDefaultDataConverter().ToPayload(md)
+	if err != nil {
+		return err
+	}
+
+	w.Set(RequestHeader, payload)
+
+	return nil
+}
+
+func extractRequestMetadata(r workflow.HeaderReader) (RequestMetadata, bool, error) {
+	payload, ok := r.Get(RequestHeader)
+	if !ok {
+		return RequestMetadata{}, false, nil
+	}
+
+	var md RequestMetadata
+	if err := converter.GetDefaultDataConverter().FromPayload(payload, &md); err != nil {
+		return RequestMetadata{}, false, err
+	}
+
+	return md, true, nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
+)
+
+type header map[string]*commonpb.Payload
+
+func (h header) Set(key string, value *commonpb.Payload) { h[key] = value }
+
+func (h header) Get(key string) (*commonpb.Payload, bool) {
+	v, ok := h[key]
+	return v, ok
+}
+
+func (h header) ForEachKey(handler func(string, *commonpb.Payload) error) error {
+	for k, v := range h {
+		if err := handler(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestRequestPropagator(t *testing.T) {
+	p := NewRequestPropagator()
+	h := header{}
+
+	require.NoError(t, p.Inject(context.Background(), h))
+	assert.Empty(t, h)
+
+	ctx, err := p.Extract(context.Background(), h)
+	require.NoError(t, err)
+
+	_, ok := RequestMetadataFromContext(ctx)
+	assert.False(t, ok)
+
+	md := RequestMetadata{RequestID: "req-1", Tenant: "tenant-a"}
+	require.NoError(t, p.Inject(WithRequestMetadata(context.Background(), md), h))
+
+	ctx, err = p.Extract(context.Background(), h)
+	require.NoError(t, err)
+
+	got, ok := RequestMetadataFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, md, got)
+}
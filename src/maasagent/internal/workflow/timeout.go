@@ -0,0 +1,69 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package workflow
+
+import (
+	"errors"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+const (
+	// DefaultScheduleToStartTimeout is used for activities scheduled on a task
+	// queue served by another party (e.g. Region Controller), when no timeout
+	// was configured for the workflow type. It matches the 60s
+	// ScheduleToClose timeout of these activities, so by default they do not
+	// fail sooner than they did before ScheduleToStart was set.
+	DefaultScheduleToStartTimeout = 60 * time.Second
+
+	scheduleToStartTimeoutMetric = "activity_schedule_to_start_timeout"
+)
+
+// IsScheduleToStartTimeout returns true if err was caused by an activity that
+// was scheduled, but was not picked up by any worker in time.
+func IsScheduleToStartTimeout(err error) bool {
+	var timeoutErr *temporal.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		return false
+	}
+
+	return timeoutErr.TimeoutType() == enumspb.TIMEOUT_TYPE_SCHEDULE_TO_START
+}
+
+// ReportScheduleToStartTimeout emits a log and increments a metric if err is
+// a ScheduleToStart timeout, so it is possible to alert on task queues that
+// have no workers polling them. Other errors are ignored.
+func ReportScheduleToStartTimeout(ctx workflow.Context, activity, taskQueue string,
+	err error) {
+	if !IsScheduleToStartTimeout(err) {
+		return
+	}
+
+	workflow.GetMetricsHandler(ctx).WithTags(map[string]string{
+		"activity":   activity,
+		"task_queue": taskQueue,
+	}).Counter(scheduleToStartTimeoutMetric).Inc(1)
+
+	workflow.GetLogger(ctx).Error("Activity was not picked up by any worker",
+		tag.Builder().Error(err).
+			KV("activity", activity).
+			KV("task_queue", taskQueue).KeyVals...)
+}
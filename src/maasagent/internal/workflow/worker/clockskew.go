@@ -0,0 +1,77 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+const clockSkewMetric = "activity_clock_skew_detected"
+
+// clockSkewInterceptor is a worker interceptor that warns about activities
+// started while the local clock differs from the clock of Temporal server.
+// Activity deadlines are derived from server timestamps, so on hosts with a
+// drifting clock the time left for an activity is not what it seems locally.
+type clockSkewInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	threshold time.Duration
+	now       func() time.Time
+}
+
+func (i *clockSkewInterceptor) InterceptActivity(ctx context.Context,
+	next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	return &clockSkewActivityInboundInterceptor{
+		ActivityInboundInterceptorBase: interceptor.ActivityInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+type clockSkewActivityInboundInterceptor struct {
+	interceptor.ActivityInboundInterceptorBase
+	root *clockSkewInterceptor
+}
+
+func (i *clockSkewActivityInboundInterceptor) ExecuteActivity(ctx context.Context,
+	in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	info := activity.GetInfo(ctx)
+
+	// StartedTime is recorded by Temporal server right before the task was
+	// handed over to the worker, so the difference is mostly the clock skew.
+	skew := i.root.now().Sub(info.StartedTime)
+	if skew < 0 {
+		skew = -skew
+	}
+
+	if !info.StartedTime.IsZero() && skew > i.root.threshold {
+		activity.GetMetricsHandler(ctx).WithTags(map[string]string{
+			"activity_type": info.ActivityType.Name,
+		}).Counter(clockSkewMetric).Inc(1)
+
+		activity.GetLogger(ctx).Warn("Local clock differs from Temporal server clock",
+			tag.Builder().
+				KV("skew", skew).
+				KV("threshold", i.root.threshold).
+				KV("deadline", info.Deadline).KeyVals...)
+	}
+
+	return i.Next.ExecuteActivity(ctx, in)
+}
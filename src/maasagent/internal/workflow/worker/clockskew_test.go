@@ -0,0 +1,110 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+)
+
+// warnLogger records messages of warnings and ignores everything else
+type warnLogger struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *warnLogger) Debug(string, ...interface{}) {}
+func (l *warnLogger) Info(string, ...interface{})  {}
+func (l *warnLogger) Error(string, ...interface{}) {}
+
+func (l *warnLogger) Warn(msg string, _ ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.warnings = append(l.warnings, msg)
+}
+
+var _ log.Logger = (*warnLogger)(nil)
+
+func TestClockSkewInterceptor(t *testing.T) {
+	testcases := map[string]struct {
+		offset time.Duration
+		warn   bool
+	}{
+		"in sync": {
+			offset: 0,
+		},
+		"ahead": {
+			offset: time.Minute,
+			warn:   true,
+		},
+		"behind": {
+			offset: -time.Minute,
+			warn:   true,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			logger := &warnLogger{}
+
+			var suite testsuite.WorkflowTestSuite
+			suite.SetLogger(logger)
+
+			env := suite.NewTestActivityEnvironment()
+			env.SetWorkerOptions(worker.Options{
+				Interceptors: []interceptor.WorkerInterceptor{
+					&clockSkewInterceptor{
+						threshold: 10 * time.Second,
+						now:       func() time.Time { return time.Now().Add(tc.offset) },
+					},
+				},
+			})
+
+			env.RegisterActivityWithOptions(func(ctx context.Context) (string, error) {
+				return "done", nil
+			}, activity.RegisterOptions{Name: "test"})
+
+			res, err := env.ExecuteActivity("test")
+			require.NoError(t, err)
+
+			var result string
+			require.NoError(t, res.Get(&result))
+			assert.Equal(t, "done", result)
+
+			if tc.warn {
+				assert.Equal(t, []string{"Local clock differs from Temporal server clock"},
+					logger.warnings)
+			} else {
+				assert.Empty(t, logger.warnings)
+			}
+		})
+	}
+}
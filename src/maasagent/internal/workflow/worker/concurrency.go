@@ -0,0 +1,220 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+)
+
+// concurrencyInterceptor is a worker interceptor that limits number of
+// activities executed at the same time by all the workers sharing it,
+// independently of task slots of each worker. Activities wait for a slot
+// instead of failing.
+type concurrencyInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	sem *semaphore.Weighted
+}
+
+func newConcurrencyInterceptor(limit int64) *concurrencyInterceptor {
+	return &concurrencyInterceptor{sem: semaphore.NewWeighted(limit)}
+}
+
+func (i *concurrencyInterceptor) InterceptActivity(ctx context.Context,
+	next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	return &concurrencyActivityInboundInterceptor{
+		ActivityInboundInterceptorBase: interceptor.ActivityInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+type concurrencyActivityInboundInterceptor struct {
+	interceptor.ActivityInboundInterceptorBase
+	root *concurrencyInterceptor
+}
+
+func (i *concurrencyActivityInboundInterceptor) ExecuteActivity(ctx context.Context,
+	in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	if !i.root.sem.TryAcquire(1) {
+		activity.GetLogger(ctx).Debug("Waiting for activity concurrency limit")
+
+		if err := i.root.sem.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	defer i.root.sem.Release(1)
+
+	return i.Next.ExecuteActivity(ctx, in)
+}
+
+// pollHoldMargin is how long before its deadline a held poll returns without
+// a task, so the SDK polls again instead of reporting a timeout.
+const pollHoldMargin = time.Second
+
+// workflowCounter is a worker interceptor that counts workflows executed at
+// the same time by all the workers sharing it. Workflows are counted while
+// their execution runs on a worker, including the time they wait for
+// activities or timers and the ones replayed after cache eviction.
+type workflowCounter struct {
+	interceptor.WorkerInterceptorBase
+	inFlight atomic.Int64
+	mutex    sync.Mutex
+	// dropped is closed and replaced every time the count drops
+	dropped chan struct{}
+}
+
+func newWorkflowCounter() *workflowCounter {
+	return &workflowCounter{dropped: make(chan struct{})}
+}
+
+func (i *workflowCounter) InterceptWorkflow(ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	return &workflowCounterInboundInterceptor{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+// done decrements the count and wakes up everyone waiting for it to drop.
+func (i *workflowCounter) done() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.inFlight.Add(-1)
+	close(i.dropped)
+	i.dropped = make(chan struct{})
+}
+
+// below returns true if the count is below limit, and otherwise a channel
+// that is closed once the count drops.
+func (i *workflowCounter) below(limit int64) (bool, <-chan struct{}) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.inFlight.Load() < limit {
+		return true, nil
+	}
+
+	return false, i.dropped
+}
+
+type workflowCounterInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *workflowCounter
+}
+
+func (i *workflowCounterInboundInterceptor) ExecuteWorkflow(ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	i.root.inFlight.Add(1)
+	defer i.root.done()
+
+	return i.Next.ExecuteWorkflow(ctx, in)
+}
+
+// WorkflowLimiter stops workers of a pool polling new workflow tasks while
+// the limit of workflows counted by the pool are in flight, and lets them poll
+// again once the count drops below it. Work the agent cannot handle is left
+// in the task queue for other agents, instead of being accepted and timing
+// out. Tasks of workflows already in flight are polled from sticky task
+// queues, that are never held, so these workflows can complete and free
+// capacity. Polls that already reached Temporal can still return a new
+// workflow, so the limit is soft.
+//
+// It has to be installed with UnaryClientInterceptor on the client used by
+// the pool and passed to the pool with WithWorkflowLimiter.
+type WorkflowLimiter struct {
+	counter *workflowCounter
+	// taskQueues are names of task queues polled by workers of the pool
+	taskQueues sync.Map
+	limit      int64
+}
+
+// NewWorkflowLimiter returns WorkflowLimiter allowing up to limit workflows
+// in flight. Limit below 1 disables it, so workflows are only counted.
+func NewWorkflowLimiter(limit int64) *WorkflowLimiter {
+	return &WorkflowLimiter{counter: newWorkflowCounter(), limit: max(limit, 0)}
+}
+
+// UnaryClientInterceptor implements grpc.UnaryClientInterceptor. It holds
+// polls of task queues of the pool until fewer workflows than the limit are
+// in flight. A poll held until its deadline returns without a task.
+func (l *WorkflowLimiter) UnaryClientInterceptor(ctx context.Context, method string,
+	req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption) error {
+	if poll, ok := req.(*workflowservice.PollWorkflowTaskQueueRequest); ok && l.holds(poll) {
+		if ok, err := l.wait(ctx); !ok {
+			return err
+		}
+	}
+
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// holds returns true if poll should wait for capacity.
+func (l *WorkflowLimiter) holds(poll *workflowservice.PollWorkflowTaskQueueRequest) bool {
+	if l.limit == 0 || poll.GetTaskQueue().GetKind() == enumspb.TASK_QUEUE_KIND_STICKY {
+		return false
+	}
+
+	_, ok := l.taskQueues.Load(poll.GetTaskQueue().GetName())
+
+	return ok
+}
+
+// wait blocks until fewer workflows than the limit are in flight. It returns
+// false, if the poll has to return without a task, with ctx error if ctx
+// is done before its deadline.
+func (l *WorkflowLimiter) wait(ctx context.Context) (bool, error) {
+	var timeout <-chan time.Time
+
+	if deadline, ok := ctx.Deadline(); ok {
+		timer := time.NewTimer(time.Until(deadline) - pollHoldMargin)
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	for {
+		ok, dropped := l.counter.below(l.limit)
+		if ok {
+			return true, nil
+		}
+
+		select {
+		case <-dropped:
+		case <-timeout:
+			return false, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// addTaskQueue makes the limiter hold polls of taskQueue.
+func (l *WorkflowLimiter) addTaskQueue(taskQueue string) {
+	l.taskQueues.Store(taskQueue, struct{}{})
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	enumspb "go.temporal.io/api/enums/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+	"google.golang.org/grpc"
+)
+
+func TestConcurrencyInterceptor(t *testing.T) {
+	limiter := newConcurrencyInterceptor(2)
+
+	var running, maxRunning atomic.Int64
+
+	work := func(ctx context.Context) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		return nil
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var suite testsuite.WorkflowTestSuite
+
+			env := suite.NewTestActivityEnvironment()
+			env.SetWorkerOptions(worker.Options{
+				Interceptors: []interceptor.WorkerInterceptor{limiter},
+			})
+			env.RegisterActivity(work)
+
+			_, err := env.ExecuteActivity(work)
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int64(2), maxRunning.Load())
+}
+
+func TestWorkflowCounter(t *testing.T) {
+	counter := newWorkflowCounter()
+	counter.inFlight.Store(2)
+
+	var suite testsuite.WorkflowTestSuite
+
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{counter},
+	})
+
+	var observed int64
+
+	env.RegisterWorkflowWithOptions(func(ctx workflow.Context) error {
+		observed = counter.inFlight.Load()
+		return nil
+	}, workflow.RegisterOptions{Name: "test"})
+
+	env.ExecuteWorkflow("test")
+
+	require.True(t, env.IsWorkflowCompleted())
+	assert.NoError(t, env.GetWorkflowError())
+	assert.Equal(t, int64(3), observed)
+	assert.Equal(t, int64(2), counter.inFlight.Load())
+}
+
+func TestWorkflowLimiterHoldsPolls(t *testing.T) {
+	limiter := NewWorkflowLimiter(2)
+	limiter.addTaskQueue("power")
+	limiter.counter.inFlight.Store(2)
+
+	var polls atomic.Int64
+
+	invoker := func(context.Context, string, interface{}, interface{},
+		*grpc.ClientConn, ...grpc.CallOption) error {
+		polls.Add(1)
+		return nil
+	}
+
+	poll := func(ctx context.Context, kind enumspb.TaskQueueKind) error {
+		return limiter.UnaryClientInterceptor(ctx, "PollWorkflowTaskQueue",
+			&workflowservice.PollWorkflowTaskQueueRequest{
+				TaskQueue: &taskqueuepb.TaskQueue{Name: "power", Kind: kind},
+			}, &workflowservice.PollWorkflowTaskQueueResponse{}, nil, invoker)
+	}
+
+	// Sticky task queues deliver tasks of workflows already in flight
+	require.NoError(t, poll(context.Background(), enumspb.TASK_QUEUE_KIND_STICKY))
+	require.Equal(t, int64(1), polls.Load())
+
+	done := make(chan error)
+
+	go func() {
+		done <- poll(context.Background(), enumspb.TASK_QUEUE_KIND_NORMAL)
+	}()
+
+	// Polling stops at the limit
+	select {
+	case <-done:
+		t.Fatal("poll was not held at the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Equal(t, int64(1), polls.Load())
+
+	// and resumes once a workflow completes
+	limiter.counter.done()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("poll was not resumed below the limit")
+	}
+
+	assert.Equal(t, int64(2), polls.Load())
+}
+
+func TestWorkflowLimiterHeldPollDeadline(t *testing.T) {
+	testcases := map[string]struct {
+		timeout time.Duration
+		cancel  bool
+		err     error
+	}{
+		"deadline": {timeout: pollHoldMargin + 50*time.Millisecond},
+		"stopped":  {timeout: time.Minute, cancel: true, err: context.Canceled},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			limiter := NewWorkflowLimiter(1)
+			limiter.addTaskQueue("power")
+			limiter.counter.inFlight.Store(1)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+
+			if tc.cancel {
+				cancel()
+			}
+
+			err := limiter.UnaryClientInterceptor(ctx, "PollWorkflowTaskQueue",
+				&workflowservice.PollWorkflowTaskQueueRequest{
+					TaskQueue: &taskqueuepb.TaskQueue{Name: "power"},
+				}, &workflowservice.PollWorkflowTaskQueueResponse{}, nil,
+				func(context.Context, string, interface{}, interface{},
+					*grpc.ClientConn, ...grpc.CallOption) error {
+					t.Error("held poll was sent")
+					return nil
+				})
+
+			// Held until the deadline, the poll returns without a task
+			assert.Equal(t, tc.err, err)
+		})
+	}
+}
+
+func TestWorkflowLimiterCountsWorkflows(t *testing.T) {
+	limiter := NewWorkflowLimiter(1)
+
+	var suite testsuite.WorkflowTestSuite
+
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{limiter.counter},
+	})
+
+	var belowLimit bool
+
+	env.RegisterWorkflowWithOptions(func(ctx workflow.Context) error {
+		// The running workflow is counted towards the limit
+		belowLimit, _ = limiter.counter.below(limiter.limit)
+		return nil
+	}, workflow.RegisterOptions{Name: "test"})
+
+	env.ExecuteWorkflow("test")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	assert.False(t, belowLimit)
+
+	belowLimit, _ = limiter.counter.below(limiter.limit)
+	assert.True(t, belowLimit)
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+// debugDumpMaxValueSize is the maximum size of JSON encoded activity input
+// or result written to the run summary. Larger values are truncated.
+const debugDumpMaxValueSize = 4096
+
+var (
+	// debugDumpSensitiveKeyRegexp matches keys of values that are redacted
+	debugDumpSensitiveKeyRegexp = regexp.MustCompile(
+		`(?i)(secret|pass|token|credential|private_key|tls_key)`)
+	// debugDumpFileNameRegexp matches characters replaced in file names
+	debugDumpFileNameRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// runSummary is written as JSON when a workflow completes
+type runSummary struct {
+	Workflow   string            `json:"workflow"`
+	WorkflowID string            `json:"workflow_id"`
+	RunID      string            `json:"run_id"`
+	Started    time.Time         `json:"started"`
+	Finished   time.Time         `json:"finished"`
+	Activities []activitySummary `json:"activities"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// activitySummary describes an activity executed by the pool on behalf of
+// the workflow
+type activitySummary struct {
+	Activity string        `json:"activity"`
+	Attempt  int32         `json:"attempt"`
+	Duration time.Duration `json:"duration"`
+	Input    []interface{} `json:"input,omitempty"`
+	Result   interface{}   `json:"result,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// debugDumpInterceptor is a worker interceptor that writes a redacted run
+// summary of every workflow executed by the pool into a directory.
+// Only activities executed by the same pool are included in the summary.
+type debugDumpInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	runs  map[string][]activitySummary
+	dir   string
+	mutex sync.Mutex
+}
+
+func newDebugDumpInterceptor(dir string) *debugDumpInterceptor {
+	return &debugDumpInterceptor{
+		runs: make(map[string][]activitySummary),
+		dir:  dir,
+	}
+}
+
+func (i *debugDumpInterceptor) InterceptWorkflow(ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	return &debugDumpWorkflowInboundInterceptor{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+func (i *debugDumpInterceptor) InterceptActivity(ctx context.Context,
+	next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	return &debugDumpActivityInboundInterceptor{
+		ActivityInboundInterceptorBase: interceptor.ActivityInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+// begin starts collecting activities of the workflow run
+func (i *debugDumpInterceptor) begin(runID string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if _, ok := i.runs[runID]; !ok {
+		i.runs[runID] = []activitySummary{}
+	}
+}
+
+// record adds activity to the summary of the run. Activities of runs that
+// are not executed by the pool are ignored.
+func (i *debugDumpInterceptor) record(runID string, a activitySummary) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if activities, ok := i.runs[runID]; ok {
+		i.runs[runID] = append(activities, a)
+	}
+}
+
+// end stops collecting activities of the workflow run and returns the ones
+// collected so far.
+func (i *debugDumpInterceptor) end(runID string) []activitySummary {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	activities := i.runs[runID]
+	delete(i.runs, runID)
+
+	return activities
+}
+
+// write writes the summary into a file named after the workflow run
+func (i *debugDumpInterceptor) write(s runSummary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := debugDumpFileNameRegexp.ReplaceAllString(
+		fmt.Sprintf("%s-%s-%s.json", s.Workflow, s.WorkflowID, s.RunID), "_")
+
+	return os.WriteFile(filepath.Join(i.dir, name), data, 0600)
+}
+
+type debugDumpWorkflowInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *debugDumpInterceptor
+}
+
+func (i *debugDumpWorkflowInboundInterceptor) ExecuteWorkflow(ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	info := workflow.GetInfo(ctx)
+	runID := info.WorkflowExecution.RunID
+	started := workflow.Now(ctx)
+
+	i.root.begin(runID)
+	// Make sure activities are not kept if workflow is evicted from the cache
+	defer i.root.end(runID)
+
+	res, err := i.Next.ExecuteWorkflow(ctx, in)
+
+	activities := i.root.end(runID)
+
+	// Summary is written once, when the workflow completes for real.
+	if workflow.IsReplaying(ctx) {
+		return res, err
+	}
+
+	s := runSummary{
+		Workflow:   info.WorkflowType.Name,
+		WorkflowID: info.WorkflowExecution.ID,
+		RunID:      runID,
+		Started:    started,
+		Finished:   workflow.Now(ctx),
+		Activities: activities,
+	}
+
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	if dumpErr := i.root.write(s); dumpErr != nil {
+		workflow.GetLogger(ctx).Warn("Failed to write workflow debug dump",
+			tag.Builder().Error(dumpErr).KV("dir", i.root.dir).KeyVals...)
+	}
+
+	return res, err
+}
+
+type debugDumpActivityInboundInterceptor struct {
+	interceptor.ActivityInboundInterceptorBase
+	root *debugDumpInterceptor
+}
+
+func (i *debugDumpActivityInboundInterceptor) ExecuteActivity(ctx context.Context,
+	in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	start := time.Now()
+
+	res, err := i.Next.ExecuteActivity(ctx, in)
+
+	info := activity.GetInfo(ctx)
+
+	a := activitySummary{
+		Activity: info.ActivityType.Name,
+		Attempt:  info.Attempt,
+		Duration: time.Since(start),
+		Input:    make([]interface{}, len(in.Args)),
+		Result:   redactValue(res),
+	}
+
+	for n, arg := range in.Args {
+		a.Input[n] = redactValue(arg)
+	}
+
+	if err != nil {
+		a.Error = err.Error()
+	}
+
+	i.root.record(info.WorkflowExecution.RunID, a)
+
+	return res, err
+}
+
+// redactValue returns JSON compatible copy of v with values of sensitive
+// keys redacted. Values larger than debugDumpMaxValueSize are truncated.
+func redactValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<unserializable: %v>", err)
+	}
+
+	if len(data) > debugDumpMaxValueSize {
+		return fmt.Sprintf("<truncated: %d bytes>", len(data))
+	}
+
+	var res interface{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Sprintf("<unserializable: %v>", err)
+	}
+
+	return redact(res)
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if debugDumpSensitiveKeyRegexp.MatchString(k) && val != nil && val != "" {
+				v[k] = "<redacted>"
+				continue
+			}
+
+			v[k] = redact(val)
+		}
+	case []interface{}:
+		for n, val := range v {
+			v[n] = redact(val)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestDebugDumpInterceptor(t *testing.T) {
+	type param struct {
+		Address  string `json:"power_address"`
+		Password string `json:"power_pass"`
+		Blob     string `json:"blob"`
+	}
+
+	dir := t.TempDir()
+
+	var suite testsuite.WorkflowTestSuite
+
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{newDebugDumpInterceptor(dir)},
+	})
+
+	env.RegisterActivityWithOptions(func(ctx context.Context, p param) (string, error) {
+		return "on", nil
+	}, activity.RegisterOptions{Name: "power-on"})
+
+	env.RegisterWorkflowWithOptions(func(ctx workflow.Context) error {
+		ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			StartToCloseTimeout: time.Minute,
+		})
+
+		p := param{
+			Address:  "10.0.0.1",
+			Password: "hunter2",
+			Blob:     strings.Repeat("x", debugDumpMaxValueSize),
+		}
+
+		if err := workflow.ExecuteActivity(ctx, "power-on", p).Get(ctx, nil); err != nil {
+			return err
+		}
+
+		p.Blob = ""
+
+		if err := workflow.ExecuteActivity(ctx, "power-on", p).Get(ctx, nil); err != nil {
+			return err
+		}
+
+		return errors.New("boom")
+	}, workflow.RegisterOptions{Name: "test"})
+
+	env.ExecuteWorkflow("test")
+	require.True(t, env.IsWorkflowCompleted())
+
+	files, err := filepath.Glob(filepath.Join(dir, "test-*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	assert.NotContains(t, string(data), "hunter2")
+
+	var s runSummary
+	require.NoError(t, json.Unmarshal(data, &s))
+
+	assert.Equal(t, "test", s.Workflow)
+	assert.Contains(t, s.Error, "boom")
+	require.Len(t, s.Activities, 2)
+
+	assert.Equal(t, "power-on", s.Activities[0].Activity)
+	assert.Contains(t, s.Activities[0].Input[0], "<truncated")
+	assert.Equal(t, "on", s.Activities[0].Result)
+
+	assert.Equal(t, map[string]interface{}{
+		"power_address": "10.0.0.1",
+		"power_pass":    "<redacted>",
+		"blob":          "",
+	}, s.Activities[1].Input[0])
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"errors"
+	"time"
+
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	wf "maas.io/core/src/maasagent/internal/workflow"
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+const (
+	maxExecutionTimeExceededMetric = "workflow_max_execution_time_exceeded"
+	// maxExecutionTimeChangeID gates the limit with workflow.GetVersion, so
+	// workflows started by a version of the agent without it can be replayed
+	maxExecutionTimeChangeID = "max-execution-time"
+)
+
+var (
+	// ErrMaxExecutionTimeExceeded is an error for when a workflow was
+	// cancelled, because it was running longer than allowed for all workflows
+	// executed by the pool
+	ErrMaxExecutionTimeExceeded = errors.New("workflow exceeded maximum execution time")
+)
+
+// maxExecutionTimeInterceptor is a worker interceptor that cancels workflows
+// running longer than the limit, as a safety net against workflows that
+// never complete because of a bug and occupy task slots.
+//
+// The limit is enforced with a workflow timer, so it is part of the workflow
+// history. To keep workflows deterministic, the interceptor is installed
+// even if there is no limit, and the limit is recorded with a side effect
+// when the workflow starts. Changing the limit only applies to workflows
+// started afterwards.
+type maxExecutionTimeInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	limit time.Duration
+}
+
+func (i *maxExecutionTimeInterceptor) InterceptWorkflow(ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	return &maxExecutionTimeWorkflowInboundInterceptor{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+type maxExecutionTimeWorkflowInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *maxExecutionTimeInterceptor
+}
+
+func (i *maxExecutionTimeWorkflowInboundInterceptor) ExecuteWorkflow(ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	// Workflows started before the limit was introduced are not limited.
+	if workflow.GetVersion(ctx, maxExecutionTimeChangeID, workflow.DefaultVersion, 1) ==
+		workflow.DefaultVersion {
+		return i.Next.ExecuteWorkflow(ctx, in)
+	}
+
+	var limit time.Duration
+
+	err := workflow.SideEffect(ctx, func(workflow.Context) interface{} {
+		return i.root.limit
+	}).Get(&limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return i.Next.ExecuteWorkflow(ctx, in)
+	}
+
+	info := workflow.GetInfo(ctx)
+
+	// Time spent before this run (e.g. by a previous attempt) is not counted.
+	remaining := limit - workflow.Now(ctx).Sub(info.WorkflowStartTime)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	ctx, cancel := workflow.WithCancel(ctx)
+	timerCtx, cancelTimer := workflow.WithCancel(ctx)
+
+	defer cancelTimer()
+
+	var exceeded bool
+
+	workflow.Go(timerCtx, func(ctx workflow.Context) {
+		if err := workflow.NewTimer(ctx, remaining).Get(ctx, nil); err != nil {
+			return
+		}
+
+		exceeded = true
+
+		wf.Cancel(ctx, cancel, wf.CancellationReasonTimeout)
+	})
+
+	res, err := i.Next.ExecuteWorkflow(ctx, in)
+	if !exceeded {
+		return res, err
+	}
+
+	workflow.GetMetricsHandler(ctx).WithTags(map[string]string{
+		"workflow_type": info.WorkflowType.Name,
+	}).Counter(maxExecutionTimeExceededMetric).Inc(1)
+
+	workflow.GetLogger(ctx).Error("Workflow cancelled after exceeding maximum execution time",
+		tag.Builder().Error(err).KV("limit", limit).KeyVals...)
+
+	return nil, temporal.NewNonRetryableApplicationError(ErrMaxExecutionTimeExceeded.Error(),
+		"MaxExecutionTimeExceeded", errors.Join(ErrMaxExecutionTimeExceeded, err))
+}
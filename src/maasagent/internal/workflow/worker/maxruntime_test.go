@@ -0,0 +1,139 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+
+	wf "maas.io/core/src/maasagent/internal/workflow"
+)
+
+func TestMaxExecutionTimeInterceptor(t *testing.T) {
+	testcases := map[string]struct {
+		limit       time.Duration
+		sleep       time.Duration
+		unversioned bool
+		err         string
+	}{
+		"within limit": {
+			limit: time.Hour,
+			sleep: time.Minute,
+		},
+		"exceeded": {
+			limit: time.Hour,
+			sleep: 2 * time.Hour,
+			err:   ErrMaxExecutionTimeExceeded.Error(),
+		},
+		"no limit": {
+			sleep: 2 * time.Hour,
+		},
+		"started before the limit": {
+			limit:       time.Hour,
+			sleep:       2 * time.Hour,
+			unversioned: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var suite testsuite.WorkflowTestSuite
+
+			env := suite.NewTestWorkflowEnvironment()
+			env.SetWorkerOptions(worker.Options{
+				Interceptors: []interceptor.WorkerInterceptor{
+					&maxExecutionTimeInterceptor{limit: tc.limit},
+				},
+			})
+
+			env.RegisterWorkflowWithOptions(func(ctx workflow.Context) (string, error) {
+				if err := workflow.Sleep(ctx, tc.sleep); err != nil {
+					return "", err
+				}
+
+				return "done", nil
+			}, workflow.RegisterOptions{Name: "test"})
+
+			if tc.unversioned {
+				env.OnGetVersion(maxExecutionTimeChangeID, workflow.DefaultVersion, 1).
+					Return(workflow.DefaultVersion)
+			}
+
+			env.ExecuteWorkflow("test")
+			require.True(t, env.IsWorkflowCompleted())
+
+			if tc.err != "" {
+				assert.ErrorContains(t, env.GetWorkflowError(), tc.err)
+				return
+			}
+
+			require.NoError(t, env.GetWorkflowError())
+
+			var result string
+			require.NoError(t, env.GetWorkflowResult(&result))
+			assert.Equal(t, "done", result)
+		})
+	}
+}
+
+func TestMaxExecutionTimeInterceptorCancellationReason(t *testing.T) {
+	var suite testsuite.WorkflowTestSuite
+
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{
+			&maxExecutionTimeInterceptor{limit: time.Hour},
+		},
+	})
+
+	reasons := make(chan wf.CancellationReason, 1)
+
+	env.RegisterActivityWithOptions(func(ctx context.Context) error {
+		reasons <- wf.GetCancellationReason(ctx)
+		return nil
+	}, activity.RegisterOptions{Name: "reason"})
+
+	env.RegisterWorkflowWithOptions(func(ctx workflow.Context) error {
+		err := workflow.Sleep(ctx, 2*time.Hour)
+
+		// Activities of the cancelled workflow run get the reason.
+		ctx, _ = workflow.NewDisconnectedContext(ctx)
+		ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			StartToCloseTimeout: time.Minute,
+		})
+
+		return errors.Join(err, workflow.ExecuteActivity(ctx, "reason").Get(ctx, nil))
+	}, workflow.RegisterOptions{Name: "test"})
+
+	env.ExecuteWorkflow("test")
+	require.True(t, env.IsWorkflowCompleted())
+	assert.ErrorContains(t, env.GetWorkflowError(), ErrMaxExecutionTimeExceeded.Error())
+	assert.Equal(t, wf.CancellationReasonTimeout, <-reasons)
+}
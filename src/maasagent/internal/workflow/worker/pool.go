@@ -16,11 +16,20 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptor"
 	"go.temporal.io/sdk/worker"
 	"go.temporal.io/sdk/workflow"
 )
@@ -28,6 +37,9 @@ import (
 var (
 	// Override defaultWorkerConstructor using WithWorkerConstructor for tests.
 	defaultWorkerConstructor = worker.New
+
+	// ErrAlreadyStarted is returned by Start if the pool is already running
+	ErrAlreadyStarted = errors.New("worker pool is already started")
 )
 
 // Configurator is an interface that wraps configuration methods.
@@ -48,75 +60,273 @@ type workerConstructor func(client.Client, string, worker.Options) worker.Worker
 // WithConfigurator can be used to provide additional configuration workflows
 // that will be attached to the main worker.
 type WorkerPool struct {
-	fatal  chan error
+	fatal  chan fatalError
 	client client.Client
 	// worker for control plane
 	main              worker.Worker
 	workerConstructor workerConstructor
-	workers           map[string][]worker.Worker
+	workers           map[string][]*pooledWorker
+	registrations     map[string][]Registration
 	workflows         map[string]interface{}
 	activities        map[string]interface{}
+	stats             *statsInterceptor
+	sticky            *stickyInterceptor
+	limiter           *concurrencyInterceptor
+	workflowCounter   *workflowCounter
+	maxExecutionTime  *maxExecutionTimeInterceptor
+	interceptors      []interceptor.WorkerInterceptor
+	startFailures     metric.Int64Counter
 	systemID          string
 	taskQueue         string
-	mutex             sync.Mutex
+	taskQueuePrefix   string
+	stopTimeout       time.Duration
+	heartbeatInterval time.Duration
+	startConcurrency  int
+	partialStart      bool
+	separateWorkers   bool
+	// workflowLimiter is nil, if workflows in flight are not limited
+	workflowLimiter *WorkflowLimiter
+	// started is true if the main worker is running
+	started bool
+	// mainUsed is true if Start was called on the main worker, which cannot
+	// be started again after it failed to start or was stopped.
+	mainUsed bool
+	// generation is incremented every time workers are stopped, so fatal
+	// errors of workers that were stopped are not reported.
+	generation atomic.Uint64
+	mutex      sync.Mutex
+}
+
+// fatalError is a fatal error of a worker started in a generation of the pool
+type fatalError struct {
+	generation uint64
+	err        error
+}
+
+// StartReport describes the outcome of starting a group of workers.
+type StartReport struct {
+	// Started contains task queues of workers that were started.
+	Started []string
+	// Failed contains errors of workers that failed to start by task queue.
+	Failed map[string]error
+}
+
+// Registration describes workflows and activities executed by the pool on
+// a task queue.
+type Registration struct {
+	// Group is a group of workers, empty for the main worker
+	Group      string   `json:"group,omitempty"`
+	TaskQueue  string   `json:"task_queue"`
+	Workflows  []string `json:"workflows,omitempty"`
+	Activities []string `json:"activities,omitempty"`
+	// Paused is true if workers of the task queue were paused
+	Paused bool `json:"paused,omitempty"`
+}
+
+// pooledWorker is a worker of a group, with everything it was started with,
+// so it can be started again after it was paused.
+type pooledWorker struct {
+	worker.Worker
+	taskQueue  string
+	workflows  map[string]interface{}
+	activities map[string]interface{}
+	opts       worker.Options
+	paused     bool
 }
 
 // NewWorkerPool returns WorkerPool that has a main worker polling
-// Temporal Task Queue named after systemID@main
+// Temporal Task Queue named after systemID@main (with optional prefix)
 // Main worker will execute any configurator workflow provided
 func NewWorkerPool(systemID string, client client.Client,
 	options ...WorkerPoolOption) *WorkerPool {
 	pool := &WorkerPool{
+		fatal:             make(chan fatalError, 1),
 		systemID:          systemID,
 		taskQueue:         fmt.Sprintf("%s@main", systemID),
 		client:            client,
-		workers:           make(map[string][]worker.Worker),
+		workers:           make(map[string][]*pooledWorker),
+		registrations:     make(map[string][]Registration),
 		workflows:         make(map[string]interface{}),
 		activities:        make(map[string]interface{}),
+		stats:             &statsInterceptor{},
+		sticky:            newStickyInterceptor(),
+		workflowCounter:   newWorkflowCounter(),
+		maxExecutionTime:  &maxExecutionTimeInterceptor{},
 		workerConstructor: defaultWorkerConstructor,
 	}
 
+	WithMetricMeter(noop.NewMeterProvider().Meter("worker"))(pool)
+
 	for _, opt := range options {
 		opt(pool)
 	}
 
-	// main worker is responsible for configuring workers in the pool
-	pool.main = pool.workerConstructor(client, pool.taskQueue, worker.Options{
+	pool.interceptors = append([]interceptor.WorkerInterceptor{pool.stats, pool.sticky,
+		pool.maxExecutionTime}, pool.interceptors...)
+	pool.taskQueue = pool.taskQueuePrefix + pool.taskQueue
+
+	pool.main = pool.newMainWorker()
+
+	return pool
+}
+
+// newMainWorker returns main worker, that is responsible for configuring
+// workers in the pool, with configurator workflows and activities registered.
+func (p *WorkerPool) newMainWorker() worker.Worker {
+	main := p.workerConstructor(p.client, p.taskQueue, worker.Options{
 		DisableRegistrationAliasing:            true,
 		MaxConcurrentWorkflowTaskPollers:       2,
 		MaxConcurrentWorkflowTaskExecutionSize: 2,
+		WorkerStopTimeout:                      p.stopTimeout,
+		MaxHeartbeatThrottleInterval:           p.heartbeatInterval,
+		Interceptors:                           p.interceptors,
 		// Used to catch runtime errors from main
-		OnFatalError: func(err error) { pool.fatal <- err },
+		OnFatalError: p.onFatalError(),
 	})
 
-	for k, configurator := range pool.workflows {
-		pool.main.RegisterWorkflowWithOptions(
-			configurator,
+	// Names are sorted, so the order of registration is the same every time
+	for _, k := range sortedKeys(p.workflows) {
+		main.RegisterWorkflowWithOptions(
+			p.workflows[k],
 			workflow.RegisterOptions{
 				Name: k,
 			},
 		)
 	}
 
-	for k, configurator := range pool.activities {
-		pool.main.RegisterActivityWithOptions(
-			configurator,
+	for _, k := range sortedKeys(p.activities) {
+		main.RegisterActivityWithOptions(
+			p.activities[k],
 			activity.RegisterOptions{
 				Name: k,
 			},
 		)
 	}
 
-	return pool
+	return main
 }
 
-// Start starts the main worker process that controls worker pool
+// Start starts the main worker process that controls worker pool.
+// It is safe to call concurrently with Start, Stop and Restart, and returns
+// ErrAlreadyStarted if the pool is already running. Start can be retried
+// after a failure or called again after Stop.
 func (p *WorkerPool) Start() error {
-	return p.main.Start()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.start()
+}
+
+func (p *WorkerPool) start() error {
+	if p.started {
+		return ErrAlreadyStarted
+	}
+
+	if p.mainUsed {
+		p.main = p.newMainWorker()
+	}
+
+	p.mainUsed = true
+
+	if err := p.main.Start(); err != nil {
+		return err
+	}
+
+	p.started = true
+
+	return nil
 }
 
+// Error blocks until a worker of the pool fails with a fatal error and
+// returns it. Errors of workers stopped since they failed are skipped.
 func (p *WorkerPool) Error() error {
-	return <-p.fatal
+	for {
+		fatal := <-p.fatal
+		if fatal.generation == p.generation.Load() {
+			return fatal.err
+		}
+	}
+}
+
+// onFatalError returns worker.Options.OnFatalError for a worker started in
+// the current generation. It is called synchronously by the SDK, so it never
+// blocks: if an error of the same generation is already waiting to be
+// reported, the new one is dropped, as the pool is failing anyway.
+func (p *WorkerPool) onFatalError() func(error) {
+	generation := p.generation.Load()
+
+	return func(err error) {
+		if generation != p.generation.Load() {
+			return
+		}
+
+		fatal := fatalError{generation: generation, err: err}
+
+		select {
+		case p.fatal <- fatal:
+			return
+		default:
+		}
+
+		// The waiting error might be of workers that were stopped since.
+		select {
+		case waiting := <-p.fatal:
+			if waiting.generation == generation {
+				fatal = waiting
+			}
+		default:
+		}
+
+		select {
+		case p.fatal <- fatal:
+		default:
+		}
+	}
+}
+
+// Stop stops all the workers in the pool including the main worker.
+// Each worker waits up to the stop timeout for running activities to complete.
+// Stop of a pool that is not running only stops workers left in the pool.
+func (p *WorkerPool) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.stop()
+}
+
+func (p *WorkerPool) stop() {
+	p.generation.Add(1)
+
+	for group, workers := range p.workers {
+		stopWorkers(workers)
+
+		delete(p.workers, group)
+		delete(p.registrations, group)
+	}
+
+	if p.started {
+		p.main.Stop()
+		p.started = false
+	}
+}
+
+// Restart stops all the workers in the pool and starts a new main worker
+// with configurator workflows and activities registered again. It is meant
+// for workers that cannot recover, e.g. after Temporal namespace was
+// recreated. Work in progress is abandoned and workers added by configuration
+// workflows are not restored until these workflows are executed again.
+func (p *WorkerPool) Restart() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.stop()
+
+	return p.start()
+}
+
+// Stats returns counters of workflows and activities executed by the pool.
+func (p *WorkerPool) Stats() Stats {
+	return p.stats.stats()
 }
 
 // AddWorker adds new worker to the worker pool with registered workflows
@@ -124,34 +334,267 @@ func (p *WorkerPool) Error() error {
 // listening on the same task queue (because this is a valid case).
 // However that might be not desired in certain scenarios.
 // Named group can be used to track workers registered for specific use cases.
+// Prefix set with WithTaskQueuePrefix is prepended to taskQueue.
+// See WithSeparateActivityWorkers for running workflows and activities
+// of the task queue on different workers.
 // If there is a need to remove workers, usage of a group might be handy,
 // because RemoveWorkers method is doing removal of all workers inside the group.
 func (p *WorkerPool) AddWorker(group, taskQueue string,
 	workflows, activities map[string]interface{}, opts worker.Options) error {
+	workers, err := p.startWorkers(taskQueue, workflows, activities, opts)
+	if err != nil {
+		return err
+	}
+
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	opts.OnFatalError = func(err error) { p.fatal <- err }
+	p.workers[group] = append(p.workers[group], workers...)
+	p.register(group, taskQueue, workflows, activities)
+
+	return nil
+}
+
+// startWorkers starts workers for the task queue, that are not yet added to
+// the pool. It does not need the mutex, because it only uses fields set at
+// the pool construction, so workers of several task queues can be started
+// concurrently.
+func (p *WorkerPool) startWorkers(taskQueue string,
+	workflows, activities map[string]interface{}, opts worker.Options) ([]*pooledWorker, error) {
+	opts.OnFatalError = p.onFatalError()
 	opts.DisableRegistrationAliasing = true
+	interceptors := append([]interceptor.WorkerInterceptor{}, p.interceptors...)
+	interceptors = append(interceptors, p.workflowCounter)
+
+	if p.limiter != nil {
+		interceptors = append(interceptors, p.limiter)
+	}
+
+	opts.Interceptors = append(interceptors, opts.Interceptors...)
+
+	if opts.WorkerStopTimeout == 0 {
+		opts.WorkerStopTimeout = p.stopTimeout
+	}
+
+	if opts.MaxHeartbeatThrottleInterval == 0 {
+		opts.MaxHeartbeatThrottleInterval = p.heartbeatInterval
+	}
+
+	if !p.separateWorkers || len(workflows) == 0 || len(activities) == 0 {
+		w, err := p.startWorker(taskQueue, workflows, activities, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*pooledWorker{w}, nil
+	}
+
+	// Workflow worker still executes local activities, because they are
+	// part of the workflow task processing.
+	workflowOpts := opts
+	workflowOpts.LocalActivityWorkerOnly = true
+
+	workflowWorker, err := p.startWorker(taskQueue, workflows, nil, workflowOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	activityOpts := opts
+	activityOpts.DisableWorkflowWorker = true
+
+	activityWorker, err := p.startWorker(taskQueue, nil, activities, activityOpts)
+	if err != nil {
+		workflowWorker.Stop()
+		return nil, err
+	}
+
+	return []*pooledWorker{workflowWorker, activityWorker}, nil
+}
+
+func (p *WorkerPool) register(group, taskQueue string, workflows, activities map[string]interface{}) {
+	p.registrations[group] = append(p.registrations[group], Registration{
+		Group:      group,
+		TaskQueue:  p.taskQueuePrefix + taskQueue,
+		Workflows:  sortedKeys(workflows),
+		Activities: sortedKeys(activities),
+	})
+}
+
+// Registrations returns workflows and activities executed by the pool per
+// task queue, starting with the main worker, followed by workers of groups
+// sorted by group name.
+func (p *WorkerPool) Registrations() []Registration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	registrations := []Registration{{
+		TaskQueue:  p.taskQueue,
+		Workflows:  sortedKeys(p.workflows),
+		Activities: sortedKeys(p.activities),
+	}}
+
+	paused := p.pausedTaskQueues()
+
+	for _, group := range sortedKeys(p.registrations) {
+		for _, r := range p.registrations[group] {
+			r.Paused = slices.Contains(paused, r.TaskQueue)
+			registrations = append(registrations, r)
+		}
+	}
+
+	return registrations
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	if len(m) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
 
-	w := p.workerConstructor(p.client, taskQueue, opts)
+func (p *WorkerPool) startWorker(taskQueue string,
+	workflows, activities map[string]interface{}, opts worker.Options) (*pooledWorker, error) {
+	w := p.workerConstructor(p.client, p.taskQueuePrefix+taskQueue, opts)
 
-	for name, fn := range workflows {
-		w.RegisterWorkflowWithOptions(fn, workflow.RegisterOptions{Name: name})
+	if p.workflowLimiter != nil && len(workflows) > 0 {
+		p.workflowLimiter.addTaskQueue(p.taskQueuePrefix + taskQueue)
 	}
 
-	for name, fn := range activities {
-		w.RegisterActivityWithOptions(fn, activity.RegisterOptions{Name: name})
+	for _, name := range sortedKeys(workflows) {
+		w.RegisterWorkflowWithOptions(workflows[name], workflow.RegisterOptions{Name: name})
+	}
+
+	for _, name := range sortedKeys(activities) {
+		w.RegisterActivityWithOptions(activities[name], activity.RegisterOptions{Name: name})
 	}
 
 	if err := w.Start(); err != nil {
-		w = nil
-		return err
+		return nil, err
 	}
 
-	p.workers[group] = append(p.workers[group], w)
+	return &pooledWorker{
+		Worker:     w,
+		taskQueue:  taskQueue,
+		workflows:  workflows,
+		activities: activities,
+		opts:       opts,
+	}, nil
+}
 
-	return nil
+// stopWorkers stops workers that were not paused, paused ones are stopped.
+func stopWorkers(workers []*pooledWorker) {
+	for _, w := range workers {
+		if !w.paused {
+			w.Stop()
+		}
+	}
+}
+
+// AddWorkers adds a worker per task queue to the worker pool with registered
+// workflows and activities, and reports which workers started and which failed.
+// If any worker fails to start, all the workers of the group are removed,
+// unless the pool allows partial start, in which case healthy workers are kept
+// and an error is returned only if none of them started.
+// See WithStartConcurrency for starting several workers at the same time.
+func (p *WorkerPool) AddWorkers(group string, taskQueues []string,
+	workflows, activities map[string]interface{}, opts worker.Options) (StartReport, error) {
+	report := StartReport{Failed: make(map[string]error)}
+
+	results := p.startTaskQueues(taskQueues, workflows, activities, opts)
+
+	var errs []error
+
+	for i, taskQueue := range taskQueues {
+		res := results[i]
+
+		switch {
+		case res.err != nil:
+			p.startFailures.Add(context.Background(), 1,
+				metric.WithAttributes(attribute.String("group", group)))
+
+			report.Failed[taskQueue] = res.err
+			errs = append(errs, fmt.Errorf("failed starting worker for %q: %w", taskQueue, res.err))
+		case res.workers != nil:
+			p.mutex.Lock()
+			p.workers[group] = append(p.workers[group], res.workers...)
+			p.register(group, taskQueue, workflows, activities)
+			p.mutex.Unlock()
+
+			report.Started = append(report.Started, taskQueue)
+		}
+	}
+
+	if len(errs) > 0 && !p.partialStart {
+		p.RemoveWorkers(group)
+		report.Started = nil
+
+		return report, errors.Join(errs...)
+	}
+
+	if len(errs) > 0 && len(report.Started) == 0 {
+		return report, errors.Join(errs...)
+	}
+
+	return report, nil
+}
+
+// startResult is the outcome of starting workers of a task queue. Both
+// fields are nil, if the task queue was skipped after another one failed.
+type startResult struct {
+	workers []*pooledWorker
+	err     error
+}
+
+// startTaskQueues starts workers of task queues in order, up to the start
+// concurrency at the same time. Unless the pool allows partial start, task
+// queues that were not started yet are skipped once any of them failed.
+func (p *WorkerPool) startTaskQueues(taskQueues []string,
+	workflows, activities map[string]interface{}, opts worker.Options) []startResult {
+	results := make([]startResult, len(taskQueues))
+	jobs := make(chan int)
+
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Bool
+	)
+
+	for n := 0; n < min(max(p.startConcurrency, 1), len(taskQueues)); n++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				if failed.Load() && !p.partialStart {
+					continue
+				}
+
+				workers, err := p.startWorkers(taskQueues[i], workflows, activities, opts)
+				if err != nil {
+					failed.Store(true)
+				}
+
+				results[i] = startResult{workers: workers, err: err}
+			}
+		}()
+	}
+
+	for i := range taskQueues {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return results
 }
 
 // RemoveWorkers stops all the workers of a certain group and
@@ -162,12 +605,126 @@ func (p *WorkerPool) RemoveWorkers(group string) {
 
 	workers, ok := p.workers[group]
 	if ok {
+		stopWorkers(workers)
+
+		delete(p.workers, group)
+		delete(p.registrations, group)
+	}
+}
+
+// Pause stops workers polling taskQueue and executing workflowType, so the
+// agent stops taking new work from their task queues, while other workers
+// keep running. Empty taskQueue or workflowType matches any, so if both are
+// empty, workers of all the groups are paused. Every worker waits up to the
+// stop timeout for running activities to complete, while the pool remains
+// usable. The main worker is never paused, because it configures the pool.
+// It returns all the paused task queues.
+func (p *WorkerPool) Pause(taskQueue, workflowType string) []string {
+	var stopping []worker.Worker
+
+	p.mutex.Lock()
+
+	for _, w := range p.selectWorkers(taskQueue, workflowType) {
+		if !w.paused {
+			w.paused = true
+			stopping = append(stopping, w.Worker)
+		}
+	}
+
+	p.mutex.Unlock()
+
+	// Workers are already marked paused, so they are not stopped again
+	// by others and can be resumed, while they are being stopped.
+	for _, w := range stopping {
+		w.Stop()
+	}
+
+	return p.Paused()
+}
+
+// Resume starts again workers paused by Pause, that are selected in the same
+// way, and returns task queues that are still paused.
+func (p *WorkerPool) Resume(taskQueue, workflowType string) ([]string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var errs []error
+
+	for _, w := range p.selectWorkers(taskQueue, workflowType) {
+		if !w.paused {
+			continue
+		}
+
+		started, err := p.startWorker(w.taskQueue, w.workflows, w.activities, w.opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed resuming worker for %q: %w", w.taskQueue, err))
+			continue
+		}
+
+		*w = *started
+	}
+
+	return p.pausedTaskQueues(), errors.Join(errs...)
+}
+
+// Paused returns task queues of paused workers.
+func (p *WorkerPool) Paused() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.pausedTaskQueues()
+}
+
+// selectWorkers returns workers that poll taskQueue (with or without prefix)
+// and execute workflowType. Empty taskQueue or workflowType matches any.
+func (p *WorkerPool) selectWorkers(taskQueue, workflowType string) []*pooledWorker {
+	queues := make(map[string]bool)
+
+	for _, workers := range p.workers {
 		for _, w := range workers {
-			w.Stop()
+			if taskQueue != "" && w.taskQueue != taskQueue &&
+				p.taskQueuePrefix+w.taskQueue != taskQueue {
+				continue
+			}
+
+			if _, ok := w.workflows[workflowType]; workflowType != "" && !ok {
+				continue
+			}
+
+			queues[w.taskQueue] = true
 		}
+	}
 
-		delete(p.workers, group)
+	var selected []*pooledWorker
+
+	// Activity-only workers of the task queue are selected with the
+	// workflow worker, see WithSeparateActivityWorkers.
+	for _, group := range sortedKeys(p.workers) {
+		for _, w := range p.workers[group] {
+			if queues[w.taskQueue] {
+				selected = append(selected, w)
+			}
+		}
+	}
+
+	return selected
+}
+
+func (p *WorkerPool) pausedTaskQueues() []string {
+	var paused []string
+
+	for _, workers := range p.workers {
+		for _, w := range workers {
+			queue := p.taskQueuePrefix + w.taskQueue
+			if w.paused && !slices.Contains(paused, queue) {
+				paused = append(paused, queue)
+			}
+		}
 	}
+
+	slices.Sort(paused)
+
+	return paused
 }
 
 func (p *WorkerPool) RegisterActivityWithOptions(a interface{},
@@ -187,6 +744,187 @@ func WithMainWorkerTaskQueueSuffix(s string) WorkerPoolOption {
 	}
 }
 
+// WithTaskQueuePrefix sets prefix prepended to Task Queue names of all the
+// workers in the pool, including the main worker. It allows to share
+// Temporal cluster between environments without Task Queue collisions.
+// (default: "")
+func WithTaskQueuePrefix(prefix string) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.taskQueuePrefix = prefix
+	}
+}
+
+// WithStopTimeout sets time workers wait for running activities to complete
+// when the pool is stopped.
+// (default: 0)
+func WithStopTimeout(timeout time.Duration) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.stopTimeout = timeout
+	}
+}
+
+// WithMaxHeartbeatThrottleInterval sets the maximum interval between activity
+// heartbeats sent by workers of the pool, unless set in worker options.
+// (default: 0, Temporal SDK default)
+func WithMaxHeartbeatThrottleInterval(interval time.Duration) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.heartbeatInterval = interval
+	}
+}
+
+// WithMaxConcurrentActivities limits number of activities executed at the
+// same time by all the workers added to the pool, regardless of their task
+// slots. Activities over the limit wait until other activities complete.
+// Activities of the main worker are not limited. Limit below 1 disables it.
+// (default: no limit)
+func WithMaxConcurrentActivities(limit int64) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		if limit < 1 {
+			p.limiter = nil
+			return
+		}
+
+		p.limiter = newConcurrencyInterceptor(limit)
+	}
+}
+
+// WithWorkflowLimiter makes workers added to the pool stop polling new
+// workflow tasks while the limit of workflows executed by them is in flight,
+// see WorkflowLimiter. Workflows of the main worker are neither counted nor
+// limited. (default: no limit)
+func WithWorkflowLimiter(limiter *WorkflowLimiter) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		if limiter == nil {
+			return
+		}
+
+		p.workflowLimiter = limiter
+		p.workflowCounter = limiter.counter
+	}
+}
+
+// WithMaxWorkflowExecutionTime makes the pool cancel workflows running longer
+// than limit and fail them with ErrMaxExecutionTimeExceeded, regardless of
+// their own timeouts, that can only be shorter. Limit below or equal to zero
+// disables it. (default: no limit)
+//
+// The limit is recorded in the history of every workflow when it starts and
+// enforced with a workflow timer, so enabling, changing or disabling it does
+// not affect workflows already running. Workflows started after upgrading to
+// an agent that supports the limit cannot be replayed by an older agent, so
+// they should complete before a downgrade.
+func WithMaxWorkflowExecutionTime(limit time.Duration) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.maxExecutionTime.limit = max(limit, 0)
+	}
+}
+
+// WithClockSkewWarningThreshold makes the pool log a warning and increment
+// a metric for every activity started while the local clock differs from the
+// clock of Temporal server by more than threshold. Threshold below or equal to
+// zero disables it. (default: disabled)
+func WithClockSkewWarningThreshold(threshold time.Duration) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		if threshold <= 0 {
+			return
+		}
+
+		p.interceptors = append(p.interceptors, &clockSkewInterceptor{
+			threshold: threshold,
+			now:       time.Now,
+		})
+	}
+}
+
+// WithPartialStart allows AddWorkers to keep workers that have started,
+// when some other workers of the same group failed to start.
+// (default: false)
+func WithPartialStart(ok bool) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.partialStart = ok
+	}
+}
+
+// WithStartConcurrency makes AddWorkers start workers of up to n task queues
+// at the same time, so a large group does not take long to register with
+// Temporal. Values below 1 are treated as 1. (default: 1)
+func WithStartConcurrency(n int) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.startConcurrency = n
+	}
+}
+
+// WithSeparateActivityWorkers makes AddWorker start a workflow-only and an
+// activity-only worker on the same task queue, when both workflows and
+// activities are provided, so CPU-heavy activities don't delay workflow tasks.
+// (default: false)
+func WithSeparateActivityWorkers(ok bool) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.separateWorkers = ok
+	}
+}
+
+// WithSearchAttributes enables upsert of search attributes with the provided
+// keys on every workflow executed by the pool.
+// (default: disabled)
+func WithSearchAttributes(keys SearchAttributeKeys) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.interceptors = append(p.interceptors, &searchAttributesInterceptor{
+			keys:     keys,
+			systemID: p.systemID,
+		})
+	}
+}
+
+// WithDebugDump enables writing of a redacted run summary (activity inputs,
+// results and errors, and the final workflow error) of every workflow
+// executed by the pool into the dir.
+// (default: disabled)
+func WithDebugDump(dir string) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.interceptors = append(p.interceptors, newDebugDumpInterceptor(dir))
+	}
+}
+
+// WithResultWebhook makes the pool send a CloudEvent of type
+// <workflow type>.completed or <workflow type>.failed to the webhook url,
+// every time a workflow executed by the pool finishes. If secret is not
+// empty, events are signed with it, see ResultWebhookSignatureHeader.
+// Delivery is retried in background and never fails the workflow.
+func WithResultWebhook(url, secret string) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.interceptors = append(p.interceptors,
+			newResultWebhookInterceptor(url, secret, p.systemID))
+	}
+}
+
+// WithMetricMeter allows to set OpenTelemetry metric.Meter
+// to count workers that failed to start and workflows in flight.
+func WithMetricMeter(meter metric.Meter) WorkerPoolOption {
+	return func(p *WorkerPool) {
+		p.startFailures = must(meter.Int64Counter("worker.start.failures",
+			metric.WithDescription("Number of workers that failed to start"),
+			metric.WithUnit("{count}"),
+		))
+
+		must(meter.Int64ObservableGauge("worker.workflows.in_flight",
+			metric.WithDescription("Number of workflows executed by the workers added to the pool"),
+			metric.WithUnit("{count}"),
+			metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+				o.Observe(p.workflowCounter.inFlight.Load())
+				return nil
+			})))
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
 // WithWorkerConstructor sets constructor function used to construct
 // worker.Worker. Can be used to provide alternative constructor for tests
 // (default: "worker.New")
@@ -0,0 +1,754 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+// fakeWorker implements only the methods of worker.Worker used by WorkerPool
+type fakeWorker struct {
+	worker.Worker
+	startErr   error
+	opts       worker.Options
+	workflows  []string
+	activities []string
+	stopped    bool
+	// stopping blocks Stop until it is closed, if not nil
+	stopping chan struct{}
+}
+
+func (w *fakeWorker) Start() error { return w.startErr }
+
+func (w *fakeWorker) Stop() {
+	if w.stopping != nil {
+		<-w.stopping
+	}
+
+	w.stopped = true
+}
+
+func (w *fakeWorker) RegisterWorkflowWithOptions(_ interface{}, opts workflow.RegisterOptions) {
+	w.workflows = append(w.workflows, opts.Name)
+}
+
+func (w *fakeWorker) RegisterActivityWithOptions(_ interface{}, opts activity.RegisterOptions) {
+	w.activities = append(w.activities, opts.Name)
+}
+
+func TestAddWorkers(t *testing.T) {
+	errStart := errors.New("start failed")
+
+	testcases := map[string]struct {
+		partialStart bool
+		failing      map[string]bool
+		started      []string
+		failed       []string
+		running      int
+		stopped      int
+		err          bool
+	}{
+		"all started": {
+			started: []string{"a", "b", "c"},
+			running: 3,
+		},
+		"one failed": {
+			failing: map[string]bool{"b": true},
+			failed:  []string{"b"},
+			stopped: 1,
+			err:     true,
+		},
+		"one failed with partial start": {
+			partialStart: true,
+			failing:      map[string]bool{"b": true},
+			started:      []string{"a", "c"},
+			failed:       []string{"b"},
+			running:      2,
+		},
+		"all failed with partial start": {
+			partialStart: true,
+			failing:      map[string]bool{"a": true, "b": true, "c": true},
+			failed:       []string{"a", "b", "c"},
+			err:          true,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var workers []*fakeWorker
+
+			pool := NewWorkerPool("abcdef", nil,
+				WithPartialStart(tc.partialStart),
+				WithWorkerConstructor(func(_ client.Client, taskQueue string,
+					_ worker.Options) worker.Worker {
+					w := &fakeWorker{}
+					if tc.failing[taskQueue] {
+						w.startErr = errStart
+					}
+
+					workers = append(workers, w)
+
+					return w
+				}),
+			)
+
+			report, err := pool.AddWorkers("group", []string{"a", "b", "c"}, nil, nil,
+				worker.Options{})
+			if tc.err {
+				assert.ErrorIs(t, err, errStart)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.started, report.Started)
+
+			failed := make([]string, 0, len(report.Failed))
+			for taskQueue := range report.Failed {
+				failed = append(failed, taskQueue)
+			}
+
+			assert.ElementsMatch(t, tc.failed, failed)
+			assert.Len(t, pool.workers["group"], tc.running)
+
+			// Workers started before the failure must be stopped when removed.
+			stopped := 0
+			for _, w := range workers {
+				if w.stopped {
+					stopped++
+				}
+			}
+
+			assert.Equal(t, tc.stopped, stopped)
+		})
+	}
+}
+
+func TestAddWorkerSeparateActivityWorkers(t *testing.T) {
+	noop := func() error { return nil }
+
+	testcases := map[string]struct {
+		separate   bool
+		workflows  map[string]interface{}
+		activities map[string]interface{}
+		workers    []fakeWorker
+	}{
+		"shared worker": {
+			workflows:  map[string]interface{}{"wf": noop},
+			activities: map[string]interface{}{"act": noop},
+			workers: []fakeWorker{
+				{workflows: []string{"wf"}, activities: []string{"act"}},
+			},
+		},
+		"separate workers": {
+			separate:   true,
+			workflows:  map[string]interface{}{"wf": noop},
+			activities: map[string]interface{}{"act": noop},
+			workers: []fakeWorker{
+				{
+					workflows: []string{"wf"},
+					opts:      worker.Options{LocalActivityWorkerOnly: true},
+				},
+				{
+					activities: []string{"act"},
+					opts:       worker.Options{DisableWorkflowWorker: true},
+				},
+			},
+		},
+		"separate workers without workflows": {
+			separate:   true,
+			activities: map[string]interface{}{"act": noop},
+			workers: []fakeWorker{
+				{activities: []string{"act"}},
+			},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			pool := NewWorkerPool("abcdef", nil,
+				WithSeparateActivityWorkers(tc.separate),
+				WithWorkerConstructor(func(_ client.Client, _ string,
+					opts worker.Options) worker.Worker {
+					return &fakeWorker{opts: opts}
+				}),
+			)
+
+			err := pool.AddWorker("group", "queue", tc.workflows, tc.activities,
+				worker.Options{})
+			assert.NoError(t, err)
+
+			workers := pool.workers["group"]
+			assert.Len(t, workers, len(tc.workers))
+
+			for i, want := range tc.workers {
+				w := workers[i].Worker.(*fakeWorker)
+				assert.Equal(t, want.workflows, w.workflows)
+				assert.Equal(t, want.activities, w.activities)
+				assert.Equal(t, want.opts.LocalActivityWorkerOnly, w.opts.LocalActivityWorkerOnly)
+				assert.Equal(t, want.opts.DisableWorkflowWorker, w.opts.DisableWorkflowWorker)
+			}
+		})
+	}
+}
+
+func TestTaskQueuePrefix(t *testing.T) {
+	var taskQueues []string
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithMainWorkerTaskQueueSuffix("agent:main"),
+		WithTaskQueuePrefix("prod-"),
+		WithWorkerConstructor(func(_ client.Client, taskQueue string,
+			_ worker.Options) worker.Worker {
+			taskQueues = append(taskQueues, taskQueue)
+			return &fakeWorker{}
+		}),
+	)
+
+	assert.NoError(t, pool.AddWorker("group", "abcdef@agent:power", nil, nil,
+		worker.Options{}))
+
+	assert.Equal(t, []string{"prod-abcdef@agent:main", "prod-abcdef@agent:power"}, taskQueues)
+}
+
+func TestMaxHeartbeatThrottleInterval(t *testing.T) {
+	var intervals []time.Duration
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithMaxHeartbeatThrottleInterval(30*time.Second),
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			opts worker.Options) worker.Worker {
+			intervals = append(intervals, opts.MaxHeartbeatThrottleInterval)
+			return &fakeWorker{}
+		}),
+	)
+
+	assert.NoError(t, pool.AddWorker("group", "default", nil, nil, worker.Options{}))
+	assert.NoError(t, pool.AddWorker("group", "custom", nil, nil,
+		worker.Options{MaxHeartbeatThrottleInterval: time.Second}))
+
+	assert.Equal(t, []time.Duration{30 * time.Second, 30 * time.Second, time.Second}, intervals)
+}
+
+type fakeConfigurator struct{}
+
+func (fakeConfigurator) ConfigurationWorkflows() map[string]interface{} {
+	return map[string]interface{}{"configure": func() {}}
+}
+
+func (fakeConfigurator) ConfigurationActivities() map[string]interface{} {
+	return map[string]interface{}{"get-config": func() {}}
+}
+
+func TestRestart(t *testing.T) {
+	var workers []*fakeWorker
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithConfigurator(fakeConfigurator{}),
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			_ worker.Options) worker.Worker {
+			w := &fakeWorker{}
+			workers = append(workers, w)
+
+			return w
+		}),
+	)
+
+	assert.NoError(t, pool.Start())
+	assert.NoError(t, pool.AddWorker("group", "abcdef@agent:power", nil, nil,
+		worker.Options{}))
+	assert.NoError(t, pool.Restart())
+
+	// main, group worker and the new main
+	assert.Len(t, workers, 3)
+	assert.True(t, workers[0].stopped)
+	assert.True(t, workers[1].stopped)
+	assert.False(t, workers[2].stopped)
+	assert.Equal(t, []string{"configure"}, workers[2].workflows)
+	assert.Equal(t, []string{"get-config"}, workers[2].activities)
+	assert.Empty(t, pool.workers)
+}
+
+func TestStartRetry(t *testing.T) {
+	var workers []*fakeWorker
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			_ worker.Options) worker.Worker {
+			w := &fakeWorker{}
+			if len(workers) == 0 {
+				w.startErr = errors.New("start failed")
+			}
+
+			workers = append(workers, w)
+
+			return w
+		}),
+	)
+
+	assert.Error(t, pool.Start())
+	assert.NoError(t, pool.Start())
+	assert.ErrorIs(t, pool.Start(), ErrAlreadyStarted)
+
+	// A failed main worker cannot be started again, so it is replaced
+	assert.Len(t, workers, 2)
+
+	pool.Stop()
+	pool.Stop()
+
+	assert.True(t, workers[1].stopped)
+	assert.NoError(t, pool.Start())
+	assert.Len(t, workers, 3)
+}
+
+// countingWorker tracks the number of running main workers
+type countingWorker struct {
+	fakeWorker
+	running    *atomic.Int32
+	maxRunning *atomic.Int32
+	state      atomic.Int32
+}
+
+func (w *countingWorker) Start() error {
+	if !w.state.CompareAndSwap(0, 1) {
+		return errors.New("worker started twice")
+	}
+
+	n := w.running.Add(1)
+
+	for {
+		m := w.maxRunning.Load()
+		if n <= m || w.maxRunning.CompareAndSwap(m, n) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (w *countingWorker) Stop() {
+	if w.state.CompareAndSwap(1, 2) {
+		w.running.Add(-1)
+	}
+}
+
+func TestStartStopConcurrently(t *testing.T) {
+	var running, maxRunning atomic.Int32
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			_ worker.Options) worker.Worker {
+			return &countingWorker{running: &running, maxRunning: &maxRunning}
+		}),
+	)
+
+	var (
+		wg   sync.WaitGroup
+		errs atomic.Int32
+	)
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			var err error
+
+			switch i % 3 {
+			case 0:
+				err = pool.Start()
+			case 1:
+				pool.Stop()
+			case 2:
+				err = pool.Restart()
+			}
+
+			if err != nil && !errors.Is(err, ErrAlreadyStarted) {
+				errs.Add(1)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.Zero(t, errs.Load())
+	assert.Equal(t, int32(1), maxRunning.Load())
+
+	pool.Stop()
+	assert.Zero(t, running.Load())
+}
+
+func TestErrorAfterRestart(t *testing.T) {
+	var onFatalError []func(error)
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			opts worker.Options) worker.Worker {
+			onFatalError = append(onFatalError, opts.OnFatalError)
+			return &fakeWorker{}
+		}),
+	)
+
+	require.NoError(t, pool.Start())
+	require.NoError(t, pool.AddWorker("group", "default", nil, nil, worker.Options{}))
+
+	// Errors reported at once must not block workers, even if nobody reads
+	onFatalError[0](errors.New("main failed"))
+	onFatalError[1](errors.New("worker failed"))
+
+	require.NoError(t, pool.Restart())
+
+	// Errors of workers stopped by Restart are not reported
+	onFatalError[1](errors.New("worker failed again"))
+
+	require.Len(t, onFatalError, 3)
+	onFatalError[2](errors.New("new main failed"))
+
+	assert.EqualError(t, pool.Error(), "new main failed")
+
+	pool.Stop()
+}
+
+func TestMaxConcurrentActivities(t *testing.T) {
+	var interceptors [][]interceptor.WorkerInterceptor
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithMaxConcurrentActivities(2),
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			opts worker.Options) worker.Worker {
+			interceptors = append(interceptors, opts.Interceptors)
+			return &fakeWorker{}
+		}),
+	)
+
+	assert.NoError(t, pool.AddWorker("group", "default", nil, nil, worker.Options{}))
+
+	// Main worker is not limited
+	assert.NotContains(t, interceptors[0], pool.limiter)
+	assert.Contains(t, interceptors[1], pool.limiter)
+}
+
+func TestWorkflowLimiterTaskQueues(t *testing.T) {
+	limiter := NewWorkflowLimiter(1)
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithTaskQueuePrefix("prod-"),
+		WithWorkflowLimiter(limiter),
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			_ worker.Options) worker.Worker {
+			return &fakeWorker{}
+		}),
+	)
+
+	workflows := map[string]interface{}{"workflow": func() {}}
+
+	assert.NoError(t, pool.AddWorker("group", "power", workflows, nil, worker.Options{}))
+	assert.NoError(t, pool.AddWorker("group", "activities", nil, nil, worker.Options{}))
+
+	poll := func(taskQueue string) *workflowservice.PollWorkflowTaskQueueRequest {
+		return &workflowservice.PollWorkflowTaskQueueRequest{
+			TaskQueue: &taskqueuepb.TaskQueue{Name: taskQueue},
+		}
+	}
+
+	assert.True(t, limiter.holds(poll("prod-power")))
+	// Main worker and workers without workflows are not limited
+	assert.False(t, limiter.holds(poll("prod-abcdef@main")))
+	assert.False(t, limiter.holds(poll("prod-activities")))
+	assert.Same(t, limiter.counter, pool.workflowCounter)
+}
+
+func TestRegistrations(t *testing.T) {
+	pool := NewWorkerPool("abcdef", nil,
+		WithMainWorkerTaskQueueSuffix("agent:main"),
+		WithConfigurator(fakeConfigurator{}),
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			_ worker.Options) worker.Worker {
+			return &fakeWorker{}
+		}),
+	)
+
+	fn := func() {}
+
+	assert.NoError(t, pool.AddWorker("power", "abcdef@agent:power",
+		map[string]interface{}{"power-on-wf": fn},
+		map[string]interface{}{"power-on": fn, "power-off": fn}, worker.Options{}))
+	assert.NoError(t, pool.AddWorker("dhcp", "abcdef@agent:dhcp",
+		nil, map[string]interface{}{"apply-dhcp-config": fn}, worker.Options{}))
+
+	assert.Equal(t, []Registration{
+		{
+			TaskQueue:  "abcdef@agent:main",
+			Workflows:  []string{"configure"},
+			Activities: []string{"get-config"},
+		},
+		{
+			Group:      "dhcp",
+			TaskQueue:  "abcdef@agent:dhcp",
+			Activities: []string{"apply-dhcp-config"},
+		},
+		{
+			Group:      "power",
+			TaskQueue:  "abcdef@agent:power",
+			Workflows:  []string{"power-on-wf"},
+			Activities: []string{"power-off", "power-on"},
+		},
+	}, pool.Registrations())
+
+	pool.RemoveWorkers("power")
+	assert.Len(t, pool.Registrations(), 2)
+}
+
+func TestPauseResume(t *testing.T) {
+	testcases := map[string]struct {
+		taskQueue    string
+		workflowType string
+		paused       []string
+	}{
+		"task queue": {
+			taskQueue: "abcdef@agent:power",
+			paused:    []string{"abcdef@agent:power"},
+		},
+		"task queue with prefix": {
+			taskQueue: "prod-abcdef@agent:power",
+			paused:    []string{"abcdef@agent:power"},
+		},
+		"workflow type": {
+			workflowType: "deploy",
+			paused:       []string{"abcdef@agent:deploy"},
+		},
+		"task queue and workflow type": {
+			taskQueue:    "abcdef@agent:power",
+			workflowType: "deploy",
+		},
+		"all": {
+			paused: []string{"abcdef@agent:deploy", "abcdef@agent:power"},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var mutex sync.Mutex
+
+			workers := make(map[string][]*fakeWorker)
+
+			pool := NewWorkerPool("abcdef", nil,
+				WithTaskQueuePrefix("prod-"),
+				WithSeparateActivityWorkers(true),
+				WithWorkerConstructor(func(_ client.Client, taskQueue string,
+					_ worker.Options) worker.Worker {
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					w := &fakeWorker{}
+					workers[taskQueue] = append(workers[taskQueue], w)
+
+					return w
+				}),
+			)
+
+			fn := func() {}
+
+			assert.NoError(t, pool.AddWorker("power", "abcdef@agent:power",
+				map[string]interface{}{"power-on-wf": fn}, nil, worker.Options{}))
+			assert.NoError(t, pool.AddWorker("deploy", "abcdef@agent:deploy",
+				map[string]interface{}{"deploy": fn},
+				map[string]interface{}{"write-image": fn}, worker.Options{}))
+
+			var want []string
+			for _, queue := range tc.paused {
+				want = append(want, "prod-"+queue)
+			}
+
+			assert.Equal(t, want, pool.Pause(tc.taskQueue, tc.workflowType))
+			assert.Equal(t, want, pool.Paused())
+
+			for queue, started := range workers {
+				for _, w := range started {
+					assert.Equal(t, slices.Contains(want, queue), w.stopped, queue)
+				}
+			}
+
+			for _, r := range pool.Registrations()[1:] {
+				assert.Equal(t, slices.Contains(want, r.TaskQueue), r.Paused, r.TaskQueue)
+			}
+
+			paused, err := pool.Resume(tc.taskQueue, tc.workflowType)
+			assert.NoError(t, err)
+			assert.Empty(t, paused)
+			assert.Empty(t, pool.Paused())
+
+			for queue, started := range workers {
+				// Every paused worker is replaced by a new one
+				count := 1
+				if queue == "prod-abcdef@agent:deploy" {
+					count = 2
+				}
+
+				if slices.Contains(want, queue) {
+					count *= 2
+				}
+
+				assert.Len(t, started, count, queue)
+				assert.False(t, started[len(started)-1].stopped, queue)
+			}
+		})
+	}
+}
+
+func TestPauseDoesNotBlockPool(t *testing.T) {
+	stopping := make(chan struct{})
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			_ worker.Options) worker.Worker {
+			return &fakeWorker{stopping: stopping}
+		}),
+	)
+
+	assert.NoError(t, pool.AddWorker("power", "abcdef@agent:power",
+		map[string]interface{}{"power-on-wf": func() {}}, nil, worker.Options{}))
+
+	paused := make(chan []string)
+
+	go func() {
+		paused <- pool.Pause("", "")
+	}()
+
+	// The worker is reported paused while it is still stopping
+	assert.Eventually(t, func() bool {
+		return slices.Equal([]string{"abcdef@agent:power"}, pool.Paused())
+	}, time.Second, 10*time.Millisecond)
+
+	select {
+	case <-paused:
+		t.Fatal("Pause returned before the worker stopped")
+	default:
+	}
+
+	close(stopping)
+
+	assert.Equal(t, []string{"abcdef@agent:power"}, <-paused)
+}
+
+func TestRegistrationOrder(t *testing.T) {
+	var workers []*fakeWorker
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithConfigurator(fakeConfigurator{}),
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			_ worker.Options) worker.Worker {
+			w := &fakeWorker{}
+			workers = append(workers, w)
+
+			return w
+		}),
+	)
+
+	fn := func() {}
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	fns := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		fns[name] = fn
+	}
+
+	assert.NoError(t, pool.AddWorker("group", "queue", fns, fns, worker.Options{}))
+
+	require.Len(t, workers, 2)
+	assert.Equal(t, []string{"configure"}, workers[0].workflows)
+	assert.Equal(t, names, workers[1].workflows)
+	assert.Equal(t, names, workers[1].activities)
+}
+
+// slowWorker is a fakeWorker that takes a while to start, tracking the
+// number of workers starting at the same time.
+type slowWorker struct {
+	fakeWorker
+	starting    *atomic.Int32
+	maxStarting *atomic.Int32
+}
+
+func (w *slowWorker) Start() error {
+	n := w.starting.Add(1)
+	defer w.starting.Add(-1)
+
+	for {
+		m := w.maxStarting.Load()
+		if n <= m || w.maxStarting.CompareAndSwap(m, n) {
+			break
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	return w.startErr
+}
+
+func TestAddWorkersStartConcurrency(t *testing.T) {
+	var starting, maxStarting atomic.Int32
+
+	pool := NewWorkerPool("abcdef", nil,
+		WithStartConcurrency(2),
+		WithWorkerConstructor(func(_ client.Client, _ string,
+			_ worker.Options) worker.Worker {
+			return &slowWorker{starting: &starting, maxStarting: &maxStarting}
+		}),
+	)
+
+	taskQueues := []string{"a", "b", "c", "d", "e"}
+
+	report, err := pool.AddWorkers("group", taskQueues, nil, nil, worker.Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, taskQueues, report.Started)
+	assert.LessOrEqual(t, maxStarting.Load(), int32(2))
+	assert.Len(t, pool.workers["group"], len(taskQueues))
+
+	registered := make([]string, 0, len(taskQueues))
+	for _, r := range pool.Registrations()[1:] {
+		registered = append(registered, r.TaskQueue)
+	}
+
+	assert.Equal(t, taskQueues, registered)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	"maas.io/core/src/maasagent/internal/workflow/log/tag"
+)
+
+// SearchAttributeKeys contains names of Keyword search attributes upserted
+// on workflows executed by the pool, so they can be found in Temporal UI.
+// Search attributes must be registered on the Temporal cluster beforehand.
+// Empty name disables the corresponding attribute.
+type SearchAttributeKeys struct {
+	// SystemID is set to the system ID of the agent executing the workflow
+	SystemID string
+	// Action is set to the workflow type
+	Action string
+}
+
+// searchAttributesInterceptor is a worker interceptor that upserts search
+// attributes at the start of every workflow.
+type searchAttributesInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	keys     SearchAttributeKeys
+	systemID string
+}
+
+func (i *searchAttributesInterceptor) InterceptWorkflow(ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	return &searchAttributesWorkflowInboundInterceptor{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+type searchAttributesWorkflowInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *searchAttributesInterceptor
+}
+
+func (i *searchAttributesWorkflowInboundInterceptor) ExecuteWorkflow(ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	var updates []temporal.SearchAttributeUpdate
+
+	if key := i.root.keys.SystemID; key != "" {
+		updates = append(updates, temporal.NewSearchAttributeKeyKeyword(key).ValueSet(i.root.systemID))
+	}
+
+	if key := i.root.keys.Action; key != "" {
+		updates = append(updates,
+			temporal.NewSearchAttributeKeyKeyword(key).ValueSet(workflow.GetInfo(ctx).WorkflowType.Name))
+	}
+
+	if len(updates) > 0 {
+		// Search attributes are not essential for workflow execution,
+		// so failure to set them should not fail the workflow.
+		if err := workflow.UpsertTypedSearchAttributes(ctx, updates...); err != nil {
+			workflow.GetLogger(ctx).Warn("Failed to upsert search attributes",
+				tag.Builder().Error(err).KeyVals...)
+		}
+	}
+
+	return i.Next.ExecuteWorkflow(ctx, in)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestSearchAttributesInterceptor(t *testing.T) {
+	testcases := map[string]struct {
+		keys SearchAttributeKeys
+		out  map[string]string
+	}{
+		"all attributes": {
+			keys: SearchAttributeKeys{SystemID: "MAASSystemID", Action: "MAASAction"},
+			out:  map[string]string{"MAASSystemID": "abcdef", "MAASAction": "test"},
+		},
+		"system id only": {
+			keys: SearchAttributeKeys{SystemID: "MAASSystemID"},
+			out:  map[string]string{"MAASSystemID": "abcdef"},
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var suite testsuite.WorkflowTestSuite
+
+			env := suite.NewTestWorkflowEnvironment()
+			env.SetWorkerOptions(worker.Options{
+				Interceptors: []interceptor.WorkerInterceptor{
+					&searchAttributesInterceptor{keys: tc.keys, systemID: "abcdef"},
+				},
+			})
+
+			env.RegisterWorkflowWithOptions(func(ctx workflow.Context) (map[string]string, error) {
+				attrs := workflow.GetTypedSearchAttributes(ctx)
+				result := make(map[string]string)
+
+				for _, key := range []string{"MAASSystemID", "MAASAction"} {
+					if v, ok := attrs.GetKeyword(temporal.NewSearchAttributeKeyKeyword(key)); ok {
+						result[key] = v
+					}
+				}
+
+				return result, nil
+			}, workflow.RegisterOptions{Name: "test"})
+
+			env.ExecuteWorkflow("test")
+
+			require.True(t, env.IsWorkflowCompleted())
+			require.NoError(t, env.GetWorkflowError())
+
+			var result map[string]string
+			require.NoError(t, env.GetWorkflowResult(&result))
+			assert.Equal(t, tc.out, result)
+		})
+	}
+}
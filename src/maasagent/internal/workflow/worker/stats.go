@@ -0,0 +1,96 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Stats contains counters of workflows and activities executed by the
+// workers of the pool.
+type Stats struct {
+	Workflows  int64
+	Activities int64
+	// RunningActivities is a number of activities being executed right now
+	RunningActivities int64
+}
+
+// statsInterceptor is a worker interceptor that counts executed
+// workflows and activities.
+type statsInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	workflows  atomic.Int64
+	activities atomic.Int64
+	running    atomic.Int64
+}
+
+func (i *statsInterceptor) InterceptActivity(ctx context.Context,
+	next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	return &statsActivityInboundInterceptor{
+		ActivityInboundInterceptorBase: interceptor.ActivityInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+func (i *statsInterceptor) InterceptWorkflow(ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	return &statsWorkflowInboundInterceptor{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+func (i *statsInterceptor) stats() Stats {
+	return Stats{
+		Workflows:         i.workflows.Load(),
+		Activities:        i.activities.Load(),
+		RunningActivities: i.running.Load(),
+	}
+}
+
+type statsActivityInboundInterceptor struct {
+	interceptor.ActivityInboundInterceptorBase
+	root *statsInterceptor
+}
+
+func (i *statsActivityInboundInterceptor) ExecuteActivity(ctx context.Context,
+	in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	i.root.activities.Add(1)
+	i.root.running.Add(1)
+
+	defer i.root.running.Add(-1)
+
+	return i.Next.ExecuteActivity(ctx, in)
+}
+
+type statsWorkflowInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *statsInterceptor
+}
+
+func (i *statsWorkflowInboundInterceptor) ExecuteWorkflow(ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	// Workflow is executed again on every replay, we count only the first one.
+	if !workflow.IsReplaying(ctx) {
+		i.root.workflows.Add(1)
+	}
+
+	return i.Next.ExecuteWorkflow(ctx, in)
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+)
+
+// stickyExecution identifies a workflow execution cached by a worker
+type stickyExecution struct {
+	namespace  string
+	workflowID string
+	runID      string
+}
+
+// stickyInterceptor is a worker interceptor that tracks workflow executions
+// cached by the workers of the pool. Temporal routes workflow tasks of these
+// executions to sticky task queues of the workers that cached them.
+// Execution is removed once the workflow completes or is evicted from the
+// cache, because both end the workflow function.
+type stickyInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	cached map[stickyExecution]struct{}
+	mutex  sync.Mutex
+}
+
+func newStickyInterceptor() *stickyInterceptor {
+	return &stickyInterceptor{cached: make(map[stickyExecution]struct{})}
+}
+
+func (i *stickyInterceptor) InterceptWorkflow(ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	return &stickyWorkflowInboundInterceptor{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+// executions returns workflow executions that are cached right now
+func (i *stickyInterceptor) executions() []stickyExecution {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	res := make([]stickyExecution, 0, len(i.cached))
+	for e := range i.cached {
+		res = append(res, e)
+	}
+
+	return res
+}
+
+type stickyWorkflowInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *stickyInterceptor
+}
+
+func (i *stickyWorkflowInboundInterceptor) ExecuteWorkflow(ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	info := workflow.GetInfo(ctx)
+	e := stickyExecution{
+		namespace:  info.Namespace,
+		workflowID: info.WorkflowExecution.ID,
+		runID:      info.WorkflowExecution.RunID,
+	}
+
+	i.root.mutex.Lock()
+	i.root.cached[e] = struct{}{}
+	i.root.mutex.Unlock()
+
+	defer func() {
+		i.root.mutex.Lock()
+		delete(i.root.cached, e)
+		i.root.mutex.Unlock()
+	}()
+
+	return i.Next.ExecuteWorkflow(ctx, in)
+}
+
+// ResetStickyTaskQueues asks Temporal to stop routing workflow tasks of the
+// workflows cached by the pool to sticky task queues of its workers, so
+// other workers pick them up right away, instead of after the sticky
+// ScheduleToStart timeout. It is meant to be called once the pool was
+// stopped, before the client is closed.
+func (p *WorkerPool) ResetStickyTaskQueues(ctx context.Context) error {
+	var errs []error
+
+	for _, e := range p.sticky.executions() {
+		_, err := p.client.WorkflowService().ResetStickyTaskQueue(ctx,
+			&workflowservice.ResetStickyTaskQueueRequest{
+				Namespace: e.namespace,
+				Execution: &commonpb.WorkflowExecution{
+					WorkflowId: e.workflowID,
+					RunId:      e.runID,
+				},
+			})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed resetting sticky task queue of %q: %w",
+				e.workflowID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+	"google.golang.org/grpc"
+)
+
+func TestStickyInterceptor(t *testing.T) {
+	sticky := newStickyInterceptor()
+
+	var suite testsuite.WorkflowTestSuite
+
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{sticky},
+	})
+
+	env.RegisterWorkflowWithOptions(func(ctx workflow.Context) error {
+		executions := sticky.executions()
+		if assert.Len(t, executions, 1) {
+			assert.Equal(t, workflow.GetInfo(ctx).WorkflowExecution.ID, executions[0].workflowID)
+		}
+
+		return nil
+	}, workflow.RegisterOptions{Name: "test"})
+
+	env.ExecuteWorkflow("test")
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	assert.Empty(t, sticky.executions())
+}
+
+type fakeWorkflowService struct {
+	workflowservice.WorkflowServiceClient
+	reset []*workflowservice.ResetStickyTaskQueueRequest
+	err   error
+}
+
+func (s *fakeWorkflowService) ResetStickyTaskQueue(_ context.Context,
+	in *workflowservice.ResetStickyTaskQueueRequest,
+	_ ...grpc.CallOption) (*workflowservice.ResetStickyTaskQueueResponse, error) {
+	s.reset = append(s.reset, in)
+	return &workflowservice.ResetStickyTaskQueueResponse{}, s.err
+}
+
+func TestResetStickyTaskQueues(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+
+	testcases := map[string]struct {
+		err error
+	}{
+		"success": {},
+		"failure": {err: errUnavailable},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			svc := &fakeWorkflowService{err: tc.err}
+
+			c := &mocks.Client{}
+			c.On("WorkflowService").Return(svc)
+
+			pool := NewWorkerPool("abcdef", c, WithWorkerConstructor(
+				func(client.Client, string, worker.Options) worker.Worker {
+					return &fakeWorker{}
+				}))
+
+			pool.sticky.cached[stickyExecution{
+				namespace: "default", workflowID: "power-on", runID: "run",
+			}] = struct{}{}
+
+			err := pool.ResetStickyTaskQueues(context.Background())
+			assert.ErrorIs(t, err, tc.err)
+
+			require.Len(t, svc.reset, 1)
+			assert.Equal(t, "default", svc.reset[0].Namespace)
+			assert.Equal(t, "power-on", svc.reset[0].Execution.WorkflowId)
+			assert.Equal(t, "run", svc.reset[0].Execution.RunId)
+		})
+	}
+}
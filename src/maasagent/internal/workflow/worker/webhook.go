@@ -0,0 +1,204 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/rs/zerolog/log"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// resultWebhookQueueSize is a number of events waiting for delivery,
+	// after which new events are dropped
+	resultWebhookQueueSize = 100
+	// resultWebhookMaxElapsedTime is for how long delivery of an event is
+	// retried
+	resultWebhookMaxElapsedTime = time.Minute
+	// ResultWebhookSignatureHeader holds hex encoded HMAC-SHA256 of the
+	// request body, if the webhook secret is set
+	ResultWebhookSignatureHeader = "X-MAAS-Signature"
+)
+
+// cloudEvent is a CloudEvents 1.0 event in the structured JSON format
+type cloudEvent struct {
+	SpecVersion     string             `json:"specversion"`
+	ID              string             `json:"id"`
+	Source          string             `json:"source"`
+	Type            string             `json:"type"`
+	Subject         string             `json:"subject"`
+	Time            time.Time          `json:"time"`
+	DataContentType string             `json:"datacontenttype"`
+	Data            workflowResultData `json:"data"`
+}
+
+// workflowResultData is data of the event sent when a workflow completes
+type workflowResultData struct {
+	WorkflowType string `json:"workflow_type"`
+	WorkflowID   string `json:"workflow_id"`
+	RunID        string `json:"run_id"`
+	Error        string `json:"error,omitempty"`
+}
+
+// resultWebhookInterceptor is a worker interceptor that sends a CloudEvent
+// to a webhook every time a workflow executed by the pool completes or fails.
+// Events are delivered in background, so delivery failures, that are logged,
+// never affect workflows.
+type resultWebhookInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	client *http.Client
+	events chan cloudEvent
+	url    string
+	secret []byte
+	source string
+}
+
+func newResultWebhookInterceptor(url, secret, systemID string) *resultWebhookInterceptor {
+	i := &resultWebhookInterceptor{
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan cloudEvent, resultWebhookQueueSize),
+		url:    url,
+		secret: []byte(secret),
+		source: fmt.Sprintf("/maas/agent/%s", systemID),
+	}
+
+	go i.run()
+
+	return i
+}
+
+func (i *resultWebhookInterceptor) InterceptWorkflow(ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	return &resultWebhookWorkflowInboundInterceptor{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+// enqueue queues event for delivery, dropping it if the queue is full
+func (i *resultWebhookInterceptor) enqueue(e cloudEvent) {
+	select {
+	case i.events <- e:
+	default:
+		log.Warn().Str("type", e.Type).Str("workflow_id", e.Subject).
+			Msg("Result webhook queue is full, dropping event")
+	}
+}
+
+// run delivers queued events for the lifetime of the process
+func (i *resultWebhookInterceptor) run() {
+	for e := range i.events {
+		retry := backoff.NewExponentialBackOff()
+		retry.MaxElapsedTime = resultWebhookMaxElapsedTime
+
+		if err := backoff.Retry(func() error { return i.send(e) }, retry); err != nil {
+			log.Warn().Err(err).Str("type", e.Type).Str("workflow_id", e.Subject).
+				Msg("Failed to deliver event to result webhook")
+		}
+	}
+}
+
+// send posts event to the webhook. Client errors, except for rate limiting,
+// are not retried.
+func (i *resultWebhookInterceptor) send(e cloudEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+		i.url, bytes.NewReader(body))
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+
+	if len(i.secret) > 0 {
+		mac := hmac.New(sha256.New, i.secret)
+		mac.Write(body)
+		req.Header.Set(ResultWebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	//nolint:errcheck // response body is not used
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return backoff.Permanent(fmt.Errorf("webhook responded with %s", resp.Status))
+	default:
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+}
+
+type resultWebhookWorkflowInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *resultWebhookInterceptor
+}
+
+func (i *resultWebhookWorkflowInboundInterceptor) ExecuteWorkflow(ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	res, err := i.Next.ExecuteWorkflow(ctx, in)
+
+	// Event is sent once, when the workflow completes for real.
+	if workflow.IsReplaying(ctx) {
+		return res, err
+	}
+
+	info := workflow.GetInfo(ctx)
+
+	e := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              info.WorkflowExecution.RunID,
+		Source:          i.root.source,
+		Type:            info.WorkflowType.Name + ".completed",
+		Subject:         info.WorkflowExecution.ID,
+		Time:            workflow.Now(ctx).UTC(),
+		DataContentType: "application/json",
+		Data: workflowResultData{
+			WorkflowType: info.WorkflowType.Name,
+			WorkflowID:   info.WorkflowExecution.ID,
+			RunID:        info.WorkflowExecution.RunID,
+		},
+	}
+
+	if err != nil {
+		e.Type = info.WorkflowType.Name + ".failed"
+		e.Data.Error = err.Error()
+	}
+
+	i.root.enqueue(e)
+
+	return res, err
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestResultWebhookInterceptor(t *testing.T) {
+	testcases := map[string]struct {
+		err       error
+		status    []int
+		eventType string
+		errMsg    string
+	}{
+		"completed": {
+			status:    []int{http.StatusOK},
+			eventType: "test.completed",
+		},
+		"failed": {
+			err:       errors.New("boom"),
+			status:    []int{http.StatusAccepted},
+			eventType: "test.failed",
+			errMsg:    "boom",
+		},
+		"retried": {
+			status:    []int{http.StatusServiceUnavailable, http.StatusOK},
+			eventType: "test.completed",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			type request struct {
+				header http.Header
+				body   []byte
+			}
+
+			requests := make(chan request, len(tc.status))
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+
+				status := tc.status[len(requests)]
+				requests <- request{header: r.Header, body: body}
+
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+
+			var suite testsuite.WorkflowTestSuite
+
+			env := suite.NewTestWorkflowEnvironment()
+			env.SetWorkerOptions(worker.Options{
+				Interceptors: []interceptor.WorkerInterceptor{
+					newResultWebhookInterceptor(srv.URL, "s3cr3t", "abcdef"),
+				},
+			})
+
+			env.RegisterWorkflowWithOptions(func(ctx workflow.Context) error {
+				return tc.err
+			}, workflow.RegisterOptions{Name: "test"})
+
+			env.ExecuteWorkflow("test")
+			require.True(t, env.IsWorkflowCompleted())
+
+			var req request
+
+			for range tc.status {
+				select {
+				case req = <-requests:
+				case <-time.After(10 * time.Second):
+					t.Fatal("event was not delivered")
+				}
+			}
+
+			assert.Equal(t, "application/cloudevents+json", req.header.Get("Content-Type"))
+
+			mac := hmac.New(sha256.New, []byte("s3cr3t"))
+			mac.Write(req.body)
+			assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)),
+				req.header.Get(ResultWebhookSignatureHeader))
+
+			var e cloudEvent
+			require.NoError(t, json.Unmarshal(req.body, &e))
+
+			assert.Equal(t, "1.0", e.SpecVersion)
+			assert.Equal(t, "/maas/agent/abcdef", e.Source)
+			assert.Equal(t, tc.eventType, e.Type)
+			assert.Equal(t, "test", e.Data.WorkflowType)
+			assert.Equal(t, e.Subject, e.Data.WorkflowID)
+			assert.Contains(t, e.Data.Error, tc.errMsg)
+		})
+	}
+}
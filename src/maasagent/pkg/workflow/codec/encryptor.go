@@ -20,12 +20,20 @@
 package codec
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"errors"
+	"fmt"
 	"io"
+	"time"
 
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	commonpb "go.temporal.io/api/common/v1"
 
 	"go.temporal.io/sdk/converter"
@@ -33,14 +41,45 @@ import (
 
 const (
 	MetadataEncodingEncrypted = "binary/encrypted"
+	// DefaultMaxPayloadSize is slightly under the 2MB payload size limit
+	// enforced by Temporal Server.
+	DefaultMaxPayloadSize = 2*1024*1024 - 64*1024
+	// DefaultDecodeRetryBackoff is a delay before every decode retry.
+	DefaultDecodeRetryBackoff = 100 * time.Millisecond
+)
+
+// Kinds of codec failures reported with the "kind" metric attribute
+const (
+	failureTooLarge      = "payload_too_large"
+	failureMalformed     = "malformed"
+	failureAuthFailed    = "authentication_failed"
+	failureRandom        = "random"
+	failureUnknownTenant = "unknown_tenant"
+)
+
+var (
+	// ErrPayloadTooLarge is returned when plaintext payload exceeds the limit
+	ErrPayloadTooLarge = errors.New("payload is too large")
+
+	// failureLogSampler limits logs of codec failures, because a wrong
+	// secret makes every single payload fail.
+	failureLogSampler = &zerolog.BurstSampler{Burst: 5, Period: time.Minute}
 )
 
 // EncryptionCodec implements PayloadCodec using AES Crypt.
 type EncryptionCodec struct {
-	cipher cipher.AEAD
+	cipher             cipher.AEAD
+	failures           metric.Int64Counter
+	decodeRetries      metric.Int64Counter
+	maxPayloadSize     int
+	maxDecodeRetries   int
+	decodeRetryBackoff time.Duration
 }
 
-func NewEncryptionCodec(key []byte) (*EncryptionCodec, error) {
+// EncryptionCodecOption allows to set additional EncryptionCodec options
+type EncryptionCodecOption func(*EncryptionCodec)
+
+func NewEncryptionCodec(key []byte, options ...EncryptionCodecOption) (*EncryptionCodec, error) {
 	c, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -51,7 +90,83 @@ func NewEncryptionCodec(key []byte) (*EncryptionCodec, error) {
 		return nil, err
 	}
 
-	return &EncryptionCodec{cipher: gcm}, err
+	codec := &EncryptionCodec{
+		cipher:             gcm,
+		maxPayloadSize:     DefaultMaxPayloadSize,
+		decodeRetryBackoff: DefaultDecodeRetryBackoff,
+	}
+
+	WithMetricMeter(noop.NewMeterProvider().Meter("codec"))(codec)
+
+	for _, opt := range options {
+		opt(codec)
+	}
+
+	return codec, err
+}
+
+// WithMaxPayloadSize sets maximum size of a plaintext payload in bytes.
+// Zero or negative value disables the check.
+// (default: DefaultMaxPayloadSize)
+func WithMaxPayloadSize(size int) EncryptionCodecOption {
+	return func(c *EncryptionCodec) {
+		c.maxPayloadSize = size
+	}
+}
+
+// WithDecodeRetries sets how many times TenantEncryptionCodec retries to
+// decode a payload that could not be decrypted, trying secrets of all the
+// configured MAAS installations, after waiting for backoff. This covers
+// payloads labelled with a key ID not yet known during a key rotation.
+// It has no effect on EncryptionCodec, because it has a single secret.
+// Zero backoff keeps the current value.
+// (default: 0, DefaultDecodeRetryBackoff)
+func WithDecodeRetries(retries int, backoff time.Duration) EncryptionCodecOption {
+	return func(c *EncryptionCodec) {
+		c.maxDecodeRetries = retries
+		if backoff > 0 {
+			c.decodeRetryBackoff = backoff
+		}
+	}
+}
+
+// WithMetricMeter allows to set OpenTelemetry metric.Meter
+// to count encode and decode failures, and decode retries.
+func WithMetricMeter(meter metric.Meter) EncryptionCodecOption {
+	return func(c *EncryptionCodec) {
+		c.failures = must(meter.Int64Counter("codec.failures",
+			metric.WithDescription("Number of payloads that failed to encode or decode"),
+			metric.WithUnit("{count}"),
+		))
+		c.decodeRetries = must(meter.Int64Counter("codec.decode_retries",
+			metric.WithDescription("Number of retries to decode a payload"),
+			metric.WithUnit("{count}"),
+		))
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+// fail records failure of the operation (encode or decode) and returns err
+func (c *EncryptionCodec) fail(operation, kind string, err error) error {
+	c.failures.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.String("kind", kind),
+	))
+
+	l := log.Logger.Sample(failureLogSampler)
+	l.Warn().Err(err).
+		Str("operation", operation).
+		Str("kind", kind).
+		Msg("Payload codec failure")
+
+	return err
 }
 
 // Encode implements converter.PayloadCodec.Encode.
@@ -61,12 +176,18 @@ func (c *EncryptionCodec) Encode(payloads []*commonpb.Payload) ([]*commonpb.Payl
 	for i, p := range payloads {
 		origBytes, err := p.Marshal()
 		if err != nil {
-			return payloads, err
+			return payloads, c.fail("encode", failureMalformed, err)
+		}
+
+		if c.maxPayloadSize > 0 && len(origBytes) > c.maxPayloadSize {
+			return payloads, c.fail("encode", failureTooLarge,
+				fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes",
+					ErrPayloadTooLarge, len(origBytes), c.maxPayloadSize))
 		}
 
 		nonce := make([]byte, c.cipher.NonceSize())
 		if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-			return nil, err
+			return nil, c.fail("encode", failureRandom, err)
 		}
 
 		b, err := c.cipher.Seal(nonce, nonce, origBytes, nil), nil
@@ -87,31 +208,43 @@ func (c *EncryptionCodec) Decode(payloads []*commonpb.Payload) ([]*commonpb.Payl
 	result := make([]*commonpb.Payload, len(payloads))
 
 	for i, p := range payloads {
-		// Only if it's encrypted
-		if string(p.Metadata[converter.MetadataEncoding]) != MetadataEncodingEncrypted {
-			result[i] = p
-			continue
+		decoded, kind, err := c.decode(p)
+		if err != nil {
+			return payloads, c.fail("decode", kind, err)
 		}
 
-		nonceSize := c.cipher.NonceSize()
-		if len(p.Data) < nonceSize {
-			return nil, errors.New("data length is less than nonce size")
-		}
+		result[i] = decoded
+	}
 
-		nonce, data := p.Data[:nonceSize], p.Data[nonceSize:]
+	return result, nil
+}
 
-		b, err := c.cipher.Open(nil, nonce, data, nil)
-		if err != nil {
-			return payloads, err
-		}
+// decode decodes a single payload. If decoding fails, it returns the kind of
+// failure, without recording it.
+func (c *EncryptionCodec) decode(p *commonpb.Payload) (*commonpb.Payload, string, error) {
+	// Only if it's encrypted
+	if string(p.Metadata[converter.MetadataEncoding]) != MetadataEncodingEncrypted {
+		return p, "", nil
+	}
 
-		result[i] = &commonpb.Payload{}
+	nonceSize := c.cipher.NonceSize()
+	if len(p.Data) < nonceSize {
+		return nil, failureMalformed, errors.New("data length is less than nonce size")
+	}
 
-		err = result[i].Unmarshal(b)
-		if err != nil {
-			return payloads, err
-		}
+	nonce, data := p.Data[:nonceSize], p.Data[nonceSize:]
+
+	// Wrong secret and corrupted data are indistinguishable here.
+	b, err := c.cipher.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, failureAuthFailed, err
 	}
 
-	return result, nil
+	result := &commonpb.Payload{}
+
+	if err := result.Unmarshal(b); err != nil {
+		return nil, failureMalformed, err
+	}
+
+	return result, "", nil
 }
@@ -16,11 +16,16 @@
 package codec
 
 import (
+	"context"
 	"crypto/aes"
 	"encoding/hex"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	commonpb "go.temporal.io/api/common/v1"
 	"go.temporal.io/sdk/converter"
 )
@@ -111,3 +116,105 @@ func TestDecode(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, originalPayload.Data, decoded[0].Data)
 }
+
+func TestEncodeMaxPayloadSize(t *testing.T) {
+	key := []byte("d901193069ad3d2cd99ce75c303f30bc")
+
+	testcases := map[string]struct {
+		size  int
+		limit int
+		err   error
+	}{
+		"below limit": {
+			size:  10,
+			limit: 1024,
+		},
+		"above limit": {
+			size:  2048,
+			limit: 1024,
+			err:   ErrPayloadTooLarge,
+		},
+		"disabled limit": {
+			size:  2048,
+			limit: 0,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			payload, err := converter.GetDefaultDataConverter().
+				ToPayload(make([]byte, tc.size))
+			assert.NoError(t, err)
+
+			encryptionCodec, err := NewEncryptionCodec(key, WithMaxPayloadSize(tc.limit))
+			assert.NoError(t, err)
+
+			_, err = encryptionCodec.Encode([]*commonpb.Payload{payload})
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestEncryptionCodecFailureMetrics(t *testing.T) {
+	metricReader := metric.NewManualReader()
+	meterProvider := metric.NewMeterProvider(metric.WithReader(metricReader))
+
+	encoder, err := NewEncryptionCodec([]byte("0123456789abcdef"), WithMaxPayloadSize(1024))
+	require.NoError(t, err)
+
+	decoder, err := NewEncryptionCodec([]byte("fedcba9876543210"),
+		WithMetricMeter(meterProvider.Meter("test")))
+	require.NoError(t, err)
+
+	payload, err := converter.GetDefaultDataConverter().ToPayload("MAAS sensitive data")
+	require.NoError(t, err)
+
+	encoded, err := encoder.Encode([]*commonpb.Payload{payload})
+	require.NoError(t, err)
+
+	// Payload encrypted with a different secret
+	_, err = decoder.Decode(encoded)
+	assert.Error(t, err)
+
+	_, err = decoder.Decode([]*commonpb.Payload{{
+		Metadata: map[string][]byte{
+			converter.MetadataEncoding: []byte(MetadataEncodingEncrypted),
+		},
+		Data: []byte("short"),
+	}})
+	assert.Error(t, err)
+
+	var rm metricdata.ResourceMetrics
+
+	ctx := context.Background()
+
+	require.NoError(t, metricReader.Collect(ctx, &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+
+	metrics := rm.ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "codec.failures", metrics.Name)
+
+	sum, ok := metrics.Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+
+	counts := map[attribute.Set]int64{}
+	for _, dp := range sum.DataPoints {
+		counts[dp.Attributes] = dp.Value
+	}
+
+	assert.Equal(t, map[attribute.Set]int64{
+		attribute.NewSet(
+			attribute.String("operation", "decode"),
+			attribute.String("kind", "authentication_failed"),
+		): 1,
+		attribute.NewSet(
+			attribute.String("operation", "decode"),
+			attribute.String("kind", "malformed"),
+		): 1,
+	}, counts)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codec
+
+import (
+	"context"
+
+	commonpb "go.temporal.io/api/common/v1"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+)
+
+// decodeOnlyCodec implements PayloadCodec that leaves payloads as is on
+// encode, but still decodes them with the wrapped codec.
+type decodeOnlyCodec struct {
+	codec converter.PayloadCodec
+}
+
+// NewDecodeOnlyCodec returns PayloadCodec that does not encode payloads, but
+// decodes payloads encoded by c. Payloads not encoded by c must be left as is
+// by c on decode, as EncryptionCodec does.
+func NewDecodeOnlyCodec(c converter.PayloadCodec) converter.PayloadCodec {
+	return &decodeOnlyCodec{codec: c}
+}
+
+// Encode implements converter.PayloadCodec.Encode.
+func (c *decodeOnlyCodec) Encode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	return payloads, nil
+}
+
+// Decode implements converter.PayloadCodec.Decode.
+func (c *decodeOnlyCodec) Decode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	return c.codec.Decode(payloads)
+}
+
+// PassthroughDataConverter is converter.DataConverter that uses passthrough
+// data converter for workflows of certain types and their activities, e.g. to
+// not encrypt high-volume and non-sensitive payloads.
+type PassthroughDataConverter struct {
+	converter.DataConverter
+	passthrough   converter.DataConverter
+	workflowTypes map[string]struct{}
+}
+
+// NewPassthroughDataConverter returns PassthroughDataConverter using
+// passthrough data converter for workflows of workflowTypes and dc otherwise.
+// passthrough must be able to decode payloads encoded by dc, see
+// NewDecodeOnlyCodec.
+func NewPassthroughDataConverter(dc, passthrough converter.DataConverter,
+	workflowTypes []string) *PassthroughDataConverter {
+	c := &PassthroughDataConverter{
+		DataConverter: dc,
+		passthrough:   passthrough,
+		workflowTypes: make(map[string]struct{}, len(workflowTypes)),
+	}
+
+	for _, t := range workflowTypes {
+		c.workflowTypes[t] = struct{}{}
+	}
+
+	return c
+}
+
+// WithContext implements workflow.ContextAware.WithContext.
+func (c *PassthroughDataConverter) WithContext(ctx context.Context) converter.DataConverter {
+	if activity.IsActivity(ctx) {
+		if wt := activity.GetInfo(ctx).WorkflowType; wt != nil && c.isPassthrough(wt.Name) {
+			return c.passthrough
+		}
+	}
+
+	if dc, ok := c.DataConverter.(workflow.ContextAware); ok {
+		return dc.WithContext(ctx)
+	}
+
+	return c.DataConverter
+}
+
+// WithWorkflowContext implements workflow.ContextAware.WithWorkflowContext.
+func (c *PassthroughDataConverter) WithWorkflowContext(ctx workflow.Context) converter.DataConverter {
+	if c.isPassthrough(workflow.GetInfo(ctx).WorkflowType.Name) {
+		return c.passthrough
+	}
+
+	if dc, ok := c.DataConverter.(workflow.ContextAware); ok {
+		return dc.WithWorkflowContext(ctx)
+	}
+
+	return c.DataConverter
+}
+
+func (c *PassthroughDataConverter) isPassthrough(workflowType string) bool {
+	_, ok := c.workflowTypes[workflowType]
+	return ok
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestDecodeOnlyCodec(t *testing.T) {
+	encryptor, err := NewEncryptionCodec([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+
+	encrypted := converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), encryptor)
+	passthrough := converter.NewCodecDataConverter(converter.GetDefaultDataConverter(),
+		NewDecodeOnlyCodec(encryptor))
+
+	payload, err := passthrough.ToPayload("heartbeat")
+	require.NoError(t, err)
+	assert.NotEqual(t, MetadataEncodingEncrypted,
+		string(payload.Metadata[converter.MetadataEncoding]))
+
+	// Both passthrough and encrypted payloads are decoded
+	for _, dc := range []converter.DataConverter{encrypted, passthrough} {
+		payload, err := dc.ToPayload("heartbeat")
+		require.NoError(t, err)
+
+		var result string
+		require.NoError(t, passthrough.FromPayload(payload, &result))
+		assert.Equal(t, "heartbeat", result)
+	}
+}
+
+func TestPassthroughDataConverter(t *testing.T) {
+	encryptor, err := NewEncryptionCodec([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+
+	dc := NewPassthroughDataConverter(
+		converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), encryptor),
+		converter.NewCodecDataConverter(converter.GetDefaultDataConverter(),
+			NewDecodeOnlyCodec(encryptor)),
+		[]string{"heartbeat"},
+	)
+
+	encoding := func(dc converter.DataConverter) string {
+		payload, err := dc.ToPayload("MAAS data")
+		require.NoError(t, err)
+
+		return string(payload.Metadata[converter.MetadataEncoding])
+	}
+
+	encodingActivity := func(ctx context.Context) (string, error) {
+		return encoding(dc.WithContext(ctx)), nil
+	}
+
+	testWorkflow := func(ctx workflow.Context) ([]string, error) {
+		ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			StartToCloseTimeout: time.Minute,
+		})
+
+		var activityEncoding string
+		if err := workflow.ExecuteActivity(ctx, "encoding").Get(ctx, &activityEncoding); err != nil {
+			return nil, err
+		}
+
+		return []string{encoding(dc.WithWorkflowContext(ctx)), activityEncoding}, nil
+	}
+
+	testcases := map[string]struct {
+		workflowType string
+		encrypted    bool
+	}{
+		"passthrough workflow": {workflowType: "heartbeat"},
+		"other workflow":       {workflowType: "power-on", encrypted: true},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			suite := testsuite.WorkflowTestSuite{}
+			env := suite.NewTestWorkflowEnvironment()
+			env.RegisterWorkflowWithOptions(testWorkflow,
+				workflow.RegisterOptions{Name: tc.workflowType})
+			env.RegisterActivityWithOptions(encodingActivity,
+				activity.RegisterOptions{Name: "encoding"})
+
+			env.ExecuteWorkflow(tc.workflowType)
+			require.NoError(t, env.GetWorkflowError())
+
+			var result []string
+			require.NoError(t, env.GetWorkflowResult(&result))
+
+			for _, e := range result {
+				assert.Equal(t, tc.encrypted, e == MetadataEncodingEncrypted)
+			}
+		})
+	}
+
+	// Context of a client is not checked
+	assert.Equal(t, MetadataEncodingEncrypted, encoding(dc.WithContext(context.Background())))
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+)
+
+const (
+	// MetadataEncryptionKeyID is payload metadata key holding UUID of the MAAS
+	// installation, whose secret was used to encrypt the payload.
+	MetadataEncryptionKeyID = "encryption-key-id"
+	// TenantHeader is Temporal header used to propagate UUID of the MAAS
+	// installation that workflow or activity is executed for.
+	TenantHeader = "maas-uuid"
+)
+
+var (
+	// ErrUnknownTenant is returned when payload is encrypted with a secret of
+	// a MAAS installation that is not configured.
+	ErrUnknownTenant = errors.New("unknown MAAS installation")
+)
+
+// TenantEncryptionCodec implements PayloadCodec that encrypts payloads with
+// a secret of one of several MAAS installations (tenants), identified by
+// their UUID. Decode selects the secret based on payload metadata.
+type TenantEncryptionCodec struct {
+	codecs map[string]*EncryptionCodec
+	tenant string
+}
+
+// NewTenantEncryptionCodec returns TenantEncryptionCodec that encodes
+// payloads with the secret of tenant. keys must contain secret of tenant.
+func NewTenantEncryptionCodec(tenant string, keys map[string][]byte,
+	options ...EncryptionCodecOption) (*TenantEncryptionCodec, error) {
+	if _, ok := keys[tenant]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTenant, tenant)
+	}
+
+	c := &TenantEncryptionCodec{
+		codecs: make(map[string]*EncryptionCodec, len(keys)),
+		tenant: tenant,
+	}
+
+	for uuid, key := range keys {
+		codec, err := NewEncryptionCodec(key, options...)
+		if err != nil {
+			return nil, fmt.Errorf("MAAS installation %q: %w", uuid, err)
+		}
+
+		c.codecs[uuid] = codec
+	}
+
+	return c, nil
+}
+
+// ForTenant returns codec that encodes payloads with the secret of tenant.
+func (c *TenantEncryptionCodec) ForTenant(tenant string) (*TenantEncryptionCodec, error) {
+	if _, ok := c.codecs[tenant]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTenant, tenant)
+	}
+
+	return &TenantEncryptionCodec{codecs: c.codecs, tenant: tenant}, nil
+}
+
+// Encode implements converter.PayloadCodec.Encode.
+func (c *TenantEncryptionCodec) Encode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	result, err := c.codecs[c.tenant].Encode(payloads)
+	if err != nil {
+		return result, err
+	}
+
+	// Payloads of the installation without UUID look like the ones encoded
+	// by EncryptionCodec.
+	if c.tenant != "" {
+		for _, p := range result {
+			p.Metadata[MetadataEncryptionKeyID] = []byte(c.tenant)
+		}
+	}
+
+	return result, nil
+}
+
+// Decode implements converter.PayloadCodec.Decode.
+// Encrypted payloads without key ID are decoded with the secret of the tenant
+// the codec encodes payloads for.
+func (c *TenantEncryptionCodec) Decode(payloads []*commonpb.Payload) ([]*commonpb.Payload, error) {
+	result := make([]*commonpb.Payload, len(payloads))
+	primary := c.codecs[c.tenant]
+
+	for i, p := range payloads {
+		tenant := c.tenant
+		if id, ok := p.Metadata[MetadataEncryptionKeyID]; ok {
+			tenant = string(id)
+		}
+
+		decoded, kind, err := c.decode(tenant, p)
+		if err != nil && kind != failureMalformed {
+			decoded, err = c.retryDecode(p, err)
+		}
+
+		if err != nil {
+			return payloads, primary.fail("decode", kind, err)
+		}
+
+		result[i] = decoded
+	}
+
+	return result, nil
+}
+
+func (c *TenantEncryptionCodec) decode(tenant string,
+	p *commonpb.Payload) (*commonpb.Payload, string, error) {
+	codec, ok := c.codecs[tenant]
+	if !ok {
+		return nil, failureUnknownTenant, fmt.Errorf("%w: %q", ErrUnknownTenant, tenant)
+	}
+
+	return codec.decode(p)
+}
+
+// retryDecode tries to decode p, which failed to decode with err, with
+// secrets of all the MAAS installations, as configured by WithDecodeRetries.
+// It returns err if none of the attempts succeeded.
+func (c *TenantEncryptionCodec) retryDecode(p *commonpb.Payload,
+	err error) (*commonpb.Payload, error) {
+	primary := c.codecs[c.tenant]
+
+	for attempt := 0; attempt < primary.maxDecodeRetries; attempt++ {
+		time.Sleep(primary.decodeRetryBackoff)
+		primary.decodeRetries.Add(context.Background(), 1)
+
+		for _, codec := range c.codecs {
+			if decoded, _, err := codec.decode(p); err == nil {
+				return decoded, nil
+			}
+		}
+	}
+
+	return nil, err
+}
+
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx carrying UUID of the MAAS installation.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns UUID of the MAAS installation carried by ctx.
+// ctx can be either context.Context or workflow.Context.
+func TenantFromContext(ctx interface{ Value(interface{}) interface{} }) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok
+}
+
+// tenantPropagator propagates UUID of the MAAS installation via TenantHeader
+type tenantPropagator struct{}
+
+// NewTenantPropagator returns workflow.ContextPropagator that propagates UUID
+// of the MAAS installation set with WithTenant to workflows and activities.
+func NewTenantPropagator() workflow.ContextPropagator {
+	return tenantPropagator{}
+}
+
+func (tenantPropagator) Inject(ctx context.Context, w workflow.HeaderWriter) error {
+	return injectTenant(ctx, w)
+}
+
+func (tenantPropagator) InjectFromWorkflow(ctx workflow.Context, w workflow.HeaderWriter) error {
+	return injectTenant(ctx, w)
+}
+
+func (tenantPropagator) Extract(ctx context.Context, r workflow.HeaderReader) (context.Context, error) {
+	tenant, ok, err := extractTenant(r)
+	if err != nil || !ok {
+		return ctx, err
+	}
+
+	return WithTenant(ctx, tenant), nil
+}
+
+func (tenantPropagator) ExtractToWorkflow(ctx workflow.Context,
+	r workflow.HeaderReader) (workflow.Context, error) {
+	tenant, ok, err := extractTenant(r)
+	if err != nil || !ok {
+		return ctx, err
+	}
+
+	return workflow.WithValue(ctx, tenantContextKey{}, tenant), nil
+}
+
+func injectTenant(ctx interface{ Value(interface{}) interface{} }, w workflow.HeaderWriter) error {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	// Header is not passed through payload codecs, so the default converter
+	// is used.
+	payload, err := converter.GetDefaultDataConverter().ToPayload(tenant)
+	if err != nil {
+		return err
+	}
+
+	w.Set(TenantHeader, payload)
+
+	return nil
+}
+
+func extractTenant(r workflow.HeaderReader) (string, bool, error) {
+	payload, ok := r.Get(TenantHeader)
+	if !ok {
+		return "", false, nil
+	}
+
+	var tenant string
+	if err := converter.GetDefaultDataConverter().FromPayload(payload, &tenant); err != nil {
+		return "", false, err
+	}
+
+	return tenant, true, nil
+}
+
+// TenantDataConverter is converter.DataConverter that uses a data converter
+// of the MAAS installation carried by the workflow or activity context.
+type TenantDataConverter struct {
+	converter.DataConverter
+	tenants map[string]converter.DataConverter
+}
+
+// NewTenantDataConverter returns TenantDataConverter using data converters of
+// tenants, and dc when context carries no or unknown installation UUID.
+func NewTenantDataConverter(dc converter.DataConverter,
+	tenants map[string]converter.DataConverter) *TenantDataConverter {
+	return &TenantDataConverter{DataConverter: dc, tenants: tenants}
+}
+
+// WithContext implements workflow.ContextAware.WithContext.
+func (c *TenantDataConverter) WithContext(ctx context.Context) converter.DataConverter {
+	return c.forContext(ctx)
+}
+
+// WithWorkflowContext implements workflow.ContextAware.WithWorkflowContext.
+func (c *TenantDataConverter) WithWorkflowContext(ctx workflow.Context) converter.DataConverter {
+	return c.forContext(ctx)
+}
+
+func (c *TenantDataConverter) forContext(ctx interface{ Value(interface{}) interface{} }) converter.DataConverter {
+	if tenant, ok := TenantFromContext(ctx); ok {
+		if dc, ok := c.tenants[tenant]; ok {
+			return dc
+		}
+	}
+
+	return c.DataConverter
+}
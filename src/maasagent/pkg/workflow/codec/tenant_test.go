@@ -0,0 +1,245 @@
+// Copyright (c) 2023-2024 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+)
+
+var tenantKeys = map[string][]byte{
+	"uuid-a": []byte("0123456789abcdef"),
+	"uuid-b": []byte("fedcba9876543210"),
+}
+
+func TestTenantEncryptionCodec(t *testing.T) {
+	codecA, err := NewTenantEncryptionCodec("uuid-a", tenantKeys)
+	require.NoError(t, err)
+
+	codecB, err := codecA.ForTenant("uuid-b")
+	require.NoError(t, err)
+
+	legacy, err := NewEncryptionCodec(tenantKeys["uuid-a"])
+	require.NoError(t, err)
+
+	payload, err := converter.GetDefaultDataConverter().ToPayload("MAAS sensitive data")
+	require.NoError(t, err)
+
+	testcases := map[string]struct {
+		encoder converter.PayloadCodec
+		decoder converter.PayloadCodec
+		keyID   string
+	}{
+		"own tenant": {
+			encoder: codecA,
+			decoder: codecB,
+			keyID:   "uuid-a",
+		},
+		"other tenant": {
+			encoder: codecB,
+			decoder: codecA,
+			keyID:   "uuid-b",
+		},
+		// Payloads without key id are decoded with the secret of codec tenant
+		"payload without key id": {
+			encoder: legacy,
+			decoder: codecA,
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			encoded, err := tc.encoder.Encode([]*commonpb.Payload{payload})
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.keyID, string(encoded[0].Metadata[MetadataEncryptionKeyID]))
+
+			decoded, err := tc.decoder.Decode(encoded)
+			require.NoError(t, err)
+
+			assert.Equal(t, payload.Data, decoded[0].Data)
+		})
+	}
+}
+
+func TestTenantEncryptionCodecUnknownTenant(t *testing.T) {
+	_, err := NewTenantEncryptionCodec("uuid-c", tenantKeys)
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	c, err := NewTenantEncryptionCodec("uuid-a", tenantKeys)
+	require.NoError(t, err)
+
+	_, err = c.ForTenant("uuid-c")
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	payload, err := converter.GetDefaultDataConverter().ToPayload("MAAS sensitive data")
+	require.NoError(t, err)
+
+	encoded, err := c.Encode([]*commonpb.Payload{payload})
+	require.NoError(t, err)
+
+	encoded[0].Metadata[MetadataEncryptionKeyID] = []byte("uuid-c")
+
+	_, err = c.Decode(encoded)
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestTenantEncryptionCodecDecodeRetries(t *testing.T) {
+	metricReader := metric.NewManualReader()
+	meterProvider := metric.NewMeterProvider(metric.WithReader(metricReader))
+
+	encoder, err := NewTenantEncryptionCodec("uuid-b", tenantKeys)
+	require.NoError(t, err)
+
+	decoder, err := NewTenantEncryptionCodec("uuid-a", tenantKeys,
+		WithDecodeRetries(2, time.Millisecond),
+		WithMetricMeter(meterProvider.Meter("test")))
+	require.NoError(t, err)
+
+	payload, err := converter.GetDefaultDataConverter().ToPayload("MAAS sensitive data")
+	require.NoError(t, err)
+
+	encoded, err := encoder.Encode([]*commonpb.Payload{payload})
+	require.NoError(t, err)
+
+	// Key ID unknown to the decoder, e.g. during a key rotation
+	encoded[0].Metadata[MetadataEncryptionKeyID] = []byte("uuid-c")
+
+	decoded, err := decoder.Decode(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, payload.Data, decoded[0].Data)
+
+	// Payload that no configured secret can decrypt
+	encoded[0].Data[len(encoded[0].Data)-1] ^= 0xff
+
+	_, err = decoder.Decode(encoded)
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	var rm metricdata.ResourceMetrics
+
+	require.NoError(t, metricReader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	counts := map[string]int64{}
+
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		sum, ok := m.Data.(metricdata.Sum[int64])
+		require.True(t, ok)
+
+		for _, dp := range sum.DataPoints {
+			counts[m.Name] += dp.Value
+		}
+	}
+
+	assert.Equal(t, map[string]int64{
+		"codec.decode_retries": 3,
+		"codec.failures":       1,
+	}, counts)
+}
+
+func TestTenantDataConverter(t *testing.T) {
+	codecA, err := NewTenantEncryptionCodec("uuid-a", tenantKeys)
+	require.NoError(t, err)
+
+	codecB, err := codecA.ForTenant("uuid-b")
+	require.NoError(t, err)
+
+	dc := NewTenantDataConverter(
+		converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), codecA),
+		map[string]converter.DataConverter{
+			"uuid-b": converter.NewCodecDataConverter(converter.GetDefaultDataConverter(), codecB),
+		},
+	)
+
+	testcases := map[string]struct {
+		ctx   context.Context
+		keyID string
+	}{
+		"no tenant": {
+			ctx:   context.Background(),
+			keyID: "uuid-a",
+		},
+		"other tenant": {
+			ctx:   WithTenant(context.Background(), "uuid-b"),
+			keyID: "uuid-b",
+		},
+		"unknown tenant": {
+			ctx:   WithTenant(context.Background(), "uuid-c"),
+			keyID: "uuid-a",
+		},
+	}
+
+	for name, tc := range testcases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			payload, err := dc.WithContext(tc.ctx).ToPayload("MAAS sensitive data")
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.keyID, string(payload.Metadata[MetadataEncryptionKeyID]))
+		})
+	}
+}
+
+type header map[string]*commonpb.Payload
+
+func (h header) Set(key string, value *commonpb.Payload) { h[key] = value }
+
+func (h header) Get(key string) (*commonpb.Payload, bool) {
+	v, ok := h[key]
+	return v, ok
+}
+
+func (h header) ForEachKey(handler func(string, *commonpb.Payload) error) error {
+	for k, v := range h {
+		if err := handler(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestTenantPropagator(t *testing.T) {
+	p := NewTenantPropagator()
+	h := header{}
+
+	require.NoError(t, p.Inject(context.Background(), h))
+	assert.Empty(t, h)
+
+	require.NoError(t, p.Inject(WithTenant(context.Background(), "uuid-b"), h))
+
+	ctx, err := p.Extract(context.Background(), h)
+	require.NoError(t, err)
+
+	tenant, ok := TenantFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "uuid-b", tenant)
+}